@@ -81,23 +81,51 @@ func migrateModels() {
 		}
 	}
 
+	// 使用自定义的角色权限关联表
+	if err := DB.SetupJoinTable(&models.Role{}, "Permissions", &models.RolePermission{}); err != nil {
+		log.Fatal("数据库迁移失败:", err)
+	}
+
 	// 执行迁移
 	err := DB.AutoMigrate(
-		&models.User{},         // 用户基础信息
-		&models.Student{},      // 学生信息
-		&models.Counselor{},    // 咨询师信息
-		&models.Appointment{},  // 咨询预约
-		&models.TimeSlot{},     // 咨询时间段
-		&models.ExamPaper{},    // 试卷
-		&models.ExamQuestion{}, // 试题
-		&models.ExamRecord{},   // 考试记录
-		&models.Resource{},     // 资源（文章、视频等）
-		&models.ResourceTag{},  // 资源标签关联
-		&models.Tag{},          // 标签
-		&models.Feedback{},     // 用户反馈
-		&models.Config{},       // 系统配置
-		&models.Token{},        // 用户令牌
-		&models.ChunkInfo{},    // 分片上传信息
+		&models.User{},                     // 用户基础信息
+		&models.Student{},                  // 学生信息
+		&models.Counselor{},                // 咨询师信息
+		&models.Appointment{},              // 咨询预约
+		&models.TimeSlot{},                 // 咨询时间段
+		&models.AppointmentStatusHistory{}, // 预约状态变更记录
+		&models.AvailabilityTemplate{},     // 可预约时间模板
+		&models.AvailabilityException{},    // 可预约时间例外日期
+		&models.Blackout{},                 // 停诊日历
+		&models.WaitlistEntry{},            // 预约候补
+		&models.BookingRestriction{},       // 预约限制
+		&models.CalendarFeed{},             // 日历订阅
+		&models.AppointmentReminder{},      // 预约提醒发送记录
+		&models.Notification{},             // 站内通知
+		&models.ExamPaper{},                // 试卷
+		&models.ExamQuestion{},             // 试题
+		&models.ExamRecord{},               // 考试记录
+		&models.Resource{},                 // 资源（文章、视频等）
+		&models.ResourceTag{},              // 资源标签关联
+		&models.Tag{},                      // 标签
+		&models.Feedback{},                 // 用户反馈
+		&models.Config{},                   // 系统配置
+		&models.Token{},                    // 用户令牌
+		&models.ChunkInfo{},                // 分片上传信息
+		&models.PasswordReset{},            // 找回密码验证码
+		&models.TwoFactor{},                // 二次验证配置
+		&models.RecoveryCode{},             // 二次验证恢复码
+		&models.LoginAttempt{},             // 登录尝试审计
+		&models.PasswordHistory{},          // 历史密码
+		&models.Role{},                     // 角色
+		&models.Permission{},               // 权限点
+		&models.RolePermission{},           // 角色权限关联
+		&models.ExternalIdentity{},         // 外部身份绑定
+		&models.SSOState{},                 // 单点登录临时状态
+		&models.ContactVerification{},      // 联系方式变更验证码
+		&models.AuditLog{},                 // 审计日志
+		&models.DataExport{},               // 个人数据导出任务
+		&models.ErasureRequest{},           // 个人数据删除申请
 	)
 
 	if err != nil {
@@ -105,4 +133,7 @@ func migrateModels() {
 	}
 
 	log.Println("数据库迁移完成")
+
+	// 初始化内置角色和权限
+	seedRBAC()
 }
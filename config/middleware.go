@@ -3,28 +3,15 @@ package config
 import (
 	"ental-health-system/models"
 	"ental-health-system/utils"
-	"errors"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"golang.org/x/time/rate"
 )
 
-var (
-	jwtSecret = []byte("your-secret-key") // 实际应用中应从环境变量获取
-)
-
-// Claims JWT声明结构
-type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.StandardClaims
-}
-
 // IPRateLimiter IP限流器
 type IPRateLimiter struct {
 	ips map[string]*rate.Limiter
@@ -112,8 +99,8 @@ func JWTMiddleware() gin.HandlerFunc {
 
 		// 从数据库查询token
 		var tokenRecord models.Token
-		if err := DB.Where("token = ? AND is_revoked = ? AND expires_at > ?",
-			tokenString, false, time.Now()).First(&tokenRecord).Error; err != nil {
+		if err := DB.Where("token = ? AND type = ? AND is_revoked = ? AND expires_at > ?",
+			tokenString, utils.TokenTypeAccess, false, time.Now()).First(&tokenRecord).Error; err != nil {
 			c.JSON(401, gin.H{"error": "无效或已过期的认证令牌"})
 			c.Abort()
 			return
@@ -134,6 +121,8 @@ func JWTMiddleware() gin.HandlerFunc {
 		// 将用户信息存储在上下文中
 		c.Set("userID", claims.UserID)
 		c.Set("userRole", claims.Role)
+		c.Set("tokenID", tokenRecord.ID)
+		c.Set("tokenFamily", tokenRecord.FamilyID)
 		c.Next()
 	}
 }
@@ -167,42 +156,6 @@ func LoggerMiddleware() gin.HandlerFunc {
 	}
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(userID uint, role string) (string, error) {
-	nowTime := time.Now()
-	expireTime := nowTime.Add(24 * time.Hour)
-
-	claims := Claims{
-		UserID: userID,
-		Role:   role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expireTime.Unix(),
-			IssuedAt:  nowTime.Unix(),
-		},
-	}
-
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := tokenClaims.SignedString(jwtSecret)
-	return token, err
-}
-
-// ParseToken 解析JWT令牌
-func ParseToken(token string) (*Claims, error) {
-	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := tokenClaims.Claims.(*Claims); ok && tokenClaims.Valid {
-		return claims, nil
-	}
-
-	return nil, errors.New("invalid token")
-}
-
 // RoleAuthMiddleware 角色认证中间件
 func RoleAuthMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
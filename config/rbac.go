@@ -0,0 +1,228 @@
+package config
+
+import (
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPermissions 内置权限点
+var defaultPermissions = []models.Permission{
+	{Code: "user:read:any", Description: "查看任意用户信息"},
+	{Code: "user:manage", Description: "创建、修改、删除用户及解锁账户"},
+	{Code: "session:manage:any", Description: "注销任意用户的登录会话"},
+	{Code: "role:manage", Description: "管理角色及其权限"},
+	{Code: "student:read:any", Description: "查看任意学生档案"},
+	{Code: "appointment:create", Description: "预约咨询"},
+	{Code: "appointment:read:own", Description: "查看本人相关的预约"},
+	{Code: "appointment:read:any", Description: "查看任意预约"},
+	{Code: "appointment:manage:own", Description: "处理本人相关的预约"},
+	{Code: "appointment:manage:any", Description: "处理任意预约"},
+	{Code: "appointment:delete", Description: "删除预约"},
+	{Code: "timeslot:manage:own", Description: "管理本人的咨询时间段"},
+	{Code: "timeslot:manage:any", Description: "管理任意咨询师的咨询时间段"},
+	{Code: "counseling:read:any", Description: "查看任意咨询记录"},
+	{Code: "report:read", Description: "查看统计报表"},
+	{Code: "audit:read", Description: "查看审计日志"},
+	{Code: "privacy:manage", Description: "审核并执行个人数据删除申请"},
+	{Code: "calendar:manage", Description: "管理节假日及停诊日历"},
+}
+
+// defaultRoles 内置角色及其初始权限，仅在角色首次创建时写入，之后以数据库为准
+var defaultRoles = []struct {
+	role        models.Role
+	permissions []string
+}{
+	{models.Role{Name: "admin", DisplayName: "管理员", IsSystem: true}, []string{"*"}},
+	{models.Role{Name: "student", DisplayName: "学生", IsSystem: true},
+		[]string{"appointment:create", "appointment:read:own"}},
+	{models.Role{Name: "counselor", DisplayName: "咨询师", IsSystem: true},
+		[]string{"appointment:read:own", "appointment:manage:own", "timeslot:manage:own"}},
+	{models.Role{Name: "advisor", DisplayName: "辅导员"},
+		[]string{"student:read:any", "report:read"}},
+	{models.Role{Name: "supervisor", DisplayName: "督导"},
+		[]string{"appointment:read:any", "appointment:manage:any", "timeslot:manage:any", "counseling:read:any", "report:read"}},
+	{models.Role{Name: "analyst", DisplayName: "数据分析员"},
+		[]string{"report:read"}},
+	{models.Role{Name: "auditor", DisplayName: "只读审计员"},
+		[]string{"*:read:*", "audit:read"}},
+}
+
+// seedRBAC 写入内置权限点和角色
+func seedRBAC() {
+	for _, p := range defaultPermissions {
+		perm := p
+		if err := DB.Where(models.Permission{Code: perm.Code}).FirstOrCreate(&perm).Error; err != nil {
+			log.Printf("初始化权限 %s 失败: %v", perm.Code, err)
+		}
+	}
+
+	for _, d := range defaultRoles {
+		var existing models.Role
+		if DB.Where("name = ?", d.role.Name).First(&existing).Error == nil {
+			continue
+		}
+
+		// 通配权限不在内置列表中，按需创建
+		perms := make([]models.Permission, 0, len(d.permissions))
+		for _, code := range d.permissions {
+			perm := models.Permission{Code: code}
+			if err := DB.Where(models.Permission{Code: code}).FirstOrCreate(&perm).Error; err != nil {
+				log.Printf("初始化权限 %s 失败: %v", code, err)
+				continue
+			}
+			perms = append(perms, perm)
+		}
+
+		role := d.role
+		role.Permissions = perms
+		if err := DB.Create(&role).Error; err != nil {
+			log.Printf("初始化角色 %s 失败: %v", role.Name, err)
+		}
+	}
+}
+
+// 角色权限缓存，多实例部署时各实例最迟在缓存过期后看到权限变更
+var permissionCache = struct {
+	mu       sync.RWMutex
+	roles    map[string][]string
+	loadedAt time.Time
+}{}
+
+// defaultPermissionCacheTTL 权限缓存默认有效期，可通过 PERMISSION_CACHE_TTL 配置
+const defaultPermissionCacheTTL = time.Minute
+
+// InvalidatePermissionCache 使权限缓存失效，角色权限变更后调用
+func InvalidatePermissionCache() {
+	permissionCache.mu.Lock()
+	permissionCache.roles = nil
+	permissionCache.mu.Unlock()
+}
+
+// rolePermissions 获取角色拥有的权限编码，优先读取缓存
+func rolePermissions(role string) ([]string, error) {
+	ttl := utils.DurationFromEnv("PERMISSION_CACHE_TTL", defaultPermissionCacheTTL)
+
+	permissionCache.mu.RLock()
+	if permissionCache.roles != nil && time.Since(permissionCache.loadedAt) < ttl {
+		perms := permissionCache.roles[role]
+		permissionCache.mu.RUnlock()
+		return perms, nil
+	}
+	permissionCache.mu.RUnlock()
+
+	// 一次性加载所有角色的权限
+	var rows []struct {
+		Name string
+		Code string
+	}
+	if err := DB.Table("role_permissions").
+		Select("roles.name, permissions.code").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string)
+	for _, r := range rows {
+		roles[r.Name] = append(roles[r.Name], r.Code)
+	}
+
+	permissionCache.mu.Lock()
+	permissionCache.roles = roles
+	permissionCache.loadedAt = time.Now()
+	permissionCache.mu.Unlock()
+
+	return roles[role], nil
+}
+
+// matchPermission 判断已授予的权限是否覆盖所需权限
+// 每段中的 * 匹配任意一段，末尾的 * 匹配剩余所有段，如 * 、appointment:* 、*:read:*
+func matchPermission(granted, required string) bool {
+	g := strings.Split(granted, ":")
+	r := strings.Split(required, ":")
+	for i, seg := range g {
+		if seg == "*" && i == len(g)-1 {
+			return true
+		}
+		if i >= len(r) || (seg != "*" && seg != r[i]) {
+			return false
+		}
+	}
+	return len(g) == len(r)
+}
+
+// HasPermission 判断角色是否拥有指定权限
+func HasPermission(role, permission string) bool {
+	perms, err := rolePermissions(role)
+	if err != nil {
+		log.Printf("加载角色权限失败: %v", err)
+		return false
+	}
+	for _, granted := range perms {
+		if matchPermission(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleCovers 判断角色 role 的权限是否覆盖角色 target 的全部权限，
+// 用于防止管理员创建、修改权限比自己更大的用户
+func RoleCovers(role, target string) bool {
+	if role == target {
+		return true
+	}
+	granted, err := rolePermissions(role)
+	if err != nil {
+		log.Printf("加载角色权限失败: %v", err)
+		return false
+	}
+	required, err := rolePermissions(target)
+	if err != nil {
+		log.Printf("加载角色权限失败: %v", err)
+		return false
+	}
+	for _, r := range required {
+		covered := false
+		for _, g := range granted {
+			if matchPermission(g, r) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// RequirePermission 权限认证中间件，当前角色拥有任一指定权限即可访问
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("userRole")
+		if role == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权访问"})
+			c.Abort()
+			return
+		}
+
+		for _, p := range permissions {
+			if HasPermission(role, p) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该资源"})
+		c.Abort()
+	}
+}
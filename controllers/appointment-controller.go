@@ -1,56 +1,442 @@
 package controllers
 
 import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// CreateAppointment 创建预约
+// CreateAppointmentRequest 创建预约请求结构
+type CreateAppointmentRequest struct {
+	TimeSlotID uint   `json:"time_slot_id" binding:"required"`
+	Reason     string `json:"reason" binding:"max=500"`
+}
+
+// UpdateAppointmentRequest 修改预约信息请求结构
+type UpdateAppointmentRequest struct {
+	Reason *string `json:"reason" binding:"omitempty,max=500"` // 咨询原因，仅学生本人可修改
+	Notes  *string `json:"notes" binding:"omitempty,max=5000"` // 咨询记录备注，仅咨询师可修改
+}
+
+// appointmentError 预约业务错误，携带返回给客户端的状态码和提示
+type appointmentError struct {
+	status  int
+	message string
+}
+
+func (e *appointmentError) Error() string { return e.message }
+
+// activeAppointmentStatuses 占用时间的预约状态，用于冲突检测
+var activeAppointmentStatuses = []string{
+	models.AppointmentStatusPending,
+	models.AppointmentStatusConfirmed,
+	models.AppointmentStatusCheckedIn,
+}
+
+// respondAppointmentError 将预约业务错误转换为响应
+func respondAppointmentError(c *gin.Context, err error, fallback string) {
+	var appErr *appointmentError
+	if errors.As(err, &appErr) {
+		c.JSON(appErr.status, gin.H{"error": appErr.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
+
+// lockBookableSlot 锁定时间段并检查是否可预约：状态为可预约、尚未开始且不在停诊期间
+func lockBookableSlot(tx *gorm.DB, slotID uint, now time.Time) (*models.TimeSlot, error) {
+	var slot models.TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&slot, slotID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &appointmentError{http.StatusNotFound, "时间段不存在"}
+		}
+		return nil, err
+	}
+	if slot.Status != models.TimeSlotStatusAvailable {
+		return nil, &appointmentError{http.StatusConflict, "该时间段已被预约"}
+	}
+	if !slot.StartTime.After(now) {
+		return nil, &appointmentError{http.StatusBadRequest, "不能预约已开始的时间段"}
+	}
+	blackouts, err := applicableBlackouts(tx, uint(slot.CounselorID), slot.StartTime, slot.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(blackouts) > 0 {
+		return nil, &appointmentError{http.StatusConflict, "该时间段处于停诊期间"}
+	}
+	return &slot, nil
+}
+
+// checkStudentOverlap 检查学生在 [start, end) 内是否已有占用时间的预约，excludeID 为改约时排除的预约本身
+func checkStudentOverlap(tx *gorm.DB, userID, excludeID uint, start, end time.Time) error {
+	var overlapping int64
+	if err := tx.Model(&models.Appointment{}).
+		Where("user_id = ? AND id <> ? AND status IN ? AND start_time < ? AND end_time > ?",
+			userID, excludeID, activeAppointmentStatuses, end, start).
+		Count(&overlapping).Error; err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return &appointmentError{http.StatusConflict, "该时间段与您已有的预约冲突"}
+	}
+	return nil
+}
+
+// bookTimeSlot 在事务中预约时间段：锁定时间段和学生行，检查可预约状态、时间和学生的时间冲突，
+// 创建预约并将时间段标记为已预约；并发预约同一时间段时只有一个请求能成功
+func bookTimeSlot(tx *gorm.DB, userID, slotID uint, reason string, now time.Time) (*models.Appointment, error) {
+	slot, err := lockBookableSlot(tx, slotID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// 锁定学生行，串行化同一学生的并发预约，保证冲突检测有效
+	var student models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&student, userID).Error; err != nil {
+		return nil, err
+	}
+	if student.Status != "active" {
+		return nil, &appointmentError{http.StatusForbidden, "账户状态不允许预约"}
+	}
+	if err := checkBookingRestriction(tx, userID, now); err != nil {
+		return nil, err
+	}
+	if err := checkStudentOverlap(tx, userID, 0, slot.StartTime, slot.EndTime); err != nil {
+		return nil, err
+	}
+
+	var counselor models.User
+	if err := tx.Where("id = ? AND role = ? AND status = ?", slot.CounselorID, "counselor", "active").
+		First(&counselor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &appointmentError{http.StatusConflict, "该咨询师暂不可预约"}
+		}
+		return nil, err
+	}
+
+	appointment := models.Appointment{
+		UserID:        int(student.ID),
+		Username:      student.Username,
+		CounselorID:   int(counselor.ID),
+		CounselorName: counselor.Name,
+		TimeSlotID:    int(slot.ID),
+		StartTime:     slot.StartTime,
+		EndTime:       slot.EndTime,
+		Status:        models.AppointmentStatusPending,
+		Reason:        reason,
+	}
+	if err := tx.Create(&appointment).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(slot).Update("status", models.TimeSlotStatusBooked).Error; err != nil {
+		return nil, err
+	}
+	if err := recordAppointmentHistory(tx, appointment.ID, "", appointment.Status,
+		&userID, models.AppointmentActorStudent, ""); err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// @Summary 预约咨询
+// @Description 选择咨询师的可预约时间段创建预约，预约后状态为待确认
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body CreateAppointmentRequest true "预约信息"
+// @Success 200 {object} map[string]interface{} "预约成功"
+// @Failure 404 {object} map[string]interface{} "时间段不存在"
+// @Failure 409 {object} map[string]interface{} "时间段已被预约或时间冲突"
+// @Router /appointments [post]
 func CreateAppointment(c *gin.Context) {
-	// TODO: 实现创建预约逻辑
-	// 1. 验证请求数据
-	// 2. 检查时间冲突
-	// 3. 保存到数据库
-	// 4. 返回创建结果
-	c.JSON(http.StatusOK, gin.H{"message": "创建预约接口待实现"})
+	var req CreateAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var appointment *models.Appointment
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		appointment, err = bookTimeSlot(tx, currentUserID(c), req.TimeSlotID, req.Reason, time.Now())
+		return err
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "预约失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "预约成功，等待咨询师确认", "appointment": appointment})
+}
+
+// scopeAppointments 没有 appointment:read:any 权限时只能看到本人作为学生或咨询师参与的预约
+func scopeAppointments(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if config.HasPermission(currentUserRole(c), "appointment:read:any") {
+		return query
+	}
+	userID := currentUserID(c)
+	return query.Where("(user_id = ? OR counselor_id = ?)", userID, userID)
+}
+
+// redactAppointmentNotes 咨询记录备注只对咨询师和管理人员可见，学生查看自己的预约时隐去
+func redactAppointmentNotes(c *gin.Context, appointments ...*models.Appointment) {
+	if config.HasPermission(currentUserRole(c), "appointment:read:any") {
+		return
+	}
+	userID := currentUserID(c)
+	for _, appointment := range appointments {
+		if uint(appointment.CounselorID) != userID {
+			appointment.Notes = ""
+		}
+	}
 }
 
-// GetAppointmentList 获取预约列表
+// @Summary 预约列表
+// @Description 咨询记录备注（notes）仅对咨询师和管理人员返回，学生查看时为空
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "预约状态"
+// @Param counselor_id query int false "咨询师用户ID"
+// @Param user_id query int false "学生用户ID"
+// @Param from query string false "开始日期，格式2006-01-02"
+// @Param to query string false "结束日期（含），格式2006-01-02"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "预约列表"
+// @Router /appointments [get]
 func GetAppointmentList(c *gin.Context) {
-	// TODO: 实现获取预约列表逻辑
-	// 1. 处理分页参数
-	// 2. 处理筛选条件
-	// 3. 查询数据库
-	// 4. 返回预约列表
-	c.JSON(http.StatusOK, gin.H{"message": "获取预约列表接口待实现"})
+	query := scopeAppointments(c, config.DB.Model(&models.Appointment{}))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if counselorID, err := strconv.ParseUint(c.Query("counselor_id"), 10, 64); err == nil {
+		query = query.Where("counselor_id = ?", counselorID)
+	}
+	if userID, err := strconv.ParseUint(c.Query("user_id"), 10, 64); err == nil {
+		query = query.Where("user_id = ?", userID)
+	}
+	if from := c.Query("from"); from != "" {
+		date, err := parseDate(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始日期"})
+			return
+		}
+		query = query.Where("start_time >= ?", date)
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := parseDate(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+			return
+		}
+		query = query.Where("start_time < ?", date.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预约列表失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var appointments []models.Appointment
+	if err := query.Order("start_time DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预约列表失败"})
+		return
+	}
+	for i := range appointments {
+		redactAppointmentNotes(c, &appointments[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      appointments,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
 }
 
-// GetAppointmentByID 获取预约详情
+// findVisibleAppointment 按路径参数查询当前用户可见的预约
+func findVisibleAppointment(c *gin.Context) (*models.Appointment, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的预约ID"})
+		return nil, false
+	}
+	var appointment models.Appointment
+	if err := scopeAppointments(c, config.DB.Where("id = ?", id)).First(&appointment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "预约不存在"})
+		return nil, false
+	}
+	return &appointment, true
+}
+
+// @Summary 预约详情
+// @Description 咨询记录备注（notes）仅对咨询师和管理人员返回，学生查看时为空
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Success 200 {object} map[string]interface{} "预约信息"
+// @Failure 404 {object} map[string]interface{} "预约不存在"
+// @Router /appointments/{id} [get]
 func GetAppointmentByID(c *gin.Context) {
-	// TODO: 实现获取预约详情逻辑
-	// 1. 获取预约ID
-	// 2. 查询数据库
-	// 3. 返回预约信息
-	c.JSON(http.StatusOK, gin.H{"message": "获取预约详情接口待实现"})
+	appointment, ok := findVisibleAppointment(c)
+	if !ok {
+		return
+	}
+	redactAppointmentNotes(c, appointment)
+	c.JSON(http.StatusOK, gin.H{"appointment": appointment})
 }
 
-// UpdateAppointment 更新预约信息
+// @Summary 修改预约信息
+// @Description 学生可修改咨询原因，咨询师和管理人员可修改咨询记录备注；修改时间请使用改约接口
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Param data body UpdateAppointmentRequest true "预约信息"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 403 {object} map[string]interface{} "无权修改"
+// @Router /appointments/{id} [put]
 func UpdateAppointment(c *gin.Context) {
-	// TODO: 实现更新预约信息逻辑
-	// 1. 获取预约ID
-	// 2. 验证请求数据
-	// 3. 更新数据库
-	// 4. 返回更新结果
-	c.JSON(http.StatusOK, gin.H{"message": "更新预约接口待实现"})
+	var req UpdateAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	appointment, ok := findVisibleAppointment(c)
+	if !ok {
+		return
+	}
+
+	actors := appointmentActorRoles(c, appointment)
+	canEdit := func(allowed ...string) bool {
+		for _, a := range actors {
+			for _, b := range allowed {
+				if a == b {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	updates := map[string]interface{}{}
+	if req.Reason != nil {
+		if !canEdit(models.AppointmentActorStudent) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有预约的学生可以修改咨询原因"})
+			return
+		}
+		if appointment.Status != models.AppointmentStatusPending && appointment.Status != models.AppointmentStatusConfirmed {
+			c.JSON(http.StatusConflict, gin.H{"error": "当前状态不允许修改咨询原因"})
+			return
+		}
+		updates["reason"] = *req.Reason
+	}
+	if req.Notes != nil {
+		if !canEdit(models.AppointmentActorCounselor, models.AppointmentActorAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有咨询师可以修改咨询记录"})
+			return
+		}
+		updates["notes"] = *req.Notes
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有需要修改的内容"})
+		return
+	}
+
+	if err := config.DB.Model(appointment).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改预约失败"})
+		return
+	}
+
+	redactAppointmentNotes(c, appointment)
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功", "appointment": appointment})
 }
 
-// DeleteAppointment 删除预约
+// appointmentHistoryDeleted 预约被删除时写入变更记录的目标状态
+const appointmentHistoryDeleted = "deleted"
+
+// @Summary 删除预约
+// @Description 管理员删除误建或测试用的预约（软删除）：仍占用的时间段重新开放并顺延给候补学生，变更记录和审计日志保留删除操作；
+// @Description 已签到、已完成或爽约的预约属于咨询记录，不能删除
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Param reason query string false "删除原因"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 404 {object} map[string]interface{} "预约不存在"
+// @Failure 409 {object} map[string]interface{} "咨询记录不能删除"
+// @Router /appointments/{id} [delete]
 func DeleteAppointment(c *gin.Context) {
-	// TODO: 实现删除预约逻辑
-	// 1. 获取预约ID
-	// 2. 验证权限
-	// 3. 执行删除操作
-	// 4. 返回删除结果
-	c.JSON(http.StatusOK, gin.H{"message": "删除预约接口待实现"})
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的预约ID"})
+		return
+	}
+	reason := c.Query("reason")
+	if len([]rune(reason)) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "删除原因不能超过500个字符"})
+		return
+	}
+
+	userID := currentUserID(c)
+	var appointment models.Appointment
+	var released bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appointment, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &appointmentError{http.StatusNotFound, "预约不存在"}
+			}
+			return err
+		}
+		switch appointment.Status {
+		case models.AppointmentStatusCheckedIn, models.AppointmentStatusCompleted, models.AppointmentStatusNoShow:
+			return &appointmentError{http.StatusConflict, "咨询记录不能删除"}
+		}
+
+		// 仍占用时间段的预约删除后时间段重新开放
+		if appointment.TimeSlotID > 0 && (appointment.Status == models.AppointmentStatusPending ||
+			appointment.Status == models.AppointmentStatusConfirmed) {
+			result := tx.Model(&models.TimeSlot{}).
+				Where("id = ? AND status = ?", appointment.TimeSlotID, models.TimeSlotStatusBooked).
+				Update("status", models.TimeSlotStatusAvailable)
+			if result.Error != nil {
+				return result.Error
+			}
+			released = result.RowsAffected > 0
+		}
+		if err := recordAppointmentHistory(tx, appointment.ID, appointment.Status, appointmentHistoryDeleted,
+			&userID, models.AppointmentActorAdmin, reason); err != nil {
+			return err
+		}
+		return tx.Delete(&appointment).Error
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "删除预约失败")
+		return
+	}
+	if released {
+		promoteWaitlist(uint(appointment.TimeSlotID))
+	}
+	writeAudit(config.DB, c, &userID, auditAppointmentDeleted, "appointment", appointment.ID,
+		fmt.Sprintf("user_id=%d counselor_id=%d status=%s reason=%s",
+			appointment.UserID, appointment.CounselorID, appointment.Status, reason))
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
@@ -0,0 +1,512 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 预约规则在系统配置（configs 表）中的名称
+const (
+	policyLateCancelHours    = "appointment.late_cancel_hours"      // 开始前多少小时内取消视为临时取消
+	policyLateCancelAsNoShow = "appointment.late_cancel_as_no_show" // 临时取消是否计入爽约次数
+	policyNoShowGraceMinutes = "appointment.no_show_grace_minutes"  // 开始后多少分钟未签到自动标记为爽约
+	policyNoShowLimit        = "appointment.no_show_limit"          // 一学期内爽约多少次后限制预约，0 表示不限制
+	policyRestrictionDays    = "appointment.restriction_days"       // 限制预约的天数
+	policySemesterStarts     = "appointment.semester_starts"        // 每学期开始的月日，格式 MM-DD，逗号分隔
+)
+
+// defaultAppointmentPolicy 未配置时使用的预约规则
+var defaultAppointmentPolicy = map[string]string{
+	policyLateCancelHours:    "24",
+	policyLateCancelAsNoShow: "false",
+	policyNoShowGraceMinutes: "15",
+	policyNoShowLimit:        "3",
+	policyRestrictionDays:    "30",
+	policySemesterStarts:     "02-01,08-01",
+}
+
+// appointmentPolicy 预约取消与爽约规则
+type appointmentPolicy struct {
+	LateCancelWindow   time.Duration
+	LateCancelAsNoShow bool
+	NoShowGrace        time.Duration
+	NoShowLimit        int
+	RestrictionDays    int
+	SemesterStarts     []string
+}
+
+// UpdateAppointmentPolicyRequest 修改预约规则请求结构，只修改传入的字段
+type UpdateAppointmentPolicyRequest struct {
+	LateCancelHours    *int    `json:"late_cancel_hours" binding:"omitempty,min=0,max=720"`
+	LateCancelAsNoShow *bool   `json:"late_cancel_as_no_show"`
+	NoShowGraceMinutes *int    `json:"no_show_grace_minutes" binding:"omitempty,min=0,max=1440"`
+	NoShowLimit        *int    `json:"no_show_limit" binding:"omitempty,min=0,max=100"`
+	RestrictionDays    *int    `json:"restriction_days" binding:"omitempty,min=1,max=365"`
+	SemesterStarts     *string `json:"semester_starts"` // 格式 MM-DD，逗号分隔
+}
+
+// LiftRestrictionRequest 解除预约限制请求结构
+type LiftRestrictionRequest struct {
+	Note string `json:"note" binding:"max=200"`
+}
+
+// policyValues 读取预约规则的原始配置值，未配置的使用默认值
+func policyValues(tx *gorm.DB) (map[string]string, error) {
+	values := make(map[string]string, len(defaultAppointmentPolicy))
+	names := make([]string, 0, len(defaultAppointmentPolicy))
+	for name, def := range defaultAppointmentPolicy {
+		values[name] = def
+		names = append(names, name)
+	}
+
+	var configs []models.Config
+	if err := tx.Where("name IN ?", names).Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		values[cfg.Name] = cfg.Value
+	}
+	return values, nil
+}
+
+// parseSemesterStarts 解析 MM-DD 列表，格式错误时返回 nil
+func parseSemesterStarts(s string) []string {
+	var starts []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if _, err := time.Parse("01-02", part); err != nil {
+			return nil
+		}
+		starts = append(starts, part)
+	}
+	return starts
+}
+
+// loadAppointmentPolicy 读取预约规则，配置值非法时使用默认值
+func loadAppointmentPolicy(tx *gorm.DB) (*appointmentPolicy, error) {
+	values, err := policyValues(tx)
+	if err != nil {
+		return nil, err
+	}
+	intValue := func(name string) int {
+		n, err := strconv.Atoi(values[name])
+		if err != nil || n < 0 {
+			n, _ = strconv.Atoi(defaultAppointmentPolicy[name])
+		}
+		return n
+	}
+
+	policy := &appointmentPolicy{
+		LateCancelWindow:   time.Duration(intValue(policyLateCancelHours)) * time.Hour,
+		LateCancelAsNoShow: values[policyLateCancelAsNoShow] == "true",
+		NoShowGrace:        time.Duration(intValue(policyNoShowGraceMinutes)) * time.Minute,
+		NoShowLimit:        intValue(policyNoShowLimit),
+		RestrictionDays:    intValue(policyRestrictionDays),
+		SemesterStarts:     parseSemesterStarts(values[policySemesterStarts]),
+	}
+	if policy.SemesterStarts == nil {
+		policy.SemesterStarts = parseSemesterStarts(defaultAppointmentPolicy[policySemesterStarts])
+	}
+	return policy, nil
+}
+
+// semesterStart 当前学期的开始时间：不晚于 now 的最近一个学期开始日期
+func (p *appointmentPolicy) semesterStart(now time.Time) time.Time {
+	var latest time.Time
+	for _, year := range []int{now.Year() - 1, now.Year()} {
+		for _, md := range p.SemesterStarts {
+			t, err := time.ParseInLocation("2006-01-02", fmt.Sprintf("%d-%s", year, md), time.Local)
+			if err == nil && !t.After(now) && t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	return latest
+}
+
+// activeRestriction 查询学生当前生效的预约限制，没有时返回 nil
+func activeRestriction(tx *gorm.DB, userID uint, now time.Time) (*models.BookingRestriction, error) {
+	var restriction models.BookingRestriction
+	err := tx.Where("user_id = ? AND lifted_at IS NULL AND starts_at <= ? AND ends_at > ?", userID, now, now).
+		Order("ends_at DESC").First(&restriction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &restriction, nil
+}
+
+// checkBookingRestriction 学生处于预约限制期间时返回错误
+func checkBookingRestriction(tx *gorm.DB, userID uint, now time.Time) error {
+	restriction, err := activeRestriction(tx, userID, now)
+	if err != nil {
+		return err
+	}
+	if restriction != nil {
+		return &appointmentError{http.StatusForbidden,
+			fmt.Sprintf("您已被限制预约至 %s：%s", restriction.EndsAt.Format(appointmentTimeLayout), restriction.Reason)}
+	}
+	return nil
+}
+
+// semesterNoShows 统计学生本学期内计入限制的爽约次数；上一次限制开始之前的爽约不再重复计算
+func semesterNoShows(tx *gorm.DB, userID uint, policy *appointmentPolicy, now time.Time) (int64, error) {
+	since := policy.semesterStart(now)
+	var last models.BookingRestriction
+	if err := tx.Where("user_id = ? AND starts_at > ?", userID, since).Order("starts_at DESC").
+		First(&last).Error; err == nil {
+		since = last.StartsAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	query := tx.Model(&models.Appointment{}).Where("user_id = ? AND start_time >= ?", userID, since)
+	if policy.LateCancelAsNoShow {
+		query = query.Where("(status = ? OR late_cancelled = ?)", models.AppointmentStatusNoShow, true)
+	} else {
+		query = query.Where("status = ?", models.AppointmentStatusNoShow)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// applyAttendancePolicy 预约状态变更后执行取消与爽约规则：
+// 记录临时取消和爽约次数，学期内次数达到上限时限制预约。返回新生成的限制，没有时为 nil
+func applyAttendancePolicy(tx *gorm.DB, appointment *models.Appointment, to, actor string, now time.Time) (*models.BookingRestriction, error) {
+	if to != models.AppointmentStatusNoShow && to != models.AppointmentStatusCancelledByStudent {
+		return nil, nil
+	}
+	policy, err := loadAppointmentPolicy(tx)
+	if err != nil {
+		return nil, err
+	}
+	userID := uint(appointment.UserID)
+
+	switch to {
+	case models.AppointmentStatusNoShow:
+		if err := tx.Model(&models.Student{}).Where("user_id = ?", userID).
+			UpdateColumn("no_show_count", gorm.Expr("no_show_count + 1")).Error; err != nil {
+			return nil, err
+		}
+	case models.AppointmentStatusCancelledByStudent:
+		// 系统代为取消（如毕业归档）不计入
+		if actor != models.AppointmentActorStudent || appointment.StartTime.Sub(now) >= policy.LateCancelWindow {
+			return nil, nil
+		}
+		if err := tx.Model(appointment).UpdateColumn("late_cancelled", true).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Student{}).Where("user_id = ?", userID).
+			UpdateColumn("late_cancel_count", gorm.Expr("late_cancel_count + 1")).Error; err != nil {
+			return nil, err
+		}
+		if !policy.LateCancelAsNoShow {
+			return nil, nil
+		}
+	}
+
+	if policy.NoShowLimit == 0 {
+		return nil, nil
+	}
+	if existing, err := activeRestriction(tx, userID, now); err != nil || existing != nil {
+		return nil, err
+	}
+	count, err := semesterNoShows(tx, userID, policy, now)
+	if err != nil {
+		return nil, err
+	}
+	if count < int64(policy.NoShowLimit) {
+		return nil, nil
+	}
+
+	restriction := models.BookingRestriction{
+		UserID:   userID,
+		Reason:   fmt.Sprintf("本学期爽约 %d 次", count),
+		StartsAt: now,
+		EndsAt:   now.AddDate(0, 0, policy.RestrictionDays),
+	}
+	if err := tx.Create(&restriction).Error; err != nil {
+		return nil, err
+	}
+	return &restriction, nil
+}
+
+// notifyRestriction 通知学生已被限制预约
+func notifyRestriction(restriction *models.BookingRestriction) {
+	var student models.User
+	if err := config.DB.First(&student, restriction.UserID).Error; err != nil {
+		return
+	}
+	notifyUser(&student, "预约限制通知", fmt.Sprintf(
+		"由于%s，您的咨询预约权限已暂停至 %s。如有疑问请联系心理健康中心。",
+		restriction.Reason, restriction.EndsAt.Format(appointmentTimeLayout)))
+}
+
+// MarkNoShows 定时任务：已确认的预约开始后超过宽限时间仍未签到的，自动标记为爽约
+func MarkNoShows() {
+	policy, err := loadAppointmentPolicy(config.DB)
+	if err != nil {
+		log.Printf("自动标记爽约失败: %v", err)
+		return
+	}
+	now := time.Now()
+
+	var ids []uint
+	if err := config.DB.Model(&models.Appointment{}).
+		Where("status = ? AND start_time <= ?", models.AppointmentStatusConfirmed, now.Add(-policy.NoShowGrace)).
+		Order("id").Pluck("id", &ids).Error; err != nil {
+		log.Printf("自动标记爽约失败: %v", err)
+		return
+	}
+
+	marked := 0
+	for _, id := range ids {
+		var restriction *models.BookingRestriction
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var appointment models.Appointment
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ?", id, models.AppointmentStatusConfirmed).First(&appointment).Error; err != nil {
+				return err
+			}
+			if err := transitionAppointment(tx, &appointment, models.AppointmentStatusNoShow,
+				nil, models.AppointmentActorSystem, "咨询师未签到，系统自动标记", now); err != nil {
+				return err
+			}
+			var err error
+			restriction, err = applyAttendancePolicy(tx, &appointment, models.AppointmentStatusNoShow,
+				models.AppointmentActorSystem, now)
+			return err
+		})
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("自动标记爽约失败: appointment_id=%d err=%v", id, err)
+			}
+			continue
+		}
+		marked++
+		if restriction != nil {
+			notifyRestriction(restriction)
+		}
+	}
+	if marked > 0 {
+		log.Printf("自动标记爽约完成，共 %d 个预约", marked)
+	}
+}
+
+// @Summary 查看预约规则
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "预约规则"
+// @Router /appointment-policy [get]
+func GetAppointmentPolicy(c *gin.Context) {
+	policy, err := loadAppointmentPolicy(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预约规则失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"late_cancel_hours":      int(policy.LateCancelWindow / time.Hour),
+		"late_cancel_as_no_show": policy.LateCancelAsNoShow,
+		"no_show_grace_minutes":  int(policy.NoShowGrace / time.Minute),
+		"no_show_limit":          policy.NoShowLimit,
+		"restriction_days":       policy.RestrictionDays,
+		"semester_starts":        strings.Join(policy.SemesterStarts, ","),
+		"current_semester_start": policy.semesterStart(time.Now()).Format("2006-01-02"),
+	})
+}
+
+// @Summary 修改预约规则
+// @Description 规则保存在系统配置中，修改后立即生效
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body UpdateAppointmentPolicyRequest true "预约规则"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Router /appointment-policy [put]
+func UpdateAppointmentPolicy(c *gin.Context) {
+	var req UpdateAppointmentPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	values := map[string]string{}
+	if req.LateCancelHours != nil {
+		values[policyLateCancelHours] = strconv.Itoa(*req.LateCancelHours)
+	}
+	if req.LateCancelAsNoShow != nil {
+		values[policyLateCancelAsNoShow] = strconv.FormatBool(*req.LateCancelAsNoShow)
+	}
+	if req.NoShowGraceMinutes != nil {
+		values[policyNoShowGraceMinutes] = strconv.Itoa(*req.NoShowGraceMinutes)
+	}
+	if req.NoShowLimit != nil {
+		values[policyNoShowLimit] = strconv.Itoa(*req.NoShowLimit)
+	}
+	if req.RestrictionDays != nil {
+		values[policyRestrictionDays] = strconv.Itoa(*req.RestrictionDays)
+	}
+	if req.SemesterStarts != nil {
+		starts := parseSemesterStarts(*req.SemesterStarts)
+		if starts == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "学期开始日期格式应为 MM-DD，多个用逗号分隔"})
+			return
+		}
+		values[policySemesterStarts] = strings.Join(starts, ",")
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for name, value := range values {
+			var cfg models.Config
+			if err := tx.Where(models.Config{Name: name}).Assign(models.Config{Value: value}).
+				FirstOrCreate(&cfg).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改预约规则失败"})
+		return
+	}
+
+	GetAppointmentPolicy(c)
+}
+
+// bookingStatus 学生的爽约统计和预约限制
+func bookingStatus(userID uint) (gin.H, error) {
+	now := time.Now()
+	policy, err := loadAppointmentPolicy(config.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var student models.Student
+	if err := config.DB.Unscoped().Where("user_id = ?", userID).First(&student).Error; err != nil &&
+		!errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var semesterCount int64
+	if err := config.DB.Model(&models.Appointment{}).
+		Where("user_id = ? AND status = ? AND start_time >= ?", userID, models.AppointmentStatusNoShow, policy.semesterStart(now)).
+		Count(&semesterCount).Error; err != nil {
+		return nil, err
+	}
+	active, err := activeRestriction(config.DB, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	var restrictions []models.BookingRestriction
+	if err := config.DB.Where("user_id = ?", userID).Order("starts_at DESC").Limit(20).
+		Find(&restrictions).Error; err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"no_show_count":          student.NoShowCount,
+		"late_cancel_count":      student.LateCancelCount,
+		"semester_no_show_count": semesterCount,
+		"no_show_limit":          policy.NoShowLimit,
+		"active_restriction":     active,
+		"restrictions":           restrictions,
+	}, nil
+}
+
+// @Summary 本人的预约限制
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "爽约统计和预约限制"
+// @Router /users/me/booking-status [get]
+func GetMyBookingStatus(c *gin.Context) {
+	status, err := bookingStatus(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预约限制失败"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary 学生的预约限制
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "爽约统计和预约限制"
+// @Router /users/{id}/booking-status [get]
+func GetUserBookingStatus(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	status, err := bookingStatus(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预约限制失败"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary 解除预约限制
+// @Description 管理人员提前解除学生的预约限制，已计入本次限制的爽约不再重复计入下一次限制
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "限制ID"
+// @Param data body LiftRestrictionRequest false "解除说明"
+// @Success 200 {object} map[string]interface{} "已解除"
+// @Failure 409 {object} map[string]interface{} "限制已结束"
+// @Router /booking-restrictions/{id}/lift [post]
+func LiftBookingRestriction(c *gin.Context) {
+	var req LiftRestrictionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的限制ID"})
+		return
+	}
+
+	adminID := currentUserID(c)
+	now := time.Now()
+	result := config.DB.Model(&models.BookingRestriction{}).
+		Where("id = ? AND lifted_at IS NULL AND ends_at > ?", id, now).
+		Updates(map[string]interface{}{
+			"lifted_by": adminID,
+			"lifted_at": &now,
+			"lift_note": req.Note,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除限制失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "限制不存在或已结束"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除预约限制"})
+}
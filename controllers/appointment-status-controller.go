@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChangeAppointmentStatusRequest 变更预约状态请求结构
+type ChangeAppointmentStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// recordAppointmentHistory 写入预约状态变更记录
+func recordAppointmentHistory(tx *gorm.DB, appointmentID uint, from, to string, actorID *uint, actorRole, reason string) error {
+	return tx.Create(&models.AppointmentStatusHistory{
+		AppointmentID: appointmentID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ActorID:       actorID,
+		ActorRole:     actorRole,
+		Reason:        reason,
+	}).Error
+}
+
+// transitionAppointment 按状态机变更预约状态：校验变更是否合法、操作方是否有权触发、是否填写原因，
+// 需要时释放时间段，并写入变更记录。appointment 应已在事务中加锁，成功后其状态被更新
+func transitionAppointment(tx *gorm.DB, appointment *models.Appointment, to string, actorID *uint, actorRole, reason string, now time.Time) error {
+	transition := models.FindAppointmentTransition(appointment.Status, to)
+	if transition == nil {
+		return &appointmentError{http.StatusConflict, "当前状态不允许该操作"}
+	}
+	if !transition.AllowsActor(actorRole) {
+		return &appointmentError{http.StatusForbidden, "无权执行该操作"}
+	}
+	reason = strings.TrimSpace(reason)
+	if transition.ReasonRequired && reason == "" {
+		return &appointmentError{http.StatusBadRequest, "请填写原因"}
+	}
+	if to == models.AppointmentStatusNoShow && now.Before(appointment.StartTime) {
+		return &appointmentError{http.StatusConflict, "预约尚未开始，不能标记为爽约"}
+	}
+
+	// 以原状态为条件更新，防止并发变更
+	result := tx.Model(&models.Appointment{}).
+		Where("id = ? AND status = ?", appointment.ID, appointment.Status).
+		Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &appointmentError{http.StatusConflict, "预约状态已变化，请刷新后重试"}
+	}
+	if transition.ReleasesSlot && appointment.TimeSlotID > 0 {
+		if err := tx.Model(&models.TimeSlot{}).
+			Where("id = ? AND status = ?", appointment.TimeSlotID, models.TimeSlotStatusBooked).
+			Update("status", models.TimeSlotStatusAvailable).Error; err != nil {
+			return err
+		}
+	}
+	if err := recordAppointmentHistory(tx, appointment.ID, appointment.Status, to, actorID, actorRole, reason); err != nil {
+		return err
+	}
+
+	appointment.Status = to
+	return nil
+}
+
+// appointmentActorRoles 当前用户对该预约可以使用的操作方身份
+func appointmentActorRoles(c *gin.Context, appointment *models.Appointment) []string {
+	userID := currentUserID(c)
+	role := currentUserRole(c)
+
+	var actors []string
+	if uint(appointment.UserID) == userID {
+		actors = append(actors, models.AppointmentActorStudent)
+	}
+	if uint(appointment.CounselorID) == userID && config.HasPermission(role, "appointment:manage:own") {
+		actors = append(actors, models.AppointmentActorCounselor)
+	}
+	if config.HasPermission(role, "appointment:manage:any") {
+		actors = append(actors, models.AppointmentActorAdmin)
+	}
+	return actors
+}
+
+// pickAppointmentActor 从当前用户的身份中选出可以触发该变更的一个，优先使用与预约直接相关的身份
+func pickAppointmentActor(actors []string, transition *models.AppointmentTransition) (string, bool) {
+	for _, actor := range actors {
+		if transition.AllowsActor(actor) {
+			return actor, true
+		}
+	}
+	return "", false
+}
+
+// @Summary 变更预约状态
+// @Description 状态机：pending → confirmed → checked_in → completed；
+// @Description 学生可取消（cancelled_by_student），咨询师可拒绝待确认的预约（rejected）、取消已确认的预约（cancelled_by_counselor）、标记爽约（no_show）；
+// @Description 取消和拒绝必须填写原因，取消或拒绝后时间段重新开放；临时取消和爽约按预约规则计数，次数过多将被限制预约
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Param data body ChangeAppointmentStatusRequest true "新状态和原因"
+// @Success 200 {object} map[string]interface{} "变更成功"
+// @Failure 403 {object} map[string]interface{} "无权执行该操作"
+// @Failure 409 {object} map[string]interface{} "当前状态不允许该操作"
+// @Router /appointments/{id}/status [post]
+func ChangeAppointmentStatus(c *gin.Context) {
+	var req ChangeAppointmentStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的预约ID"})
+		return
+	}
+
+	userID := currentUserID(c)
+	var appointment models.Appointment
+	var released bool
+	var restriction *models.BookingRestriction
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appointment, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &appointmentError{http.StatusNotFound, "预约不存在"}
+			}
+			return err
+		}
+
+		actors := appointmentActorRoles(c, &appointment)
+		if len(actors) == 0 {
+			return &appointmentError{http.StatusNotFound, "预约不存在"}
+		}
+		transition := models.FindAppointmentTransition(appointment.Status, req.Status)
+		if transition == nil {
+			return &appointmentError{http.StatusConflict, "当前状态不允许该操作"}
+		}
+		actor, ok := pickAppointmentActor(actors, transition)
+		if !ok {
+			return &appointmentError{http.StatusForbidden, "无权执行该操作"}
+		}
+		released = transition.ReleasesSlot
+		now := time.Now()
+		if err := transitionAppointment(tx, &appointment, req.Status, &userID, actor, req.Reason, now); err != nil {
+			return err
+		}
+		var err error
+		restriction, err = applyAttendancePolicy(tx, &appointment, req.Status, actor, now)
+		return err
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "变更预约状态失败")
+		return
+	}
+	// 时间段空出后顺延给候补学生
+	if released && appointment.TimeSlotID > 0 {
+		promoteWaitlist(uint(appointment.TimeSlotID))
+	}
+	if restriction != nil {
+		notifyRestriction(restriction)
+	}
+
+	redactAppointmentNotes(c, &appointment)
+	c.JSON(http.StatusOK, gin.H{"message": "预约状态已更新", "appointment": appointment})
+}
+
+// @Summary 预约状态变更记录
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Success 200 {object} map[string]interface{} "变更记录，按时间先后排列"
+// @Failure 404 {object} map[string]interface{} "预约不存在"
+// @Router /appointments/{id}/history [get]
+func GetAppointmentHistory(c *gin.Context) {
+	appointment, ok := findVisibleAppointment(c)
+	if !ok {
+		return
+	}
+
+	var history []models.AppointmentStatusHistory
+	if err := config.DB.Where("appointment_id = ?", appointment.ID).Order("created_at, id").
+		Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取变更记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
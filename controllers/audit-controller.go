@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 审计操作
+const (
+	auditDataExportRequested  = "data_export.requested"
+	auditDataExportCompleted  = "data_export.completed"
+	auditDataExportFailed     = "data_export.failed"
+	auditDataExportDownloaded = "data_export.downloaded"
+	auditErasureRequested     = "erasure.requested"
+	auditErasureRejected      = "erasure.rejected"
+	auditErasureCompleted     = "erasure.completed"
+	auditErasureFailed        = "erasure.failed"
+	auditAppointmentDeleted   = "appointment.deleted"
+)
+
+// writeAudit 写入审计日志，c 为空表示系统任务；写入失败只记录日志，不影响业务
+func writeAudit(tx *gorm.DB, c *gin.Context, actorID *uint, action, targetType string, targetID uint, detail string) {
+	entry := models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     detail,
+	}
+	if c != nil {
+		entry.ClientIP = c.ClientIP()
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		log.Printf("写入审计日志失败: action=%s target=%s/%d err=%v", action, targetType, targetID, err)
+	}
+}
+
+// @Summary 查询审计日志
+// @Tags 审计
+// @Produce json
+// @Security ApiKeyAuth
+// @Param action query string false "操作"
+// @Param actor_id query int false "操作人用户ID"
+// @Param target_type query string false "操作对象类型"
+// @Param target_id query int false "操作对象ID"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "审计日志列表"
+// @Router /audit-logs [get]
+func GetAuditLogs(c *gin.Context) {
+	query := config.DB.Model(&models.AuditLog{})
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if actorID, err := strconv.ParseUint(c.Query("actor_id"), 10, 64); err == nil {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID, err := strconv.ParseUint(c.Query("target_id"), 10, 64); err == nil {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var logs []models.AuditLog
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      logs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
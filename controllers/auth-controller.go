@@ -4,7 +4,6 @@ import (
 	"ental-health-system/config"
 	"ental-health-system/models"
 	"ental-health-system/utils"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -19,7 +18,7 @@ type LoginRequest struct {
 // RegisterRequest 注册请求结构
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
-	Password string `json:"password" binding:"required,min=6,max=50"`
+	Password string `json:"password" binding:"required"`
 	Name     string `json:"name"` // 可选
 	Role     string `json:"role"` // 可选，默认为student
 }
@@ -30,8 +29,8 @@ type RegisterRequest struct {
 // @Accept json
 // @Produce json
 // @Param data body RegisterRequest true "注册信息"
-// @Success 200 {object} map[string]interface{} "注册成功返回用户信息和token"
-// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Success 200 {object} map[string]interface{} "注册成功返回用户信息和token；角色要求二次验证时返回挑战令牌"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或密码不符合安全策略"
 // @Failure 409 {object} map[string]interface{} "用户名已存在"
 // @Failure 500 {object} map[string]interface{} "服务器内部错误"
 // @Router /register [post]
@@ -40,11 +39,17 @@ func Register(c *gin.Context) {
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "无效的请求参数",
-			"details": "用户名长度需在3-50之间，密码长度需在6-50之间",
+			"details": "用户名长度需在3-50之间",
 		})
 		return
 	}
 
+	// 校验密码策略
+	if violations := utils.CurrentPasswordPolicy().Validate(req.Password, req.Username); len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+		return
+	}
+
 	// 检查用户名是否已存在
 	var existingUser models.User
 	if result := config.DB.Where("username = ?", req.Username).First(&existingUser); result.Error == nil {
@@ -64,12 +69,14 @@ func Register(c *gin.Context) {
 	}
 
 	// 创建新用户
+	now := time.Now()
 	user := models.User{
-		Username: req.Username,
-		Password: req.Password, // 密码会在 BeforeSave 钩子中自动加密
-		Name:     req.Name,
-		Role:     req.Role,
-		Status:   "active",
+		Username:          req.Username,
+		Password:          req.Password, // 密码会在 BeforeSave 钩子中自动加密
+		Name:              req.Name,
+		Role:              req.Role,
+		Status:            "active",
+		PasswordChangedAt: &now,
 	}
 
 	// 保存用户
@@ -77,6 +84,11 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
 		return
 	}
+	if err := recordPasswordHistory(config.DB, user.ID, user.Password); err != nil {
+		config.DB.Delete(&user)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+		return
+	}
 
 	// 如果是学生，创建对应的学生记录
 	if req.Role == "student" {
@@ -105,24 +117,38 @@ func Register(c *gin.Context) {
 		}
 	}
 
-	// 生成Token
-	token, err := utils.GenerateToken(user.ID, user.Role)
+	userInfo := gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"name":     user.Name,
+		"role":     user.Role,
+	}
+
+	// 角色要求二次验证时与登录相同，先返回挑战令牌，绑定并验证通过后才签发令牌
+	challenge, err := twoFactorChallenge(config.DB, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+	if challenge != nil {
+		challenge["message"] = "注册成功"
+		challenge["user"] = userInfo
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	// 签发访问令牌和刷新令牌
+	pair, err := issueTokenPair(config.DB, c, &user, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
 
 	// 返回用户信息和token
-	c.JSON(http.StatusOK, gin.H{
-		"message": "注册成功",
-		"token":   token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"name":     user.Name,
-			"role":     user.Role,
-		},
-	})
+	resp := pair.response()
+	resp["message"] = "注册成功"
+	resp["user"] = userInfo
+	c.JSON(http.StatusOK, resp)
 }
 
 // @Summary 用户登录
@@ -131,10 +157,12 @@ func Register(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param data body LoginRequest true "登录信息"
-// @Success 200 {object} map[string]interface{} "登录成功返回用户信息和token"
+// @Success 200 {object} map[string]interface{} "登录成功返回用户信息、访问令牌和刷新令牌；需要二次验证时返回挑战令牌"
 // @Failure 400 {object} map[string]interface{} "请求参数错误"
 // @Failure 401 {object} map[string]interface{} "用户名或密码错误"
-// @Failure 403 {object} map[string]interface{} "账户已被禁用"
+// @Failure 403 {object} map[string]interface{} "账户已被禁用或密码已过期"
+// @Failure 423 {object} map[string]interface{} "登录失败次数过多，账户已被临时锁定"
+// @Failure 429 {object} map[string]interface{} "登录尝试过于频繁"
 // @Router /login [post]
 func Login(c *gin.Context) {
 	var req LoginRequest
@@ -142,61 +170,87 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
 		return
 	}
-	fmt.Printf("hello, %s\n", req)
 	// 查找用户
 	var user models.User
 	result := config.DB.Where("username = ?", req.Username).First(&user)
 	if result.Error != nil {
+		recordLoginAttempt(c, nil, req.Username, false, loginAttemptReasonUnknown)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 		return
 	}
 
+	// 账户被锁定或处于渐进延迟期间时不校验密码
+	if reason, wait := loginBlocked(&user, time.Now()); reason != "" {
+		recordLoginAttempt(c, &user.ID, req.Username, false, reason)
+		respondLoginBlocked(c, reason, wait)
+		return
+	}
+
 	// 验证密码
 	if !user.ValidatePassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		recordLoginAttempt(c, &user.ID, req.Username, false, loginAttemptReasonPassword)
+		respondLoginFailure(c, user.ID, "用户名或密码错误")
 		return
 	}
 
 	// 检查用户状态
 	if user.Status != "active" {
+		recordLoginAttempt(c, &user.ID, req.Username, false, loginAttemptReasonInactive)
+		if user.Status == "archived" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "账户已毕业归档，如需继续使用请联系管理员"})
+			return
+		}
 		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
 		return
 	}
 
-	// 生成Token
-	token, err := utils.GenerateToken(user.ID, user.Role)
+	// 启用或被强制要求二次验证的账户先返回挑战令牌，二次验证通过后才记为登录成功并清除失败计数
+	challenge, err := twoFactorChallenge(config.DB, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
 
-	// 获取过期时间（24小时后）
-	expiresAt := time.Now().Add(24 * time.Hour)
+	recordLoginAttempt(c, &user.ID, req.Username, true, "")
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		clearLoginFailures(config.DB, user.ID)
+	}
 
-	// 存储token到数据库
-	tokenRecord := models.Token{
-		UserID:    user.ID,
-		Token:     token,
-		Type:      "access",
-		ExpiresAt: expiresAt,
-		UserAgent: c.Request.UserAgent(),
-		ClientIP:  c.ClientIP(),
+	// 员工账户密码过期时需先修改密码
+	expired, err := passwordExpiredResponse(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+	if expired != nil {
+		c.JSON(http.StatusForbidden, expired)
+		return
 	}
 
-	if err := config.DB.Create(&tokenRecord).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存token失败"})
+	// 签发访问令牌和刷新令牌
+	pair, err := issueTokenPair(config.DB, c, &user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
 
 	// 返回用户信息和token
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"name":     user.Name,
-			"role":     user.Role,
-			"email":    user.Email,
-		},
-	})
+	resp := pair.response()
+	resp["user"] = loginUserInfo(&user)
+	c.JSON(http.StatusOK, resp)
+}
+
+// loginUserInfo 登录成功时返回的用户信息
+func loginUserInfo(user *models.User) gin.H {
+	return gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"name":     user.Name,
+		"role":     user.Role,
+		"email":    user.Email,
+	}
 }
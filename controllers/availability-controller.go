@@ -0,0 +1,654 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultAvailabilityWindowDays 按模板生成时间段的默认滚动窗口（天），可通过 AVAILABILITY_WINDOW_DAYS 配置
+const defaultAvailabilityWindowDays = 28
+
+// AvailabilityTemplateRequest 创建/修改可预约时间模板请求结构
+type AvailabilityTemplateRequest struct {
+	CounselorID    uint   `json:"counselor_id"`                                             // 咨询师用户ID，仅管理人员可指定，默认当前用户
+	Weekdays       []int  `json:"weekdays" binding:"required,min=1,max=7,dive,min=1,max=7"` // 1-7 表示周一至周日
+	StartTime      string `json:"start_time" binding:"required"`                            // 格式 15:04
+	EndTime        string `json:"end_time" binding:"required"`                              // 格式 15:04
+	SessionMinutes int    `json:"session_minutes" binding:"required,min=10,max=240"`
+	BreakMinutes   int    `json:"break_minutes" binding:"min=0,max=120"`
+	ValidFrom      string `json:"valid_from"`  // 格式 2006-01-02，默认今天
+	ValidUntil     string `json:"valid_until"` // 格式 2006-01-02，为空表示长期有效
+	Active         *bool  `json:"active"`      // 默认启用
+	Remark         string `json:"remark" binding:"max=200"`
+}
+
+// AvailabilityExceptionRequest 添加例外日期请求结构
+type AvailabilityExceptionRequest struct {
+	CounselorID uint   `json:"counselor_id"`            // 咨询师用户ID，仅管理人员可指定，默认当前用户
+	TemplateID  *uint  `json:"template_id"`             // 为空表示对所有模板生效
+	Date        string `json:"date" binding:"required"` // 格式 2006-01-02
+	Reason      string `json:"reason" binding:"max=200"`
+}
+
+// slotSpec 按模板计算出的一个时间段
+type slotSpec struct {
+	templateID uint
+	start, end time.Time
+}
+
+// parseClock 解析 15:04 格式的时间，返回距零点的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// formatWeekdays 将星期列表去重排序后转换为逗号分隔的字符串
+func formatWeekdays(days []int) string {
+	set := map[int]bool{}
+	for _, d := range days {
+		set[d] = true
+	}
+	sorted := make([]int, 0, len(set))
+	for d := range set {
+		sorted = append(sorted, d)
+	}
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, d := range sorted {
+		parts[i] = strconv.Itoa(d)
+	}
+	return strings.Join(parts, ",")
+}
+
+// weekdaySet 解析模板中的星期，7 表示周日
+func weekdaySet(s string) map[time.Weekday]bool {
+	set := map[time.Weekday]bool{}
+	for _, part := range strings.Split(s, ",") {
+		if d, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && d >= 1 && d <= 7 {
+			set[time.Weekday(d%7)] = true
+		}
+	}
+	return set
+}
+
+// dateKey 日期的字符串表示，用于比较数据库中的日期字段与本地日期
+func dateKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// templateSlots 计算模板在某一天（本地时间零点）生成的时间段
+func templateSlots(t *models.AvailabilityTemplate, day time.Time) []slotSpec {
+	key := dateKey(day)
+	if key < dateKey(t.ValidFrom) || (t.ValidUntil != nil && key > dateKey(*t.ValidUntil)) {
+		return nil
+	}
+	if !weekdaySet(t.Weekdays)[day.Weekday()] {
+		return nil
+	}
+	startMin, err1 := parseClock(t.StartTime)
+	endMin, err2 := parseClock(t.EndTime)
+	if err1 != nil || err2 != nil || t.SessionMinutes <= 0 {
+		return nil
+	}
+
+	var slots []slotSpec
+	for m := startMin; m+t.SessionMinutes <= endMin; m += t.SessionMinutes + t.BreakMinutes {
+		start := time.Date(day.Year(), day.Month(), day.Day(), m/60, m%60, 0, 0, time.Local)
+		slots = append(slots, slotSpec{
+			templateID: t.ID,
+			start:      start,
+			end:        start.Add(time.Duration(t.SessionMinutes) * time.Minute),
+		})
+	}
+	return slots
+}
+
+// desiredTimeSlots 计算咨询师在 [now, now+窗口) 内按模板应存在的时间段，例外日期和停诊期间除外
+func desiredTimeSlots(tx *gorm.DB, counselorID uint, now time.Time) ([]slotSpec, error) {
+	var templates []models.AvailabilityTemplate
+	if err := tx.Where("counselor_id = ? AND active = ?", counselorID, true).Order("id").
+		Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	windowDays := utils.IntFromEnv("AVAILABILITY_WINDOW_DAYS", defaultAvailabilityWindowDays)
+	windowEnd := today.AddDate(0, 0, windowDays)
+
+	var exceptions []models.AvailabilityException
+	if err := tx.Where("counselor_id = ? AND date >= ? AND date < ?", counselorID, dateKey(today), dateKey(windowEnd)).
+		Find(&exceptions).Error; err != nil {
+		return nil, err
+	}
+	skipped := map[string]bool{} // "日期" 表示整天例外，"日期#模板ID" 表示单个模板例外
+	for _, e := range exceptions {
+		if e.TemplateID == nil {
+			skipped[dateKey(e.Date)] = true
+		} else {
+			skipped[fmt.Sprintf("%s#%d", dateKey(e.Date), *e.TemplateID)] = true
+		}
+	}
+
+	blackouts, err := applicableBlackouts(tx, counselorID, today, windowEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots []slotSpec
+	for day := today; day.Before(windowEnd); day = day.AddDate(0, 0, 1) {
+		key := dateKey(day)
+		if skipped[key] {
+			continue
+		}
+		for i := range templates {
+			if skipped[fmt.Sprintf("%s#%d", key, templates[i].ID)] {
+				continue
+			}
+			for _, s := range templateSlots(&templates[i], day) {
+				if s.start.After(now) && !overlapsBlackout(blackouts, s.start, s.end) {
+					slots = append(slots, s)
+				}
+			}
+		}
+	}
+	return slots, nil
+}
+
+// generateCounselorSlots 按模板同步咨询师未来的时间段：
+// 删除不再符合模板的可预约时间段，补充缺少的时间段；已被预约和手动创建的时间段不受影响，
+// 与已有时间段重叠的模板时间段不会生成。返回新建和删除的数量
+func generateCounselorSlots(tx *gorm.DB, counselorID uint, now time.Time) (int, int, error) {
+	// 锁定咨询师行，串行化同一咨询师的生成任务
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		First(&models.User{}, counselorID).Error; err != nil {
+		return 0, 0, err
+	}
+
+	desired, err := desiredTimeSlots(tx, counselorID, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	wanted := map[string]bool{}
+	for _, s := range desired {
+		wanted[fmt.Sprintf("%d#%d#%d", s.templateID, s.start.Unix(), s.end.Unix())] = true
+	}
+
+	var existing []models.TimeSlot
+	if err := tx.Where("counselor_id = ? AND start_time > ?", counselorID, now).
+		Find(&existing).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var staleIDs []uint
+	kept := existing[:0]
+	for _, slot := range existing {
+		if slot.TemplateID != nil && slot.Status == models.TimeSlotStatusAvailable &&
+			!wanted[fmt.Sprintf("%d#%d#%d", *slot.TemplateID, slot.StartTime.Unix(), slot.EndTime.Unix())] {
+			staleIDs = append(staleIDs, slot.ID)
+			continue
+		}
+		kept = append(kept, slot)
+	}
+
+	removed := 0
+	if len(staleIDs) > 0 {
+		// 以状态为条件删除，避免删除刚被预约的时间段
+		result := tx.Where("id IN ? AND status = ?", staleIDs, models.TimeSlotStatusAvailable).Delete(&models.TimeSlot{})
+		if result.Error != nil {
+			return 0, 0, result.Error
+		}
+		removed = int(result.RowsAffected)
+	}
+
+	var created []models.TimeSlot
+	for _, s := range desired {
+		overlapping := false
+		for _, slot := range kept {
+			if s.start.Before(slot.EndTime) && s.end.After(slot.StartTime) {
+				overlapping = true
+				break
+			}
+		}
+		if overlapping {
+			continue
+		}
+		templateID := s.templateID
+		slot := models.TimeSlot{
+			CounselorID: int(counselorID),
+			StartTime:   s.start,
+			EndTime:     s.end,
+			Status:      models.TimeSlotStatusAvailable,
+			TemplateID:  &templateID,
+		}
+		created = append(created, slot)
+		kept = append(kept, slot)
+	}
+	if len(created) > 0 {
+		if err := tx.CreateInBatches(&created, 200).Error; err != nil {
+			return 0, 0, err
+		}
+	}
+	return len(created), removed, nil
+}
+
+// syncCounselorSlots 在独立事务中同步咨询师的时间段
+func syncCounselorSlots(counselorID uint) (created, removed int, err error) {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, removed, err = generateCounselorSlots(tx, counselorID, time.Now())
+		return err
+	})
+	return created, removed, err
+}
+
+// GenerateAllTimeSlots 为所有有启用模板的咨询师同步时间段，每个咨询师在独立的事务中处理
+func GenerateAllTimeSlots() {
+	var counselorIDs []uint
+	if err := config.DB.Model(&models.AvailabilityTemplate{}).Where("active = ?", true).
+		Distinct().Pluck("counselor_id", &counselorIDs).Error; err != nil {
+		log.Printf("生成咨询时间段失败: %v", err)
+		return
+	}
+
+	total := 0
+	for _, id := range counselorIDs {
+		created, _, err := syncCounselorSlots(id)
+		if err != nil {
+			log.Printf("生成咨询时间段失败: counselor_id=%d err=%v", id, err)
+			continue
+		}
+		total += created
+	}
+	if total > 0 {
+		log.Printf("生成咨询时间段完成，新增 %d 个", total)
+	}
+}
+
+// targetCounselorID 确定操作的咨询师：管理人员可通过 counselorID 指定，否则为当前用户
+func targetCounselorID(c *gin.Context, counselorID uint) (uint, bool) {
+	userID := currentUserID(c)
+	if counselorID == 0 || counselorID == userID {
+		if !config.HasPermission(currentUserRole(c), "timeslot:manage:own") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请指定咨询师"})
+			return 0, false
+		}
+		counselorID = userID
+	} else if !config.HasPermission(currentUserRole(c), "timeslot:manage:any") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理其他咨询师的时间"})
+		return 0, false
+	}
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("id = ? AND role = ?", counselorID, "counselor").Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "咨询师不存在"})
+		return 0, false
+	}
+	return counselorID, true
+}
+
+// canManageCounselor 判断当前用户能否管理指定咨询师的时间
+func canManageCounselor(c *gin.Context, counselorID uint) bool {
+	role := currentUserRole(c)
+	if counselorID == currentUserID(c) && config.HasPermission(role, "timeslot:manage:own") {
+		return true
+	}
+	return config.HasPermission(role, "timeslot:manage:any")
+}
+
+// applyTemplateRequest 校验请求并写入模板字段
+func applyTemplateRequest(t *models.AvailabilityTemplate, req *AvailabilityTemplateRequest) string {
+	startMin, err := parseClock(req.StartTime)
+	if err != nil {
+		return "无效的开始时间，格式应为 15:04"
+	}
+	endMin, err := parseClock(req.EndTime)
+	if err != nil {
+		return "无效的结束时间，格式应为 15:04"
+	}
+	if startMin+req.SessionMinutes > endMin {
+		return "时间范围内不足一次咨询时长"
+	}
+
+	validFrom := time.Now()
+	if req.ValidFrom != "" {
+		if validFrom, err = parseDate(req.ValidFrom); err != nil {
+			return "无效的生效日期"
+		}
+	}
+	var validUntil *time.Time
+	if req.ValidUntil != "" {
+		until, err := parseDate(req.ValidUntil)
+		if err != nil {
+			return "无效的失效日期"
+		}
+		if dateKey(until) < dateKey(validFrom) {
+			return "失效日期不能早于生效日期"
+		}
+		validUntil = &until
+	}
+
+	t.Weekdays = formatWeekdays(req.Weekdays)
+	t.StartTime = req.StartTime
+	t.EndTime = req.EndTime
+	t.SessionMinutes = req.SessionMinutes
+	t.BreakMinutes = req.BreakMinutes
+	t.ValidFrom = validFrom
+	t.ValidUntil = validUntil
+	t.Active = req.Active == nil || *req.Active
+	t.Remark = req.Remark
+	return ""
+}
+
+// findManagedTemplate 按路径参数查询当前用户可管理的模板
+func findManagedTemplate(c *gin.Context) (*models.AvailabilityTemplate, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模板ID"})
+		return nil, false
+	}
+	var template models.AvailabilityTemplate
+	if err := config.DB.First(&template, id).Error; err != nil || !canManageCounselor(c, template.CounselorID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return nil, false
+	}
+	return &template, true
+}
+
+// respondSlotSync 同步时间段并返回结果；模板已保存，同步失败时由定时任务补偿
+func respondSlotSync(c *gin.Context, counselorID uint, message string, data gin.H) {
+	created, removed, err := syncCounselorSlots(counselorID)
+	if err != nil {
+		log.Printf("同步咨询时间段失败: counselor_id=%d err=%v", counselorID, err)
+		data["message"] = message + "，时间段将稍后生成"
+		c.JSON(http.StatusOK, data)
+		return
+	}
+	data["message"] = message
+	data["slots"] = gin.H{"created": created, "removed": removed}
+	c.JSON(http.StatusOK, data)
+}
+
+// @Summary 查看可预约时间设置
+// @Tags 可预约时间
+// @Produce json
+// @Security ApiKeyAuth
+// @Param counselor_id query int false "咨询师用户ID，仅管理人员可指定"
+// @Success 200 {object} map[string]interface{} "模板和例外日期"
+// @Router /availability [get]
+func GetAvailability(c *gin.Context) {
+	requested, _ := strconv.ParseUint(c.Query("counselor_id"), 10, 64)
+	counselorID, ok := targetCounselorID(c, uint(requested))
+	if !ok {
+		return
+	}
+
+	var templates []models.AvailabilityTemplate
+	if err := config.DB.Where("counselor_id = ?", counselorID).Order("id").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取可预约时间失败"})
+		return
+	}
+	var exceptions []models.AvailabilityException
+	if err := config.DB.Where("counselor_id = ? AND date >= ?", counselorID, dateKey(time.Now())).
+		Order("date").Find(&exceptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取可预约时间失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates, "exceptions": exceptions})
+}
+
+// @Summary 创建可预约时间模板
+// @Description 按星期重复的可预约时间，保存后立即为滚动窗口内的日期生成时间段
+// @Tags 可预约时间
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body AvailabilityTemplateRequest true "模板信息"
+// @Success 200 {object} map[string]interface{} "创建成功"
+// @Router /availability/templates [post]
+func CreateAvailabilityTemplate(c *gin.Context) {
+	var req AvailabilityTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	counselorID, ok := targetCounselorID(c, req.CounselorID)
+	if !ok {
+		return
+	}
+
+	template := models.AvailabilityTemplate{CounselorID: counselorID}
+	if msg := applyTemplateRequest(&template, &req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := config.DB.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建模板失败"})
+		return
+	}
+
+	respondSlotSync(c, counselorID, "创建成功", gin.H{"template": template})
+}
+
+// @Summary 修改可预约时间模板
+// @Description 修改后重新生成时间段：不再符合模板的可预约时间段被删除，已被预约的时间段保持不变
+// @Tags 可预约时间
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "模板ID"
+// @Param data body AvailabilityTemplateRequest true "模板信息"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Router /availability/templates/{id} [put]
+func UpdateAvailabilityTemplate(c *gin.Context) {
+	var req AvailabilityTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	template, ok := findManagedTemplate(c)
+	if !ok {
+		return
+	}
+
+	if msg := applyTemplateRequest(template, &req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := config.DB.Save(template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改模板失败"})
+		return
+	}
+
+	respondSlotSync(c, template.CounselorID, "修改成功", gin.H{"template": template})
+}
+
+// @Summary 删除可预约时间模板
+// @Description 删除模板及其未被预约的未来时间段，已被预约的时间段保持不变
+// @Tags 可预约时间
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "模板ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Router /availability/templates/{id} [delete]
+func DeleteAvailabilityTemplate(c *gin.Context) {
+	template, ok := findManagedTemplate(c)
+	if !ok {
+		return
+	}
+
+	var removed int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("template_id = ? AND status = ? AND start_time > ?",
+			template.ID, models.TimeSlotStatusAvailable, time.Now()).Delete(&models.TimeSlot{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		if err := tx.Model(&models.TimeSlot{}).Where("template_id = ?", template.ID).
+			Update("template_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.AvailabilityException{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除模板失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功", "removed_slots": removed})
+}
+
+// @Summary 添加例外日期
+// @Description 当天不按模板生成时间段，已生成但未被预约的时间段被删除
+// @Tags 可预约时间
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body AvailabilityExceptionRequest true "例外日期"
+// @Success 200 {object} map[string]interface{} "添加成功"
+// @Router /availability/exceptions [post]
+func CreateAvailabilityException(c *gin.Context) {
+	var req AvailabilityExceptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	counselorID, ok := targetCounselorID(c, req.CounselorID)
+	if !ok {
+		return
+	}
+	date, err := parseDate(req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的日期"})
+		return
+	}
+	if req.TemplateID != nil {
+		var count int64
+		config.DB.Model(&models.AvailabilityTemplate{}).
+			Where("id = ? AND counselor_id = ?", *req.TemplateID, counselorID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+			return
+		}
+	}
+
+	exception := models.AvailabilityException{
+		CounselorID: counselorID,
+		TemplateID:  req.TemplateID,
+		Date:        date,
+		Reason:      req.Reason,
+	}
+	if err := config.DB.Create(&exception).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加例外日期失败"})
+		return
+	}
+
+	respondSlotSync(c, counselorID, "添加成功", gin.H{"exception": exception})
+}
+
+// @Summary 删除例外日期
+// @Description 删除后当天重新按模板生成时间段
+// @Tags 可预约时间
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "例外日期ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Router /availability/exceptions/{id} [delete]
+func DeleteAvailabilityException(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的例外日期ID"})
+		return
+	}
+	var exception models.AvailabilityException
+	if err := config.DB.First(&exception, id).Error; err != nil || !canManageCounselor(c, exception.CounselorID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "例外日期不存在"})
+		return
+	}
+	if err := config.DB.Delete(&exception).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除例外日期失败"})
+		return
+	}
+
+	respondSlotSync(c, exception.CounselorID, "删除成功", gin.H{})
+}
+
+// @Summary 可预约时间段列表
+// @Tags 可预约时间
+// @Produce json
+// @Security ApiKeyAuth
+// @Param counselor_id query int false "咨询师用户ID"
+// @Param from query string false "开始日期，格式2006-01-02，默认今天"
+// @Param to query string false "结束日期（含），格式2006-01-02"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "时间段列表"
+// @Router /timeslots [get]
+func GetAvailableTimeSlots(c *gin.Context) {
+	query := config.DB.Model(&models.TimeSlot{}).
+		Where("status = ? AND start_time > ?", models.TimeSlotStatusAvailable, time.Now()).
+		Where("NOT " + blackoutOverlapSQL("time_slots.counselor_id", "time_slots.start_time", "time_slots.end_time"))
+	if counselorID, err := strconv.ParseUint(c.Query("counselor_id"), 10, 64); err == nil {
+		query = query.Where("counselor_id = ?", counselorID)
+	}
+	if from := c.Query("from"); from != "" {
+		date, err := parseDate(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始日期"})
+			return
+		}
+		query = query.Where("start_time >= ?", date)
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := parseDate(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+			return
+		}
+		query = query.Where("start_time < ?", date.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时间段失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var slots []models.TimeSlot
+	if err := query.Order("start_time, counselor_id").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&slots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时间段失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      slots,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"bytes"
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 头像相关配置
+const (
+	defaultAvatarMaxSize = 5 << 20 // 上传文件默认最大5MB，可通过 AVATAR_MAX_SIZE 配置
+	avatarMinDimension   = 64      // 原图最小边长
+	avatarMaxDimension   = 4096    // 原图最大边长
+	avatarJPEGQuality    = 85
+)
+
+// avatarSizes 生成的缩略图边长，第一个作为 User.Avatar
+var avatarSizes = []int{256, 64}
+
+// avatarKey 头像缩略图的存储key
+func avatarKey(userID uint, id string, size int) string {
+	return fmt.Sprintf("avatars/%d/%s-%d.jpg", userID, id, size)
+}
+
+// avatarURLs 根据 User.Avatar 推算各尺寸缩略图的地址
+func avatarURLs(avatar string) gin.H {
+	urls := gin.H{}
+	suffix := fmt.Sprintf("-%d.jpg", avatarSizes[0])
+	if avatar == "" || !strings.HasSuffix(avatar, suffix) {
+		return urls
+	}
+	base := strings.TrimSuffix(avatar, suffix)
+	for _, size := range avatarSizes {
+		urls[strconv.Itoa(size)] = fmt.Sprintf("%s-%d.jpg", base, size)
+	}
+	return urls
+}
+
+// deleteAvatarFiles 删除头像的所有缩略图，头像不在当前存储中时忽略
+func deleteAvatarFiles(avatar string) {
+	storage := utils.CurrentStorage()
+	for _, url := range avatarURLs(avatar) {
+		key, ok := utils.StorageKeyFromURL(url.(string))
+		if !ok {
+			continue
+		}
+		if err := storage.Delete(key); err != nil {
+			log.Printf("删除头像文件失败: key=%s err=%v", key, err)
+		}
+	}
+}
+
+// @Summary 上传头像
+// @Description 支持 JPEG/PNG/GIF，按文件内容识别类型；去除EXIF等元数据后生成 256×256 和 64×64 的缩略图
+// @Tags 个人中心
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param file formData file true "头像图片"
+// @Success 200 {object} map[string]interface{} "上传成功"
+// @Failure 400 {object} map[string]interface{} "文件类型或尺寸不符合要求"
+// @Router /users/me/avatar [post]
+func UploadAvatar(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传头像图片"})
+		return
+	}
+	maxSize := utils.IntFromEnv("AVATAR_MAX_SIZE", defaultAvatarMaxSize)
+	if fileHeader.Size > int64(maxSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("图片不能超过 %dMB", maxSize>>20)})
+		return
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, int64(maxSize)+1))
+	f.Close()
+	if err != nil || len(data) > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+
+	img, err := utils.DecodeImage(data, avatarMinDimension, avatarMaxDimension)
+	switch {
+	case errors.Is(err, utils.ErrImageDimensions):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("图片宽高需在 %d 到 %d 像素之间", avatarMinDimension, avatarMaxDimension)})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持 JPEG、PNG、GIF 格式的图片"})
+		return
+	}
+
+	id, err := utils.RandomHex(8)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "上传头像失败"})
+		return
+	}
+
+	userID := currentUserID(c)
+	storage := utils.CurrentStorage()
+	var stored []string
+	cleanup := func() {
+		for _, key := range stored {
+			storage.Delete(key)
+		}
+	}
+	for _, size := range avatarSizes {
+		thumb, err := utils.EncodeJPEG(img.Thumbnail(size), avatarJPEGQuality)
+		if err == nil {
+			key := avatarKey(userID, id, size)
+			if err = storage.Put(key, bytes.NewReader(thumb), "image/jpeg"); err == nil {
+				stored = append(stored, key)
+			}
+		}
+		if err != nil {
+			log.Printf("保存头像失败: user_id=%d err=%v", userID, err)
+			cleanup()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "上传头像失败"})
+			return
+		}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		cleanup()
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	oldAvatar := user.Avatar
+	avatar := storage.URL(stored[0])
+	if err := config.DB.Model(&user).UpdateColumn("avatar", avatar).Error; err != nil {
+		cleanup()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "上传头像失败"})
+		return
+	}
+	deleteAvatarFiles(oldAvatar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "上传成功",
+		"avatar":     avatar,
+		"thumbnails": avatarURLs(avatar),
+	})
+}
+
+// @Summary 删除头像
+// @Tags 个人中心
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Router /users/me/avatar [delete]
+func DeleteAvatar(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.Avatar == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+		return
+	}
+
+	oldAvatar := user.Avatar
+	if err := config.DB.Model(&user).UpdateColumn("avatar", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除头像失败"})
+		return
+	}
+	deleteAvatarFiles(oldAvatar)
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// appointmentTimeLayout 通知中预约时间的显示格式
+const appointmentTimeLayout = "2006-01-02 15:04"
+
+// BlackoutRequest 添加停诊安排请求结构
+type BlackoutRequest struct {
+	Scope       string `json:"scope" binding:"required,oneof=global department counselor"`
+	Department  string `json:"department" binding:"max=100"` // 范围为 department 时必填
+	CounselorID *uint  `json:"counselor_id"`                 // 范围为 counselor 时必填
+	Kind        string `json:"kind" binding:"required,oneof=holiday exam leave other"`
+	Title       string `json:"title" binding:"required,max=100"`
+	Start       string `json:"start" binding:"required"` // 格式 2006-01-02 或 2006-01-02 15:04
+	End         string `json:"end" binding:"required"`   // 格式同上，只填日期时包含当天
+}
+
+// blackoutAppliesTo 返回判断 blackouts 表中的停诊安排是否适用于某咨询师的SQL条件，
+// counselorColumn 为咨询师用户ID所在的列或占位符
+func blackoutAppliesTo(counselorColumn string) string {
+	return fmt.Sprintf("(blackouts.scope = '%s'"+
+		" OR (blackouts.scope = '%s' AND blackouts.counselor_id = %s)"+
+		" OR (blackouts.scope = '%s' AND blackouts.department <> '' AND blackouts.department = "+
+		"(SELECT counselors.department FROM counselors WHERE counselors.user_id = %s AND counselors.deleted_at IS NULL LIMIT 1)))",
+		models.BlackoutScopeGlobal, models.BlackoutScopeCounselor, counselorColumn,
+		models.BlackoutScopeDepartment, counselorColumn)
+}
+
+// blackoutOverlapSQL 返回判断某时间段是否处于停诊期间的SQL条件
+func blackoutOverlapSQL(counselorColumn, startColumn, endColumn string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM blackouts WHERE blackouts.start_at < %s AND blackouts.end_at > %s AND %s)",
+		endColumn, startColumn, blackoutAppliesTo(counselorColumn))
+}
+
+// applicableBlackouts 查询与 [from, to) 重叠且适用于该咨询师的停诊安排
+func applicableBlackouts(tx *gorm.DB, counselorID uint, from, to time.Time) ([]models.Blackout, error) {
+	var blackouts []models.Blackout
+	err := tx.Where("start_at < ? AND end_at > ?", to, from).
+		Where(blackoutAppliesTo("?"), counselorID, counselorID).
+		Order("start_at").Find(&blackouts).Error
+	return blackouts, err
+}
+
+// overlapsBlackout 判断时间段是否与任一停诊安排重叠
+func overlapsBlackout(blackouts []models.Blackout, start, end time.Time) bool {
+	for _, b := range blackouts {
+		if start.Before(b.EndAt) && end.After(b.StartAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBlackoutTime 解析停诊安排的起止时间，只填日期的结束时间包含当天
+func parseBlackoutTime(s string, isEnd bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(appointmentTimeLayout, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := parseDate(s)
+	if err != nil || s == "" {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// blackoutCounselorIDs 有启用模板且适用该停诊安排的咨询师，用于重新生成时间段
+func blackoutCounselorIDs(blackoutID uint) ([]uint, error) {
+	var ids []uint
+	err := config.DB.Model(&models.AvailabilityTemplate{}).Where("active = ?", true).
+		Where("EXISTS (SELECT 1 FROM blackouts WHERE blackouts.id = ? AND "+
+			blackoutAppliesTo("availability_templates.counselor_id")+")", blackoutID).
+		Distinct().Pluck("counselor_id", &ids).Error
+	return ids, err
+}
+
+// resyncCounselors 重新生成咨询师的时间段，失败时由定时任务补偿
+func resyncCounselors(counselorIDs []uint) {
+	for _, id := range counselorIDs {
+		if _, _, err := syncCounselorSlots(id); err != nil {
+			log.Printf("同步咨询时间段失败: counselor_id=%d err=%v", id, err)
+		}
+	}
+}
+
+// suggestTimeSlot 为受停诊影响的预约推荐改约时间：停诊结束后该咨询师最早的可预约时间段
+func suggestTimeSlot(counselorID int, after time.Time) *models.TimeSlot {
+	var slot models.TimeSlot
+	err := config.DB.Where("counselor_id = ? AND status = ? AND start_time >= ?",
+		counselorID, models.TimeSlotStatusAvailable, after).
+		Where("NOT " + blackoutOverlapSQL("time_slots.counselor_id", "time_slots.start_time", "time_slots.end_time")).
+		Order("start_time").First(&slot).Error
+	if err != nil {
+		return nil
+	}
+	return &slot
+}
+
+// notifyBlackoutAppointments 通知已确认预约落在停诊期间的学生，并附上推荐的改约时间
+func notifyBlackoutAppointments(blackout models.Blackout, appointments []models.Appointment) {
+	for _, a := range appointments {
+		var student models.User
+		if err := config.DB.First(&student, a.UserID).Error; err != nil {
+			continue
+		}
+
+		body := fmt.Sprintf("您预约的 %s 与 %s 的心理咨询处于停诊期间（%s：%s 至 %s）。",
+			a.StartTime.Format(appointmentTimeLayout), a.CounselorName, blackout.Title,
+			blackout.StartAt.Format(appointmentTimeLayout), blackout.EndAt.Format(appointmentTimeLayout))
+		if slot := suggestTimeSlot(a.CounselorID, blackout.EndAt); slot != nil {
+			body += fmt.Sprintf("建议改约至 %s（时间段ID：%d），请登录系统办理改约。",
+				slot.StartTime.Format(appointmentTimeLayout), slot.ID)
+		} else {
+			body += "请登录系统重新选择咨询时间。"
+		}
+		notifyUser(&student, "咨询预约停诊通知", body)
+	}
+}
+
+// @Summary 停诊日历
+// @Description 查询节假日、考试周、咨询师请假等停诊安排
+// @Tags 可预约时间
+// @Produce json
+// @Security ApiKeyAuth
+// @Param from query string false "开始日期，格式2006-01-02"
+// @Param to query string false "结束日期（含），格式2006-01-02"
+// @Param scope query string false "适用范围：global/department/counselor"
+// @Param counselor_id query int false "只看适用于该咨询师的停诊安排"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "停诊安排列表"
+// @Router /blackouts [get]
+func GetBlackouts(c *gin.Context) {
+	query := config.DB.Model(&models.Blackout{})
+	if from := c.Query("from"); from != "" {
+		date, err := parseDate(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始日期"})
+			return
+		}
+		query = query.Where("end_at > ?", date)
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := parseDate(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+			return
+		}
+		query = query.Where("start_at < ?", date.AddDate(0, 0, 1))
+	}
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if counselorID, err := strconv.ParseUint(c.Query("counselor_id"), 10, 64); err == nil {
+		query = query.Where(blackoutAppliesTo("?"), counselorID, counselorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取停诊日历失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var blackouts []models.Blackout
+	if err := query.Order("start_at, id").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&blackouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取停诊日历失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      blackouts,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// @Summary 添加停诊安排
+// @Description 停诊期间不生成时间段，已生成的可预约时间段被隐藏且不可预约；
+// @Description 已确认的预约不会自动取消，系统通知相关学生并推荐改约时间
+// @Tags 可预约时间
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body BlackoutRequest true "停诊安排"
+// @Success 200 {object} map[string]interface{} "添加成功"
+// @Router /blackouts [post]
+func CreateBlackout(c *gin.Context) {
+	var req BlackoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	blackout := models.Blackout{
+		Scope:     req.Scope,
+		Kind:      req.Kind,
+		Title:     req.Title,
+		CreatedBy: currentUserID(c),
+	}
+	switch req.Scope {
+	case models.BlackoutScopeDepartment:
+		if req.Department == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请指定部门"})
+			return
+		}
+		blackout.Department = req.Department
+	case models.BlackoutScopeCounselor:
+		if req.CounselorID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请指定咨询师"})
+			return
+		}
+		var count int64
+		config.DB.Model(&models.User{}).Where("id = ? AND role = ?", *req.CounselorID, "counselor").Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "咨询师不存在"})
+			return
+		}
+		blackout.CounselorID = req.CounselorID
+	}
+
+	var err error
+	if blackout.StartAt, err = parseBlackoutTime(req.Start, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+		return
+	}
+	if blackout.EndAt, err = parseBlackoutTime(req.End, true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间"})
+		return
+	}
+	if !blackout.EndAt.After(blackout.StartAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束时间必须晚于开始时间"})
+		return
+	}
+
+	if err := config.DB.Create(&blackout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加停诊安排失败"})
+		return
+	}
+
+	counselorIDs, err := blackoutCounselorIDs(blackout.ID)
+	if err != nil {
+		log.Printf("查询受停诊影响的咨询师失败: blackout_id=%d err=%v", blackout.ID, err)
+	}
+	resyncCounselors(counselorIDs)
+
+	var affected []models.Appointment
+	if err := config.DB.Where("status = ? AND start_time < ? AND end_time > ?",
+		models.AppointmentStatusConfirmed, blackout.EndAt, blackout.StartAt).
+		Where("EXISTS (SELECT 1 FROM blackouts WHERE blackouts.id = ? AND "+
+			blackoutAppliesTo("appointments.counselor_id")+")", blackout.ID).
+		Order("start_time").Find(&affected).Error; err != nil {
+		log.Printf("查询受停诊影响的预约失败: blackout_id=%d err=%v", blackout.ID, err)
+	}
+	if len(affected) > 0 {
+		go notifyBlackoutAppointments(blackout, affected)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "添加成功",
+		"blackout":              blackout,
+		"affected_appointments": len(affected),
+	})
+}
+
+// @Summary 删除停诊安排
+// @Description 删除后重新按模板生成该期间的时间段
+// @Tags 可预约时间
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "停诊安排ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Router /blackouts/{id} [delete]
+func DeleteBlackout(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的停诊安排ID"})
+		return
+	}
+	var blackout models.Blackout
+	if err := config.DB.First(&blackout, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停诊安排不存在"})
+		return
+	}
+
+	// 删除前确定受影响的咨询师
+	counselorIDs, err := blackoutCounselorIDs(blackout.ID)
+	if err != nil {
+		log.Printf("查询受停诊影响的咨询师失败: blackout_id=%d err=%v", blackout.ID, err)
+	}
+	if err := config.DB.Delete(&blackout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除停诊安排失败"})
+		return
+	}
+	resyncCounselors(counselorIDs)
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
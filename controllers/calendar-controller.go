@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"bytes"
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 日历订阅相关配置
+const (
+	defaultCalendarFeedDays = 90                    // 订阅包含未来多少天的预约和时间段，可通过 CALENDAR_FEED_DAYS 配置
+	calendarFeedPastDays    = 7                     // 订阅同时保留最近几天的预约，避免日历应用中刚结束的预约立即消失
+	defaultCalendarUIDHost  = "ental-health-system" // 事件UID的域名部分，可通过 CALENDAR_UID_DOMAIN 配置
+)
+
+// calendarUID 生成事件的全局唯一标识，同一预约或时间段在多次拉取之间保持不变
+func calendarUID(kind string, id uint) string {
+	host := os.Getenv("CALENDAR_UID_DOMAIN")
+	if host == "" {
+		host = defaultCalendarUIDHost
+	}
+	return fmt.Sprintf("%s-%d@%s", kind, id, host)
+}
+
+// calendarFeedPath 订阅地址的路径部分
+func calendarFeedPath(token string) string {
+	return "/api/v1/calendar/feeds/" + token + ".ics"
+}
+
+// calendarStatus 预约状态对应的事件状态
+func calendarStatus(status string) string {
+	switch status {
+	case models.AppointmentStatusPending:
+		return utils.ICalStatusTentative
+	case models.AppointmentStatusConfirmed, models.AppointmentStatusCheckedIn, models.AppointmentStatusCompleted:
+		return utils.ICalStatusConfirmed
+	default:
+		return utils.ICalStatusCancelled
+	}
+}
+
+// calendarStatusText 事件描述中显示的预约状态
+var calendarStatusText = map[string]string{
+	models.AppointmentStatusPending:              "待确认",
+	models.AppointmentStatusConfirmed:            "已确认",
+	models.AppointmentStatusCheckedIn:            "已签到",
+	models.AppointmentStatusCompleted:            "已完成",
+	models.AppointmentStatusCancelledByStudent:   "学生已取消",
+	models.AppointmentStatusCancelledByCounselor: "咨询师已取消",
+	models.AppointmentStatusRejected:             "咨询师已拒绝",
+	models.AppointmentStatusNoShow:               "学生爽约",
+}
+
+// appointmentEvents 将预约转换为日历事件。只有预约的咨询师本人能看到学生姓名，
+// 咨询原因和咨询记录属于敏感信息，不写入日历
+func appointmentEvents(appointments []models.Appointment, viewerID uint) ([]utils.ICalEvent, error) {
+	if len(appointments) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(appointments))
+	counselorIDs := make([]int, 0, len(appointments))
+	for _, a := range appointments {
+		ids = append(ids, a.ID)
+		counselorIDs = append(counselorIDs, a.CounselorID)
+	}
+
+	// 每次状态变更或改约都会写入一条变更记录，以记录数作为事件修订号
+	var revisions []struct {
+		AppointmentID uint
+		Count         int
+	}
+	if err := config.DB.Model(&models.AppointmentStatusHistory{}).
+		Select("appointment_id, COUNT(*) AS count").
+		Where("appointment_id IN ?", ids).Group("appointment_id").
+		Scan(&revisions).Error; err != nil {
+		return nil, err
+	}
+	sequence := make(map[uint]int, len(revisions))
+	for _, r := range revisions {
+		sequence[r.AppointmentID] = r.Count
+	}
+
+	var counselors []models.Counselor
+	if err := config.DB.Select("user_id, office_location").
+		Where("user_id IN ?", counselorIDs).Find(&counselors).Error; err != nil {
+		return nil, err
+	}
+	locations := make(map[uint]string, len(counselors))
+	for _, co := range counselors {
+		locations[co.UserID] = co.OfficeLocation
+	}
+
+	events := make([]utils.ICalEvent, 0, len(appointments))
+	for _, a := range appointments {
+		var summary string
+		if uint(a.CounselorID) == viewerID {
+			summary = "心理咨询：" + a.Username
+		} else if uint(a.UserID) == viewerID {
+			summary = "心理咨询：" + a.CounselorName + " 咨询师"
+		} else {
+			summary = "心理咨询：" + a.CounselorName + " 咨询师（学生信息已隐藏）"
+		}
+		statusText := calendarStatusText[a.Status]
+		if statusText == "" {
+			statusText = a.Status
+		}
+		events = append(events, utils.ICalEvent{
+			UID:          calendarUID("appointment", a.ID),
+			Start:        a.StartTime,
+			End:          a.EndTime,
+			Summary:      summary,
+			Description:  fmt.Sprintf("预约编号：%d\n状态：%s", a.ID, statusText),
+			Location:     locations[uint(a.CounselorID)],
+			Status:       calendarStatus(a.Status),
+			Sequence:     sequence[a.ID],
+			LastModified: a.UpdatedAt,
+		})
+	}
+	return events, nil
+}
+
+// timeSlotEvents 将咨询师未被预约的时间段转换为不占用忙闲时间的日历事件
+func timeSlotEvents(slots []models.TimeSlot) []utils.ICalEvent {
+	events := make([]utils.ICalEvent, 0, len(slots))
+	for _, s := range slots {
+		summary := "可预约时段"
+		if s.Status == models.TimeSlotStatusHeld {
+			summary = "可预约时段（为候补学生保留中）"
+		}
+		events = append(events, utils.ICalEvent{
+			UID:          calendarUID("timeslot", s.ID),
+			Start:        s.StartTime,
+			End:          s.EndTime,
+			Summary:      summary,
+			Status:       utils.ICalStatusConfirmed,
+			LastModified: s.UpdatedAt,
+			Transparent:  true,
+		})
+	}
+	return events
+}
+
+// writeCalendar 输出 text/calendar 响应
+func writeCalendar(c *gin.Context, cal *utils.ICalendar, filename string) {
+	var buf bytes.Buffer
+	if err := utils.WriteICalendar(&buf, cal, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成日历失败"})
+		return
+	}
+	if filename != "" {
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// @Summary 下载预约日历文件
+// @Description 以 iCalendar（.ics）格式下载单个预约，可导入日历应用。只有预约的咨询师本人能看到学生姓名
+// @Tags 预约管理
+// @Produce text/calendar
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Success 200 {string} string "iCalendar 文件"
+// @Failure 404 {object} map[string]interface{} "预约不存在"
+// @Router /appointments/{id}/ics [get]
+func DownloadAppointmentICS(c *gin.Context) {
+	appointment, ok := findVisibleAppointment(c)
+	if !ok {
+		return
+	}
+
+	events, err := appointmentEvents([]models.Appointment{*appointment}, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成日历失败"})
+		return
+	}
+	writeCalendar(c, &utils.ICalendar{Events: events},
+		"appointment-"+strconv.FormatUint(uint64(appointment.ID), 10)+".ics")
+}
+
+// @Summary 查看日历订阅状态
+// @Description 订阅链接只在生成时返回一次，此处仅返回是否已开启
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "订阅状态"
+// @Router /users/me/calendar-feed [get]
+func GetMyCalendarFeed(c *gin.Context) {
+	var feed models.CalendarFeed
+	if err := config.DB.Where("user_id = ?", currentUserID(c)).First(&feed).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, gin.H{"enabled": false})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取日历订阅失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "feed": feed})
+}
+
+// @Summary 生成日历订阅链接
+// @Description 生成新的订阅令牌，旧的订阅链接立即失效。返回的链接可在日历应用中订阅（webcal），请妥善保管，只返回一次
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "订阅链接"
+// @Router /users/me/calendar-feed [post]
+func RegenerateMyCalendarFeed(c *gin.Context) {
+	userID := currentUserID(c)
+	token, err := utils.RandomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成订阅链接失败"})
+		return
+	}
+
+	feed := models.CalendarFeed{UserID: userID}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CalendarFeed{}).Error; err != nil {
+			return err
+		}
+		feed.TokenHash = hashSecretToken(token)
+		return tx.Create(&feed).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成订阅链接失败"})
+		return
+	}
+
+	path := calendarFeedPath(token)
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "订阅链接已生成，旧链接已失效",
+		"feed":       feed,
+		"feed_path":  path,
+		"webcal_url": "webcal://" + c.Request.Host + path,
+	})
+}
+
+// @Summary 关闭日历订阅
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "已关闭"
+// @Router /users/me/calendar-feed [delete]
+func DeleteMyCalendarFeed(c *gin.Context) {
+	if err := config.DB.Where("user_id = ?", currentUserID(c)).Delete(&models.CalendarFeed{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭日历订阅失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "日历订阅已关闭"})
+}
+
+// @Summary 日历订阅
+// @Description 凭订阅令牌获取 iCalendar 格式的日历，包含用户作为学生或咨询师的预约，以及咨询师自己未被预约的时间段。
+// @Description 已取消的预约以 CANCELLED 状态保留，日历应用会据此移除；只有预约的咨询师本人能看到学生姓名
+// @Tags 预约管理
+// @Produce text/calendar
+// @Param token path string true "订阅令牌，可带 .ics 后缀"
+// @Success 200 {string} string "iCalendar 日历"
+// @Failure 404 {object} map[string]interface{} "订阅链接无效"
+// @Router /calendar/feeds/{token} [get]
+func GetCalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var feed models.CalendarFeed
+	if token == "" || config.DB.Where("token_hash = ?", hashSecretToken(token)).First(&feed).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅链接无效"})
+		return
+	}
+	var user models.User
+	if err := config.DB.First(&user, feed.UserID).Error; err != nil || user.Status != "active" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅链接无效"})
+		return
+	}
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -calendarFeedPastDays)
+	to := now.AddDate(0, 0, utils.IntFromEnv("CALENDAR_FEED_DAYS", defaultCalendarFeedDays))
+
+	var appointments []models.Appointment
+	if err := config.DB.Where("(user_id = ? OR counselor_id = ?) AND start_time >= ? AND start_time < ?",
+		user.ID, user.ID, from, to).Order("start_time").Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成日历失败"})
+		return
+	}
+	events, err := appointmentEvents(appointments, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成日历失败"})
+		return
+	}
+
+	var slots []models.TimeSlot
+	if err := config.DB.Where("counselor_id = ? AND status IN ? AND start_time >= ? AND start_time < ?",
+		user.ID, []string{models.TimeSlotStatusAvailable, models.TimeSlotStatusHeld}, now, to).
+		Order("start_time").Find(&slots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成日历失败"})
+		return
+	}
+	events = append(events, timeSlotEvents(slots)...)
+
+	config.DB.Model(&feed).UpdateColumn("last_used_at", &now)
+	writeCalendar(c, &utils.ICalendar{Name: "心理咨询预约", Events: events}, "")
+}
@@ -0,0 +1,462 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 个人数据导出相关配置
+const (
+	defaultDataExportTTL      = 24 * time.Hour // 下载链接默认有效期，可通过 DATA_EXPORT_TTL 配置
+	defaultDataExportInterval = 24 * time.Hour // 两次申请导出的最小间隔，可通过 DATA_EXPORT_INTERVAL 配置
+	dataExportStaleAfter      = time.Hour      // 生成中的任务超过该时长视为中断
+)
+
+// exportSection 导出包中的一类数据
+type exportSection struct {
+	Key   string      // data.json 中的字段名
+	Title string      // HTML 中的标题
+	Data  interface{} // 数据
+}
+
+// exportSession 导出的登录会话，不包含令牌本身
+type exportSession struct {
+	ID        uint       `json:"id"`
+	Type      string     `json:"type"`
+	FamilyID  string     `json:"family_id"`
+	ClientIP  string     `json:"client_ip"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	LastUsed  *time.Time `json:"last_used"`
+	IsRevoked bool       `json:"is_revoked"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// exportExamRecord 导出的测评记录
+// 系统只保存测评总分和结果反馈，不保存逐题作答，因此导出内容不含单题答案
+type exportExamRecord struct {
+	models.ExamRecord
+	PaperTitle string `json:"paper_title"`
+}
+
+// exportDownloadURL 导出包的下载地址
+func exportDownloadURL(id uint, token string) string {
+	return fmt.Sprintf("/api/v1/exports/%d/download?token=%s", id, token)
+}
+
+// collectPersonalData 收集用户的全部个人数据
+func collectPersonalData(userID uint) ([]exportSection, *models.User, error) {
+	var user models.User
+	if err := config.DB.Preload("Student").Preload("Counselor").First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var appointments []models.Appointment
+	if err := config.DB.Where("user_id = ?", userID).Order("start_time").Find(&appointments).Error; err != nil {
+		return nil, nil, err
+	}
+	// 咨询记录备注是咨询师的工作记录，不属于学生本人提供的数据
+	for i := range appointments {
+		appointments[i].Notes = ""
+	}
+
+	var records []exportExamRecord
+	if err := config.DB.Model(&models.ExamRecord{}).
+		Select("exam_records.*, exam_papers.title AS paper_title").
+		Joins("LEFT JOIN exam_papers ON exam_papers.id = exam_records.paper_id").
+		Where("exam_records.user_id = ?", userID).Order("exam_records.created_at").
+		Scan(&records).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var feedback []models.Feedback
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&feedback).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var sessions []exportSession
+	if err := config.DB.Model(&models.Token{}).Unscoped().Where("user_id = ?", userID).Order("created_at").
+		Scan(&sessions).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var attempts []models.LoginAttempt
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&attempts).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var identities []models.ExternalIdentity
+	if err := config.DB.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// 学生和咨询师档案单独列出
+	student, counselor := user.Student, user.Counselor
+	user.Student, user.Counselor = nil, nil
+
+	sections := []exportSection{
+		{"user", "账户信息", user},
+		{"student", "学生档案", student},
+		{"counselor", "咨询师档案", counselor},
+		{"appointments", "咨询预约", appointments},
+		{"exam_records", "心理测评记录", records},
+		{"feedback", "意见反馈", feedback},
+		{"sessions", "登录会话", sessions},
+		{"login_attempts", "登录记录", attempts},
+		{"external_identities", "统一认证绑定", identities},
+	}
+	return sections, &user, nil
+}
+
+// htmlSection HTML 中的一个表格
+type htmlSection struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+var exportHTMLTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>个人数据导出 - {{.Username}}</title>
+<style>
+body{font-family:sans-serif;margin:2em;color:#333}
+table{border-collapse:collapse;margin-bottom:2em;font-size:14px}
+th,td{border:1px solid #ccc;padding:4px 8px;text-align:left;vertical-align:top;word-break:break-all}
+th{background:#f5f5f5}
+</style>
+</head>
+<body>
+<h1>个人数据导出</h1>
+<p>用户名：{{.Username}}　生成时间：{{.GeneratedAt}}</p>
+<p>完整的机器可读数据见同一压缩包中的 data.json。</p>
+{{range .Sections}}
+<h2>{{.Title}}</h2>
+{{if .Rows}}<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>无记录</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// toHTMLSection 将任意数据转换为表格：对象按字段/值两列展示，数组按字段展开为多列
+func toHTMLSection(title string, data interface{}) (htmlSection, error) {
+	section := htmlSection{Title: title}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return section, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return section, err
+	}
+
+	cell := func(v interface{}) string {
+		switch v := v.(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case map[string]interface{}, []interface{}:
+			b, _ := json.Marshal(v)
+			return string(b)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+
+	switch v := generic.(type) {
+	case map[string]interface{}:
+		section.Columns = []string{"字段", "值"}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			section.Rows = append(section.Rows, []string{k, cell(v[k])})
+		}
+	case []interface{}:
+		seen := map[string]bool{}
+		for _, item := range v {
+			if obj, ok := item.(map[string]interface{}); ok {
+				for k := range obj {
+					if !seen[k] {
+						seen[k] = true
+						section.Columns = append(section.Columns, k)
+					}
+				}
+			}
+		}
+		sort.Strings(section.Columns)
+		for _, item := range v {
+			obj, _ := item.(map[string]interface{})
+			row := make([]string, len(section.Columns))
+			for i, k := range section.Columns {
+				row[i] = cell(obj[k])
+			}
+			section.Rows = append(section.Rows, row)
+		}
+	}
+	return section, nil
+}
+
+// buildExportArchive 生成包含 data.json 和 index.html 的 ZIP 包
+func buildExportArchive(user *models.User, sections []exportSection, now time.Time) ([]byte, error) {
+	data := map[string]interface{}{"generated_at": now}
+	htmlSections := make([]htmlSection, 0, len(sections))
+	for _, s := range sections {
+		data[s.Key] = s.Data
+		hs, err := toHTMLSection(s.Title, s.Data)
+		if err != nil {
+			return nil, err
+		}
+		htmlSections = append(htmlSections, hs)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	f, err := zw.Create("data.json")
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+
+	f, err = zw.Create("index.html")
+	if err != nil {
+		return nil, err
+	}
+	if err := exportHTMLTemplate.Execute(f, gin.H{
+		"Username":    user.Username,
+		"GeneratedAt": now.Format("2006-01-02 15:04:05"),
+		"Sections":    htmlSections,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// processDataExport 生成导出包并保存到私有存储
+func processDataExport(exportID uint) {
+	var export models.DataExport
+	// 抢占任务，避免重复生成
+	result := config.DB.Model(&export).
+		Where("id = ? AND status = ?", exportID, models.DataExportPending).
+		Update("status", models.DataExportProcessing)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	if err := config.DB.First(&export, exportID).Error; err != nil {
+		return
+	}
+
+	fail := func(err error) {
+		log.Printf("生成个人数据导出失败: export_id=%d user_id=%d err=%v", export.ID, export.UserID, err)
+		config.DB.Model(&export).Updates(map[string]interface{}{
+			"status": models.DataExportFailed,
+			"error":  "生成失败，请重新申请",
+		})
+		writeAudit(config.DB, nil, nil, auditDataExportFailed, "data_export", export.ID, err.Error())
+	}
+
+	now := time.Now()
+	sections, user, err := collectPersonalData(export.UserID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	archive, err := buildExportArchive(user, sections, now)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	key := fmt.Sprintf("exports/%d/%d-%s.zip", export.UserID, export.ID, export.TokenHash[:16])
+	if err := utils.PrivateStorage().Put(key, bytes.NewReader(archive), "application/zip"); err != nil {
+		fail(err)
+		return
+	}
+	if err := config.DB.Model(&export).Updates(map[string]interface{}{
+		"status":       models.DataExportReady,
+		"storage_key":  key,
+		"file_size":    len(archive),
+		"completed_at": &now,
+	}).Error; err != nil {
+		utils.PrivateStorage().Delete(key)
+		fail(err)
+		return
+	}
+	writeAudit(config.DB, nil, nil, auditDataExportCompleted, "data_export", export.ID,
+		fmt.Sprintf("user_id=%d size=%d", export.UserID, len(archive)))
+}
+
+// CleanupDataExports 删除过期的导出包，并将中断的生成任务标记为失败
+func CleanupDataExports() {
+	now := time.Now()
+	var expired []models.DataExport
+	if err := config.DB.Where("status = ? AND expires_at <= ?", models.DataExportReady, now).
+		Find(&expired).Error; err != nil {
+		log.Printf("清理过期数据导出失败: %v", err)
+		return
+	}
+	for _, e := range expired {
+		if e.StorageKey != "" {
+			if err := utils.PrivateStorage().Delete(e.StorageKey); err != nil {
+				log.Printf("删除数据导出文件失败: export_id=%d err=%v", e.ID, err)
+				continue
+			}
+		}
+		config.DB.Model(&e).Updates(map[string]interface{}{"status": models.DataExportExpired, "storage_key": ""})
+	}
+
+	config.DB.Model(&models.DataExport{}).
+		Where("status IN ? AND updated_at <= ?",
+			[]string{models.DataExportPending, models.DataExportProcessing}, now.Add(-dataExportStaleAfter)).
+		Updates(map[string]interface{}{"status": models.DataExportFailed, "error": "生成中断，请重新申请"})
+}
+
+// @Summary 申请导出个人数据
+// @Description 异步生成包含账户信息、学生档案、预约、测评记录、反馈和登录会话的 ZIP 包（JSON + HTML）。
+// @Description 返回的下载地址在生成完成后可用，有效期默认24小时，仅在本次响应中返回
+// @Tags 个人中心
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} map[string]interface{} "已开始生成"
+// @Failure 429 {object} map[string]interface{} "申请过于频繁"
+// @Router /users/me/exports [post]
+func RequestDataExport(c *gin.Context) {
+	userID := currentUserID(c)
+
+	interval := utils.DurationFromEnv("DATA_EXPORT_INTERVAL", defaultDataExportInterval)
+	var recent int64
+	config.DB.Model(&models.DataExport{}).
+		Where("user_id = ? AND status <> ? AND created_at > ?", userID, models.DataExportFailed, time.Now().Add(-interval)).
+		Count(&recent)
+	if recent > 0 {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "申请过于频繁，请稍后再试或下载已生成的导出包"})
+		return
+	}
+
+	token, err := utils.RandomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "申请导出失败"})
+		return
+	}
+	export := models.DataExport{
+		UserID:    userID,
+		Status:    models.DataExportPending,
+		TokenHash: hashSecretToken(token),
+		ExpiresAt: time.Now().Add(utils.DurationFromEnv("DATA_EXPORT_TTL", defaultDataExportTTL)),
+	}
+	if err := config.DB.Create(&export).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "申请导出失败"})
+		return
+	}
+	writeAudit(config.DB, c, &userID, auditDataExportRequested, "data_export", export.ID, "")
+
+	go processDataExport(export.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "正在生成导出包，请稍后通过下载地址获取",
+		"export":       export,
+		"download_url": exportDownloadURL(export.ID, token),
+	})
+}
+
+// @Summary 查看个人数据导出记录
+// @Tags 个人中心
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "导出记录列表"
+// @Router /users/me/exports [get]
+func GetMyDataExports(c *gin.Context) {
+	var exports []models.DataExport
+	if err := config.DB.Where("user_id = ?", currentUserID(c)).Order("created_at DESC").Limit(20).
+		Find(&exports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取导出记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// @Summary 下载个人数据导出包
+// @Description 使用申请导出时返回的下载地址，无需登录；链接过期后需重新申请
+// @Tags 个人中心
+// @Produce application/zip
+// @Param id path int true "导出任务ID"
+// @Param token query string true "下载令牌"
+// @Success 200 {file} file "导出包"
+// @Failure 404 {object} map[string]interface{} "链接无效或已过期"
+// @Failure 409 {object} map[string]interface{} "导出包尚未生成"
+// @Router /exports/{id}/download [get]
+func DownloadDataExport(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "下载链接无效或已过期"})
+		return
+	}
+
+	var export models.DataExport
+	if err := config.DB.First(&export, id).Error; err != nil ||
+		subtle.ConstantTimeCompare([]byte(export.TokenHash), []byte(hashSecretToken(c.Query("token")))) != 1 ||
+		time.Now().After(export.ExpiresAt) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "下载链接无效或已过期"})
+		return
+	}
+	switch export.Status {
+	case models.DataExportPending, models.DataExportProcessing:
+		c.JSON(http.StatusConflict, gin.H{"error": "导出包正在生成，请稍后再试"})
+		return
+	case models.DataExportReady:
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "下载链接无效或已过期"})
+		return
+	}
+
+	f, err := utils.PrivateStorage().Open(export.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "下载链接无效或已过期"})
+		return
+	}
+	defer f.Close()
+
+	now := time.Now()
+	config.DB.Model(&export).Update("downloaded_at", &now)
+	writeAudit(config.DB, c, nil, auditDataExportDownloaded, "data_export", export.ID, "")
+
+	c.Header("Content-Disposition", `attachment; filename="personal-data-`+strconv.FormatUint(uint64(export.ID), 10)+`.zip"`)
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Length", strconv.FormatInt(export.FileSize, 10))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, f)
+}
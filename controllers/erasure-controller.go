@@ -0,0 +1,550 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 可依法保留的数据类别，通过 ERASURE_RETAIN_CATEGORIES 配置（逗号分隔），保留的类别在执行删除时保持原样
+const (
+	retainAppointments  = "appointments"   // 咨询预约记录
+	retainExamRecords   = "exam_records"   // 心理测评记录
+	retainFeedback      = "feedback"       // 意见反馈
+	retainLoginAttempts = "login_attempts" // 登录记录
+)
+
+// erasedDisplayName 数据删除后替代姓名的显示名称
+const erasedDisplayName = "已注销用户"
+
+// ErasureRequestBody 申请删除个人数据请求结构
+type ErasureRequestBody struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// ReviewErasureRequest 审核数据删除申请请求结构
+type ReviewErasureRequest struct {
+	Note string `json:"note" binding:"max=500"`
+}
+
+// errErasureNotAllowed 当前状态不允许该操作
+var errErasureNotAllowed = errors.New("erasure request state does not allow this operation")
+
+// retainedCategories 读取依法保留的数据类别
+func retainedCategories() map[string]bool {
+	retained := map[string]bool{}
+	for _, c := range strings.Split(os.Getenv("ERASURE_RETAIN_CATEGORIES"), ",") {
+		switch c = strings.TrimSpace(c); c {
+		case retainAppointments, retainExamRecords, retainFeedback, retainLoginAttempts:
+			retained[c] = true
+		case "":
+		default:
+			log.Printf("未知的数据保留类别: %s", c)
+		}
+	}
+	return retained
+}
+
+// erasureResult 执行删除后需要在事务外清理的文件，以及需要匹配候补的时间段
+type erasureResult struct {
+	avatar        string
+	exportKeys    []string
+	releasedSlots []uint
+}
+
+// cancelDepartedUserAppointments 用户被删除或注销后取消其尚未开始的预约：作为学生的预约按学生取消处理，
+// 作为咨询师的预约由系统拒绝或取消；同时停用该咨询师的可预约时间模板，删除其之后的空闲时间段并关闭候补。
+// 返回学生取消后空出的时间段，在事务提交后匹配候补
+func cancelDepartedUserAppointments(tx *gorm.DB, userID uint, reason string, now time.Time) ([]uint, error) {
+	var appointments []models.Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("(user_id = ? OR counselor_id = ?) AND status IN ? AND start_time > ?", userID, userID,
+			[]string{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}, now).
+		Order("id").Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+	var released []uint
+	for i := range appointments {
+		appointment := &appointments[i]
+		to := models.AppointmentStatusCancelledByStudent
+		if uint(appointment.CounselorID) == userID {
+			to = models.AppointmentStatusCancelledByCounselor
+			if appointment.Status == models.AppointmentStatusPending {
+				to = models.AppointmentStatusRejected
+			}
+		}
+		if err := transitionAppointment(tx, appointment, to, nil, models.AppointmentActorSystem, reason, now); err != nil {
+			return nil, err
+		}
+		if to == models.AppointmentStatusCancelledByStudent && appointment.TimeSlotID > 0 {
+			released = append(released, uint(appointment.TimeSlotID))
+		}
+	}
+
+	// 咨询师注销后不再开放时间段，排队等待该咨询师的候补一并关闭
+	if err := tx.Model(&models.AvailabilityTemplate{}).Where("counselor_id = ?", userID).
+		Update("active", false).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("counselor_id = ? AND status IN ? AND start_time > ?", userID,
+		[]string{models.TimeSlotStatusAvailable, models.TimeSlotStatusHeld}, now).
+		Delete(&models.TimeSlot{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.WaitlistEntry{}).Where("counselor_id = ? AND status IN ?", userID, openWaitlistStatuses).
+		UpdateColumn("status", models.WaitlistCancelled).Error; err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// eraseUserData 对用户的个人数据做假名化处理：
+// 清除或替换可识别身份的字段，保留ID关联、角色、日期、分数、状态等统计所需字段；
+// 删除凭据、会话和验证码等与统计无关的数据；最后软删除用户
+func eraseUserData(tx *gorm.DB, user *models.User, retained map[string]bool) (*erasureResult, error) {
+	result := &erasureResult{avatar: user.Avatar}
+
+	suffix, err := utils.RandomHex(4)
+	if err != nil {
+		return nil, err
+	}
+	pseudonym := fmt.Sprintf("erased_%d_%s", user.ID, suffix)
+	displayName := fmt.Sprintf("%s#%d", erasedDisplayName, user.ID)
+
+	// 密码替换为随机值的哈希，账户永远无法再登录
+	randomPassword, err := utils.RandomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := models.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"username": pseudonym,
+		"password": passwordHash,
+		"name":     displayName,
+		"phone":    "",
+		"email":    "",
+		"avatar":   "",
+		"remark":   "",
+		"status":   "erased",
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	// 尚未开始的预约取消并释放时间段，避免对方继续等待一个已注销的账户
+	if result.releasedSlots, err = cancelDepartedUserAppointments(tx, user.ID, "用户账户已注销", time.Now()); err != nil {
+		return nil, err
+	}
+
+	// 学生保留专业、年级和入学/毕业日期用于统计，班级和宿舍范围过小，可识别个人
+	if err := tx.Unscoped().Model(&models.Student{}).Where("user_id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"student_id": "",
+		"class_name": "",
+		"dormitory":  "",
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Model(&models.Counselor{}).Where("user_id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"employee_id":     "",
+		"introduction":    "",
+		"office_location": "",
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	if !retained[retainAppointments] {
+		if err := tx.Unscoped().Model(&models.Appointment{}).Where("user_id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"username": pseudonym,
+			"reason":   "",
+			"notes":    "",
+		}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Unscoped().Model(&models.Appointment{}).Where("counselor_id = ?", user.ID).
+			UpdateColumn("counselor_name", displayName).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.WaitlistEntry{}).Where("user_id = ?", user.ID).
+			UpdateColumn("reason", "").Error; err != nil {
+			return nil, err
+		}
+		// 变更原因由学生或咨询师填写（取消、拒绝、改约等），系统生成的原因不含个人信息，予以保留
+		if err := tx.Model(&models.AppointmentStatusHistory{}).
+			Where("(actor_id = ? OR appointment_id IN (?)) AND actor_role <> ?", user.ID,
+				tx.Unscoped().Model(&models.Appointment{}).Select("id").Where("user_id = ?", user.ID),
+				models.AppointmentActorSystem).
+			UpdateColumn("reason", "").Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.BookingRestriction{}).Where("user_id = ?", user.ID).
+			UpdateColumn("lift_note", "").Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Model(&models.ErasureRequest{}).Where("user_id = ?", user.ID).
+		UpdateColumn("reason", "").Error; err != nil {
+		return nil, err
+	}
+
+	// 账户注销后退出所有候补，为其保留的时间段重新开放
+	var offers []models.WaitlistEntry
+	if err := tx.Where("user_id = ? AND status = ?", user.ID, models.WaitlistOffered).Find(&offers).Error; err != nil {
+		return nil, err
+	}
+	for i := range offers {
+		if err := releaseHeldSlot(tx, &offers[i]); err != nil {
+			return nil, err
+		}
+		if offers[i].OfferedSlotID != nil {
+			result.releasedSlots = append(result.releasedSlots, *offers[i].OfferedSlotID)
+		}
+	}
+	if err := tx.Model(&models.WaitlistEntry{}).Where("user_id = ? AND status IN ?", user.ID, openWaitlistStatuses).
+		UpdateColumn("status", models.WaitlistCancelled).Error; err != nil {
+		return nil, err
+	}
+	if !retained[retainExamRecords] {
+		if err := tx.Model(&models.ExamRecord{}).Where("user_id = ?", user.ID).
+			UpdateColumn("feedback", "").Error; err != nil {
+			return nil, err
+		}
+	}
+	if !retained[retainFeedback] {
+		if err := tx.Model(&models.Feedback{}).Where("user_id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"title":   "",
+			"content": "",
+			"reply":   "",
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	if !retained[retainLoginAttempts] {
+		if err := tx.Model(&models.LoginAttempt{}).Where("user_id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"username":   pseudonym,
+			"client_ip":  "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// 与统计无关的凭据、会话和临时数据直接删除
+	for _, model := range []interface{}{
+		&models.Token{}, &models.PasswordReset{}, &models.TwoFactor{}, &models.RecoveryCode{},
+		&models.PasswordHistory{}, &models.ContactVerification{}, &models.ExternalIdentity{},
+		&models.CalendarFeed{}, &models.Notification{},
+	} {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var exports []models.DataExport
+	if err := tx.Where("user_id = ?", user.ID).Find(&exports).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range exports {
+		if e.StorageKey != "" {
+			result.exportKeys = append(result.exportKeys, e.StorageKey)
+		}
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.DataExport{}).Error; err != nil {
+		return nil, err
+	}
+
+	// 档案与用户一并软删除，ID 保留以维持统计关联
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Student{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Counselor{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&models.User{}, user.ID).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cleanupErasedFiles 删除头像和导出包文件，文件删除失败只记录日志
+func cleanupErasedFiles(result *erasureResult) {
+	deleteAvatarFiles(result.avatar)
+	for _, key := range result.exportKeys {
+		if err := utils.PrivateStorage().Delete(key); err != nil {
+			log.Printf("删除数据导出文件失败: key=%s err=%v", key, err)
+		}
+	}
+}
+
+// retainedList 将保留类别转换为逗号分隔的字符串
+func retainedList(retained map[string]bool) string {
+	var list []string
+	for _, c := range []string{retainAppointments, retainExamRecords, retainFeedback, retainLoginAttempts} {
+		if retained[c] {
+			list = append(list, c)
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// @Summary 申请删除个人数据
+// @Description 提交后由管理员审核，通过后账户被注销，可识别身份的数据被清除或替换，依法需保留的记录除外
+// @Tags 个人中心
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body ErasureRequestBody false "申请理由"
+// @Success 200 {object} map[string]interface{} "申请已提交"
+// @Failure 409 {object} map[string]interface{} "已有待审核的申请"
+// @Router /users/me/erasure [post]
+func RequestErasure(c *gin.Context) {
+	var req ErasureRequestBody
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	userID := currentUserID(c)
+	var pending int64
+	config.DB.Model(&models.ErasureRequest{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.ErasurePending, models.ErasureFailed}).
+		Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "已有处理中的删除申请"})
+		return
+	}
+
+	request := models.ErasureRequest{UserID: userID, Status: models.ErasurePending, Reason: req.Reason}
+	if err := config.DB.Create(&request).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交申请失败"})
+		return
+	}
+	writeAudit(config.DB, c, &userID, auditErasureRequested, "erasure_request", request.ID, "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "申请已提交，等待管理员审核", "request": request})
+}
+
+// @Summary 查看本人的数据删除申请
+// @Tags 个人中心
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "申请列表"
+// @Router /users/me/erasure [get]
+func GetMyErasureRequests(c *gin.Context) {
+	var requests []models.ErasureRequest
+	if err := config.DB.Where("user_id = ?", currentUserID(c)).Order("created_at DESC").
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取申请失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// @Summary 数据删除申请列表
+// @Tags 数据保护
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "状态：pending/rejected/completed/failed"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "申请列表"
+// @Router /erasure-requests [get]
+func GetErasureRequests(c *gin.Context) {
+	query := config.DB.Model(&models.ErasureRequest{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取申请列表失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var requests []models.ErasureRequest
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&requests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取申请列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      requests,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// findErasureRequest 按路径参数查询删除申请
+func findErasureRequest(c *gin.Context) (*models.ErasureRequest, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的申请ID"})
+		return nil, false
+	}
+	var request models.ErasureRequest
+	if err := config.DB.First(&request, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+		return nil, false
+	}
+	return &request, true
+}
+
+// @Summary 批准并执行数据删除申请
+// @Description 批准后立即执行：注销账户并对其在各表中的身份信息做假名化处理，执行失败时可再次调用重试
+// @Tags 数据保护
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "申请ID"
+// @Param data body ReviewErasureRequest false "审核意见"
+// @Success 200 {object} map[string]interface{} "执行完成"
+// @Failure 409 {object} map[string]interface{} "申请已处理"
+// @Router /erasure-requests/{id}/approve [post]
+func ApproveErasureRequest(c *gin.Context) {
+	var req ReviewErasureRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	request, ok := findErasureRequest(c)
+	if !ok {
+		return
+	}
+	if request.Status != models.ErasurePending && request.Status != models.ErasureFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "申请已处理"})
+		return
+	}
+
+	reviewerID := currentUserID(c)
+	if request.UserID == reviewerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能审核自己的申请"})
+		return
+	}
+
+	retained := retainedCategories()
+	now := time.Now()
+	var result *erasureResult
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 以状态作为条件更新，防止并发重复执行
+		claim := tx.Model(&models.ErasureRequest{}).
+			Where("id = ? AND status IN ?", request.ID, []string{models.ErasurePending, models.ErasureFailed}).
+			Updates(map[string]interface{}{
+				"status":       models.ErasureCompleted,
+				"reviewer_id":  reviewerID,
+				"review_note":  req.Note,
+				"reviewed_at":  &now,
+				"retained":     retainedList(retained),
+				"completed_at": &now,
+				"error":        "",
+			})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return errErasureNotAllowed
+		}
+
+		var user models.User
+		if err := tx.First(&user, request.UserID).Error; err != nil {
+			return err
+		}
+		var err error
+		result, err = eraseUserData(tx, &user, retained)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, errErasureNotAllowed):
+		c.JSON(http.StatusConflict, gin.H{"error": "申请已处理"})
+		return
+	case err != nil:
+		log.Printf("执行数据删除失败: request_id=%d user_id=%d err=%v", request.ID, request.UserID, err)
+		config.DB.Model(request).Updates(map[string]interface{}{
+			"status":      models.ErasureFailed,
+			"reviewer_id": reviewerID,
+			"reviewed_at": &now,
+			"error":       "执行失败，可重试",
+		})
+		writeAudit(config.DB, c, &reviewerID, auditErasureFailed, "erasure_request", request.ID, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "执行数据删除失败，可稍后重试"})
+		return
+	}
+
+	cleanupErasedFiles(result)
+	for _, slotID := range result.releasedSlots {
+		promoteWaitlist(slotID)
+	}
+	writeAudit(config.DB, c, &reviewerID, auditErasureCompleted, "erasure_request", request.ID,
+		fmt.Sprintf("user_id=%d retained=%s", request.UserID, retainedList(retained)))
+
+	config.DB.First(request, request.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "已执行数据删除", "request": request})
+}
+
+// @Summary 驳回数据删除申请
+// @Tags 数据保护
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "申请ID"
+// @Param data body ReviewErasureRequest true "驳回理由"
+// @Success 200 {object} map[string]interface{} "已驳回"
+// @Failure 409 {object} map[string]interface{} "申请已处理"
+// @Router /erasure-requests/{id}/reject [post]
+func RejectErasureRequest(c *gin.Context) {
+	var req ReviewErasureRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Note) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写驳回理由"})
+		return
+	}
+
+	request, ok := findErasureRequest(c)
+	if !ok {
+		return
+	}
+
+	reviewerID := currentUserID(c)
+	now := time.Now()
+	result := config.DB.Model(&models.ErasureRequest{}).
+		Where("id = ? AND status = ?", request.ID, models.ErasurePending).
+		Updates(map[string]interface{}{
+			"status":      models.ErasureRejected,
+			"reviewer_id": reviewerID,
+			"review_note": req.Note,
+			"reviewed_at": &now,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "驳回申请失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "申请已处理"})
+		return
+	}
+	writeAudit(config.DB, c, &reviewerID, auditErasureRejected, "erasure_request", request.ID, req.Note)
+
+	config.DB.First(request, request.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "已驳回", "request": request})
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID 获取当前登录用户ID（由JWTMiddleware写入上下文）
+func currentUserID(c *gin.Context) uint {
+	return c.GetUint("userID")
+}
+
+// currentUserRole 获取当前登录用户角色
+func currentUserRole(c *gin.Context) string {
+	return c.GetString("userRole")
+}
+
+// parseIDParam 解析路径中的数字ID参数
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// 分页默认值
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination 解析分页参数 page/page_size，非法值使用默认值
+func parsePagination(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize
+}
+
+// notifyUser 通过用户已绑定的联系方式发送通知，优先使用邮箱；发送失败只记录日志
+func notifyUser(user *models.User, subject, body string) {
+	msg := utils.Message{Subject: subject, Body: body}
+	switch {
+	case user.Email != "":
+		msg.Channel, msg.To = utils.ChannelEmail, user.Email
+	case user.Phone != "":
+		msg.Channel, msg.To = utils.ChannelSMS, user.Phone
+	default:
+		log.Printf("用户未绑定联系方式，无法发送通知: user_id=%d subject=%s", user.ID, subject)
+		return
+	}
+	if err := utils.Notify(msg); err != nil {
+		log.Printf("发送通知失败: user_id=%d channel=%s err=%v", user.ID, msg.Channel, err)
+	}
+}
+
+// hashSecretToken 计算随机令牌（下载链接、订阅地址等）的哈希，数据库只保存哈希
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
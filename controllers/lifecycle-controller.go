@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultArchiveGrace 预计毕业日期之后保留账户的默认时长，可通过 STUDENT_ARCHIVE_GRACE 配置
+const defaultArchiveGrace = 30 * 24 * time.Hour
+
+// RunArchiveRequest 手动执行毕业归档请求结构
+type RunArchiveRequest struct {
+	DryRun bool `json:"dry_run"` // 仅返回将被归档的用户，不做修改
+}
+
+// ReactivateStudentRequest 重新激活学生请求结构
+type ReactivateStudentRequest struct {
+	GraduationDate string  `json:"graduation_date" binding:"required"` // 新的预计毕业日期，格式 2006-01-02
+	Major          *string `json:"major" binding:"omitempty,max=100"`
+	Grade          *string `json:"grade" binding:"omitempty,max=20"`
+	ClassName      *string `json:"class_name" binding:"omitempty,max=50"`
+}
+
+// errNotStudent 目标用户不是学生或没有学生档案
+var errNotStudent = errors.New("not a student")
+
+// archiveStudent 将学生归档：修改账户状态、注销所有会话、取消未开始的预约并释放时间段
+// 返回被取消的预约数量
+func archiveStudent(tx *gorm.DB, userID uint, now time.Time) (int64, error) {
+	result := tx.Model(&models.Student{}).Where("user_id = ?", userID).Update("archived_at", &now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, errNotStudent
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("status", "archived").Error; err != nil {
+		return 0, err
+	}
+	if err := revokeUserTokens(tx, userID); err != nil {
+		return 0, err
+	}
+
+	var appointments []models.Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status IN ? AND start_time > ?", userID,
+			[]string{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}, now).
+		Find(&appointments).Error; err != nil {
+		return 0, err
+	}
+	for i := range appointments {
+		if err := transitionAppointment(tx, &appointments[i], models.AppointmentStatusCancelledByStudent,
+			nil, models.AppointmentActorSystem, "学生账户已归档", now); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(appointments)), nil
+}
+
+// graduatedStudentIDs 查询预计毕业日期已超过保留期且尚未归档的学生用户ID
+func graduatedStudentIDs(now time.Time) ([]uint, error) {
+	cutoff := now.Add(-utils.DurationFromEnv("STUDENT_ARCHIVE_GRACE", defaultArchiveGrace))
+	var ids []uint
+	// 未填写预计毕业日期时存储为零值（0001-01-01），不参与归档
+	err := config.DB.Model(&models.User{}).
+		Joins("JOIN students ON students.user_id = users.id AND students.deleted_at IS NULL").
+		Where("users.role = ? AND users.status <> ?", "student", "archived").
+		Where("students.graduation_date > ? AND students.graduation_date <= ?", time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), cutoff).
+		Order("users.id").
+		Pluck("users.id", &ids).Error
+	return ids, err
+}
+
+// ArchiveGraduatedStudents 归档所有已毕业的学生，每个学生在独立的事务中处理，返回成功归档的用户ID
+func ArchiveGraduatedStudents(now time.Time) ([]uint, error) {
+	ids, err := graduatedStudentIDs(now)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		var cancelled int64
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			cancelled, err = archiveStudent(tx, id, now)
+			return err
+		})
+		if err != nil {
+			log.Printf("归档学生失败: user_id=%d err=%v", id, err)
+			continue
+		}
+		if cancelled > 0 {
+			log.Printf("学生 user_id=%d 已归档，取消未开始的预约 %d 个", id, cancelled)
+		}
+		archived = append(archived, id)
+	}
+	return archived, nil
+}
+
+// RunStudentArchiveJob 毕业归档定时任务
+func RunStudentArchiveJob() {
+	archived, err := ArchiveGraduatedStudents(time.Now())
+	if err != nil {
+		log.Printf("毕业归档任务失败: %v", err)
+		return
+	}
+	if len(archived) > 0 {
+		log.Printf("毕业归档任务完成，归档学生 %d 名", len(archived))
+	}
+}
+
+// @Summary 执行毕业归档
+// @Description 立即归档预计毕业日期已超过保留期（STUDENT_ARCHIVE_GRACE，默认30天）的学生，与定时任务逻辑相同
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body RunArchiveRequest false "是否试运行"
+// @Success 200 {object} map[string]interface{} "归档结果"
+// @Router /users/archive-graduated [post]
+func RunStudentArchive(c *gin.Context) {
+	var req RunArchiveRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	var (
+		ids []uint
+		err error
+	)
+	if req.DryRun {
+		ids, err = graduatedStudentIDs(time.Now())
+	} else {
+		ids, err = ArchiveGraduatedStudents(time.Now())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "执行毕业归档失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":  req.DryRun,
+		"count":    len(ids),
+		"user_ids": ids,
+	})
+}
+
+// @Summary 归档学生
+// @Description 手动归档单个学生：账户不可登录、所有会话失效、未开始的预约被取消，咨询记录仍保留
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "归档成功"
+// @Failure 400 {object} map[string]interface{} "用户不是学生"
+// @Failure 409 {object} map[string]interface{} "用户已归档"
+// @Router /users/{id}/archive [post]
+func ArchiveStudent(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.Role != "student" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能归档学生用户"})
+		return
+	}
+	if user.Status == "archived" {
+		c.JSON(http.StatusConflict, gin.H{"error": "用户已归档"})
+		return
+	}
+
+	var cancelled int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cancelled, err = archiveStudent(tx, user.ID, time.Now())
+		return err
+	})
+	if errors.Is(err, errNotStudent) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该用户没有学生档案"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "归档失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "归档成功", "cancelled_appointments": cancelled})
+}
+
+// @Summary 重新激活学生
+// @Description 已归档的学生继续深造时重新激活账户，需设置新的预计毕业日期，避免再次被自动归档
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Param data body ReactivateStudentRequest true "新的学籍信息"
+// @Success 200 {object} map[string]interface{} "激活成功"
+// @Failure 400 {object} map[string]interface{} "预计毕业日期无效"
+// @Failure 409 {object} map[string]interface{} "用户未归档"
+// @Router /users/{id}/reactivate [post]
+func ReactivateStudent(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req ReactivateStudentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+	graduation, err := parseDate(req.GraduationDate)
+	if err != nil || !graduation.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "预计毕业日期需为今天之后的日期，格式 YYYY-MM-DD"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.Status != "archived" {
+		c.JSON(http.StatusConflict, gin.H{"error": "用户未归档，无需激活"})
+		return
+	}
+
+	profile := map[string]interface{}{
+		"graduation_date": graduation,
+		"archived_at":     nil,
+	}
+	if req.Major != nil {
+		profile["major"] = *req.Major
+	}
+	if req.Grade != nil {
+		profile["grade"] = *req.Grade
+	}
+	if req.ClassName != nil {
+		profile["class_name"] = *req.ClassName
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Student{}).Where("user_id = ?", user.ID).Updates(profile).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("status", "active").Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "激活失败"})
+		return
+	}
+
+	preloadProfiles(config.DB).First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "激活成功", "user": user})
+}
+
+// @Summary 查看用户的咨询历史
+// @Description 按时间倒序返回用户的全部预约记录，包括已归档和已删除的用户，仅限有咨询记录查看权限的工作人员
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "预约记录列表"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Router /users/{id}/appointments [get]
+func GetUserCounselingHistory(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Unscoped().First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	query := config.DB.Model(&models.Appointment{}).Where("user_id = ?", user.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取咨询历史失败"})
+		return
+	}
+	var appointments []models.Appointment
+	if err := query.Order("start_time DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&appointments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取咨询历史失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      appointments,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 登录失败保护默认配置
+const (
+	defaultLoginMaxFailures     = 5                // 触发锁定的连续失败次数
+	defaultLoginLockout         = 15 * time.Minute // 锁定时长，到期自动解锁
+	defaultLoginFailureWindow   = 15 * time.Minute // 失败计数窗口，距上次失败超过该时长后重新计数
+	defaultLoginDelayAfter      = 3                // 失败达到该次数后开始渐进延迟
+	loginDelayBase              = time.Second      // 渐进延迟的初始时长，之后每次失败翻倍
+	loginDelayMax               = time.Minute      // 渐进延迟上限
+	loginAttemptReasonPassword  = "bad_password"
+	loginAttemptReasonUnknown   = "unknown_user"
+	loginAttemptReasonLocked    = "locked"
+	loginAttemptReasonThrottle  = "throttled"
+	loginAttemptReasonInactive  = "inactive"
+	loginAttemptReasonTwoFactor = "bad_second_factor"
+)
+
+// recordLoginAttempt 写入登录审计记录，写入失败不影响登录流程
+func recordLoginAttempt(c *gin.Context, userID *uint, username string, success bool, reason string) {
+	config.DB.Create(&models.LoginAttempt{
+		UserID:    userID,
+		Username:  username,
+		Success:   success,
+		Reason:    reason,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// loginBlocked 判断账户当前是否禁止尝试登录，返回原因和需等待的时长
+func loginBlocked(user *models.User, now time.Time) (string, time.Duration) {
+	if user.LockedUntil != nil && user.LockedUntil.After(now) {
+		return loginAttemptReasonLocked, user.LockedUntil.Sub(now)
+	}
+	if user.LastFailedLogin == nil || now.Sub(*user.LastFailedLogin) > utils.DurationFromEnv("LOGIN_FAILURE_WINDOW", defaultLoginFailureWindow) {
+		return "", 0
+	}
+	if wait := loginDelay(user.FailedLogins) - now.Sub(*user.LastFailedLogin); wait > 0 {
+		return loginAttemptReasonThrottle, wait
+	}
+	return "", 0
+}
+
+// respondLoginBlocked 账户被锁定或处于渐进延迟期间时的响应
+func respondLoginBlocked(c *gin.Context, reason string, wait time.Duration) {
+	retryAfter := int64(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	if reason == loginAttemptReasonLocked {
+		c.JSON(http.StatusLocked, gin.H{"error": "登录失败次数过多，账户已被临时锁定", "retry_after": retryAfter})
+	} else {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "登录尝试过于频繁，请稍后再试", "retry_after": retryAfter})
+	}
+}
+
+// respondLoginFailure 密码或二次验证错误时累加失败次数，达到上限时返回锁定响应，否则返回 401
+func respondLoginFailure(c *gin.Context, userID uint, message string) {
+	lockedUntil, err := registerLoginFailure(userID)
+	if err == nil && lockedUntil != nil {
+		c.JSON(http.StatusLocked, gin.H{
+			"error":       "登录失败次数过多，账户已被临时锁定",
+			"retry_after": int64(math.Ceil(time.Until(*lockedUntil).Seconds())),
+		})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// loginDelay 根据连续失败次数计算下一次尝试前需等待的时长
+func loginDelay(failures int) time.Duration {
+	after := utils.IntFromEnv("LOGIN_DELAY_AFTER", defaultLoginDelayAfter)
+	if failures < after {
+		return 0
+	}
+	delay := loginDelayBase * time.Duration(math.Pow(2, float64(failures-after)))
+	if delay > loginDelayMax || delay <= 0 {
+		return loginDelayMax
+	}
+	return delay
+}
+
+// registerLoginFailure 累加登录失败次数，达到上限时锁定账户，返回锁定截止时间（未锁定时为nil）
+func registerLoginFailure(userID uint) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定用户行，避免并发失败请求丢失计数
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		failures := user.FailedLogins + 1
+		window := utils.DurationFromEnv("LOGIN_FAILURE_WINDOW", defaultLoginFailureWindow)
+		if user.LastFailedLogin == nil || now.Sub(*user.LastFailedLogin) > window ||
+			(user.LockedUntil != nil && !user.LockedUntil.After(now)) {
+			// 窗口已过或上一次锁定已到期，重新计数
+			failures = 1
+		}
+
+		updates := map[string]interface{}{"failed_logins": failures, "last_failed_login": &now}
+		if failures >= utils.IntFromEnv("LOGIN_MAX_FAILURES", defaultLoginMaxFailures) {
+			until := now.Add(utils.DurationFromEnv("LOGIN_LOCKOUT_DURATION", defaultLoginLockout))
+			updates["locked_until"] = &until
+			lockedUntil = &until
+		}
+		// 使用 UpdateColumns 跳过 BeforeSave，避免密码哈希被重复加密
+		return tx.Model(&user).UpdateColumns(updates).Error
+	})
+	return lockedUntil, err
+}
+
+// clearLoginFailures 清除登录失败计数和锁定状态
+func clearLoginFailures(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"failed_logins":     0,
+		"last_failed_login": nil,
+		"locked_until":      nil,
+	}).Error
+}
+
+// @Summary 获取被锁定的账户
+// @Description 列出当前因登录失败次数过多而被临时锁定的账户
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "被锁定的账户列表"
+// @Router /users/locked [get]
+func GetLockedUsers(c *gin.Context) {
+	var users []models.User
+	if err := config.DB.Where("locked_until > ?", time.Now()).
+		Order("locked_until DESC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取锁定账户失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// @Summary 解锁账户
+// @Description 管理员手动解除账户的登录锁定并清零失败计数
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "解锁成功"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Failure 403 {object} map[string]interface{} "无权管理该用户"
+// @Router /users/{id}/unlock [post]
+func UnlockUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+		return
+	}
+
+	if err := clearLoginFailures(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "解锁成功"})
+}
+
+// @Summary 获取用户登录记录
+// @Description 分页查询指定用户的登录尝试审计记录（含IP和用户代理）
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20"
+// @Param success query bool false "按是否成功筛选"
+// @Success 200 {object} map[string]interface{} "登录记录"
+// @Router /users/{id}/login-attempts [get]
+func GetUserLoginAttempts(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	query := config.DB.Model(&models.LoginAttempt{}).Where("user_id = ?", id)
+	switch c.Query("success") {
+	case "true":
+		query = query.Where("success = ?", true)
+	case "false":
+		query = query.Where("success = ?", false)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录记录失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var attempts []models.LoginAttempt
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      attempts,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
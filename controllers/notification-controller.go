@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InAppNotifier 站内通知渠道，将通知写入数据库，Message.To 为接收人的用户ID
+type InAppNotifier struct{}
+
+// Send 写入一条站内通知
+func (InAppNotifier) Send(msg utils.Message) error {
+	userID, err := strconv.ParseUint(msg.To, 10, 64)
+	if err != nil || userID == 0 {
+		return fmt.Errorf("无效的站内通知接收人: %q", msg.To)
+	}
+	return config.DB.Create(&models.Notification{
+		UserID: uint(userID),
+		Title:  msg.Subject,
+		Body:   msg.Body,
+	}).Error
+}
+
+// @Summary 我的站内通知
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param unread query bool false "只看未读"
+// @Param page query int false "页码"
+// @Param page_size query int false "每页数量"
+// @Success 200 {object} map[string]interface{} "通知列表和未读数量"
+// @Router /users/me/notifications [get]
+func GetMyNotifications(c *gin.Context) {
+	userID := currentUserID(c)
+	page, pageSize := parsePagination(c)
+
+	query := config.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unread, _ := strconv.ParseBool(c.Query("unread")); unread {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知失败"})
+		return
+	}
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知失败"})
+		return
+	}
+	var unreadCount int64
+	if err := config.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&unreadCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通知失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      notifications,
+		"total":     total,
+		"unread":    unreadCount,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// @Summary 标记通知为已读
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "通知ID"
+// @Success 200 {object} map[string]interface{} "已标记"
+// @Failure 404 {object} map[string]interface{} "通知不存在"
+// @Router /users/me/notifications/{id}/read [post]
+func MarkNotificationRead(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的通知ID"})
+		return
+	}
+
+	var notification models.Notification
+	if err := config.DB.Where("id = ? AND user_id = ?", id, currentUserID(c)).First(&notification).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知不存在"})
+		return
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := config.DB.Model(&notification).Update("read_at", &now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "标记已读失败"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已标记为已读", "notification": notification})
+}
+
+// @Summary 全部标记为已读
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "已标记的数量"
+// @Router /users/me/notifications/read-all [post]
+func MarkAllNotificationsRead(c *gin.Context) {
+	result := config.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", currentUserID(c)).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "标记已读失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已全部标记为已读", "count": result.RowsAffected})
+}
@@ -0,0 +1,442 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 找回密码相关默认配置
+const (
+	resetCodeLength        = 6                // 验证码位数
+	defaultResetCodeTTL    = 15 * time.Minute // 验证码默认有效期
+	defaultResetMaxAttempt = 5                // 单个验证码允许的最大校验失败次数
+	resetResendInterval    = time.Minute      // 同一用户两次申请验证码的最小间隔
+	passwordChangeTokenTTL = 10 * time.Minute // 密码过期时修改密码令牌的有效期
+)
+
+// ForgotPasswordRequest 申请找回密码请求结构
+type ForgotPasswordRequest struct {
+	Account string `json:"account" binding:"required"` // 用户名、邮箱或手机号
+	Channel string `json:"channel"`                    // 可选，email/sms，默认优先邮件
+}
+
+// ResetPasswordRequest 重置密码请求结构
+type ResetPasswordRequest struct {
+	Account     string `json:"account" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePasswordRequest 修改密码请求结构
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangeExpiredPasswordRequest 密码过期时修改密码请求结构
+type ChangeExpiredPasswordRequest struct {
+	ChangeToken string `json:"change_token" binding:"required"` // 登录时返回的 password_change_token
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// errInvalidResetCode 验证码错误、过期或已使用
+var errInvalidResetCode = errors.New("invalid reset code")
+
+// findUserByAccount 按用户名、邮箱或手机号查找用户
+func findUserByAccount(tx *gorm.DB, account string) (*models.User, error) {
+	var user models.User
+	if err := tx.Where("username = ? OR (email <> '' AND email = ?) OR (phone <> '' AND phone = ?)",
+		account, account, account).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// @Summary 申请找回密码
+// @Description 向账户绑定的邮箱或手机发送一次性验证码；无论账户是否存在均返回相同结果
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body ForgotPasswordRequest true "账户信息"
+// @Success 200 {object} map[string]interface{} "验证码已发送"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Router /password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if req.Channel != "" && req.Channel != utils.ChannelEmail && req.Channel != utils.ChannelSMS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的发送渠道"})
+		return
+	}
+
+	// 统一的返回结果，避免通过该接口探测账户是否存在
+	ok := gin.H{"message": "如果账户存在，验证码已发送至绑定的邮箱或手机"}
+
+	user, err := findUserByAccount(config.DB, req.Account)
+	if err != nil || user.Status != "active" {
+		c.JSON(http.StatusOK, ok)
+		return
+	}
+
+	msg := utils.Message{Channel: req.Channel}
+	switch {
+	case (msg.Channel == "" || msg.Channel == utils.ChannelEmail) && user.Email != "":
+		msg.Channel, msg.To = utils.ChannelEmail, user.Email
+	case (msg.Channel == "" || msg.Channel == utils.ChannelSMS) && user.Phone != "":
+		msg.Channel, msg.To = utils.ChannelSMS, user.Phone
+	default:
+		c.JSON(http.StatusOK, ok)
+		return
+	}
+
+	// 限制重复申请频率
+	var recent int64
+	config.DB.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-resetResendInterval)).
+		Count(&recent)
+	if recent > 0 {
+		c.JSON(http.StatusOK, ok)
+		return
+	}
+
+	code, err := utils.RandomDigits(resetCodeLength)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成验证码失败"})
+		return
+	}
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成验证码失败"})
+		return
+	}
+
+	ttl := utils.DurationFromEnv("PASSWORD_RESET_CODE_TTL", defaultResetCodeTTL)
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 新验证码生效后，之前未使用的验证码全部作废
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			CodeHash:  string(codeHash),
+			Channel:   msg.Channel,
+			ExpiresAt: now.Add(ttl),
+			ClientIP:  c.ClientIP(),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成验证码失败"})
+		return
+	}
+
+	msg.Subject = "找回密码验证码"
+	msg.Body = fmt.Sprintf("您正在找回心理健康系统账户 %s 的密码，验证码为 %s，%d 分钟内有效。如非本人操作请忽略。",
+		user.Username, code, int(ttl.Minutes()))
+	if err := utils.Notify(msg); err != nil {
+		log.Printf("发送找回密码验证码失败: user_id=%d channel=%s err=%v", user.ID, msg.Channel, err)
+	}
+
+	c.JSON(http.StatusOK, ok)
+}
+
+// @Summary 重置密码
+// @Description 使用找回密码验证码设置新密码，成功后该用户所有登录会话失效
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body ResetPasswordRequest true "验证码和新密码"
+// @Success 200 {object} map[string]interface{} "密码重置成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或验证码无效"
+// @Router /password/reset [post]
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	user, err := findUserByAccount(config.DB, req.Account)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误或已过期"})
+		return
+	}
+
+	violations, err := checkNewPassword(config.DB, user.ID, user.Username, req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+		return
+	}
+
+	maxAttempts := utils.IntFromEnv("PASSWORD_RESET_MAX_ATTEMPTS", defaultResetMaxAttempt)
+	var mismatch bool
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定验证码记录，保证验证码只能被使用一次
+		var reset models.PasswordReset
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+			Order("created_at DESC").First(&reset).Error; err != nil {
+			return errInvalidResetCode
+		}
+
+		now := time.Now()
+		if bcrypt.CompareHashAndPassword([]byte(reset.CodeHash), []byte(req.Code)) != nil {
+			// 记录失败次数，超过上限后验证码作废；失败次数需要提交，因此不返回错误
+			updates := map[string]interface{}{"attempts": reset.Attempts + 1}
+			if reset.Attempts+1 >= maxAttempts {
+				updates["used_at"] = &now
+			}
+			mismatch = true
+			return tx.Model(&reset).Updates(updates).Error
+		}
+
+		if err := tx.Model(&reset).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		if err := setUserPassword(tx, user.ID, req.NewPassword); err != nil {
+			return err
+		}
+		// 通过验证码证明了账户归属，同时解除登录锁定
+		if err := clearLoginFailures(tx, user.ID); err != nil {
+			return err
+		}
+		// 密码重置后注销所有已登录会话
+		return revokeUserTokens(tx, user.ID)
+	})
+
+	switch {
+	case errors.Is(err, errInvalidResetCode) || (err == nil && mismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误或已过期"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码重置成功，请使用新密码登录"})
+}
+
+// passwordPolicyError 新密码不符合策略时的响应
+func passwordPolicyError(violations []string) gin.H {
+	return gin.H{"error": "密码不符合安全策略", "details": violations}
+}
+
+// checkNewPassword 校验新密码是否符合密码策略，userID 非0时同时检查是否与近期使用过的密码相同
+func checkNewPassword(tx *gorm.DB, userID uint, username, password string) ([]string, error) {
+	policy := utils.CurrentPasswordPolicy()
+	violations := policy.Validate(password, username)
+	if userID == 0 || policy.HistorySize == 0 {
+		return violations, nil
+	}
+
+	var hashes []string
+	if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").Limit(policy.HistorySize).
+		Pluck("password_hash", &hashes).Error; err != nil {
+		return nil, err
+	}
+	// 历史记录上线前设置的密码不在历史表中，同时与当前密码比较
+	var current string
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Pluck("password", &current).Error; err != nil {
+		return nil, err
+	}
+	hashes = append(hashes, current)
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			violations = append(violations, fmt.Sprintf("不能使用最近%d次用过的密码", policy.HistorySize))
+			break
+		}
+	}
+	return violations, nil
+}
+
+// setUserPassword 加密并保存用户的新密码，同时记录到历史密码
+func setUserPassword(tx *gorm.DB, userID uint, password string) error {
+	hashed, err := models.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	// 使用 UpdateColumns 跳过 BeforeSave，避免密码哈希被重复加密
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"password":            hashed,
+		"password_changed_at": &now,
+	}).Error; err != nil {
+		return err
+	}
+	return recordPasswordHistory(tx, userID, hashed)
+}
+
+// recordPasswordHistory 记录历史密码哈希，只保留策略要求的条数
+func recordPasswordHistory(tx *gorm.DB, userID uint, hash string) error {
+	size := utils.CurrentPasswordPolicy().HistorySize
+	if size == 0 {
+		return nil
+	}
+	if err := tx.Create(&models.PasswordHistory{UserID: userID, PasswordHash: hash}).Error; err != nil {
+		return err
+	}
+	keep := tx.Model(&models.PasswordHistory{}).Select("id").Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").Limit(size)
+	return tx.Where("user_id = ? AND id NOT IN (?)", userID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// passwordExpiredResponse 员工角色密码超过最长有效期时返回修改密码令牌响应，未过期时返回nil
+func passwordExpiredResponse(user *models.User) (gin.H, error) {
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	if !utils.CurrentPasswordPolicy().Expired(user.Role, changedAt, time.Now()) {
+		return nil, nil
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Role, utils.TokenTypePasswordChange, time.Now().Add(passwordChangeTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"error":                 "密码已过期，请修改密码后重新登录",
+		"password_expired":      true,
+		"password_change_token": token,
+		"expires_in":            int64(passwordChangeTokenTTL.Seconds()),
+	}, nil
+}
+
+// @Summary 修改密码
+// @Description 已登录用户校验原密码后设置新密码，当前会话以外的登录会话全部失效
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body ChangePasswordRequest true "原密码和新密码"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 400 {object} map[string]interface{} "原密码错误或新密码不符合策略"
+// @Router /users/me/password [put]
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !user.ValidatePassword(req.OldPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "原密码错误"})
+		return
+	}
+
+	violations, err := checkNewPassword(config.DB, user.ID, user.Username, req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setUserPassword(tx, user.ID, req.NewPassword); err != nil {
+			return err
+		}
+		// 保留当前会话，注销其他设备上的会话
+		now := time.Now()
+		query := tx.Model(&models.Token{}).Where("user_id = ? AND is_revoked = ?", user.ID, false)
+		if family := c.GetString("tokenFamily"); family != "" {
+			query = query.Where("family_id <> ?", family)
+		} else {
+			query = query.Where("id <> ?", c.GetUint("tokenID"))
+		}
+		return query.Updates(map[string]interface{}{"is_revoked": true, "revoked_at": &now}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码修改成功"})
+}
+
+// @Summary 修改过期密码
+// @Description 登录时提示密码过期后，使用返回的修改密码令牌设置新密码，之后需重新登录
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body ChangeExpiredPasswordRequest true "修改密码令牌和新密码"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 400 {object} map[string]interface{} "新密码不符合策略"
+// @Failure 401 {object} map[string]interface{} "修改密码令牌无效或已过期"
+// @Router /password/expired [post]
+func ChangeExpiredPassword(c *gin.Context) {
+	var req ChangeExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	claims, err := utils.ParseToken(req.ChangeToken)
+	if err != nil || claims.Type != utils.TokenTypePasswordChange {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "修改密码令牌无效或已过期，请重新登录"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, claims.UserID).Error; err != nil || user.Status != "active" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "修改密码令牌无效或已过期，请重新登录"})
+		return
+	}
+	// 令牌签发后密码已被修改过，则令牌作废
+	if user.PasswordChangedAt != nil && user.PasswordChangedAt.Unix() > claims.IssuedAt {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "修改密码令牌无效或已过期，请重新登录"})
+		return
+	}
+
+	violations, err := checkNewPassword(config.DB, user.ID, user.Username, req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setUserPassword(tx, user.ID, req.NewPassword); err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码修改成功，请使用新密码登录"})
+}
@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 联系方式验证相关默认配置
+const (
+	defaultContactCodeTTL = 15 * time.Minute // 验证码默认有效期
+	contactResendInterval = time.Minute      // 同一渠道两次发送验证码的最小间隔
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9-]{5,20}$`)
+
+// contactFields 所有角色都可以修改的联系方式字段，非空的新值需要验证后才生效
+var contactFields = map[string]string{
+	"phone": utils.ChannelSMS,
+	"email": utils.ChannelEmail,
+}
+
+// profileEditableFields 各角色可自助修改的档案字段及其最大长度（0 表示不限）
+var profileEditableFields = map[string]map[string]int{
+	"student": {
+		"dormitory": 50,
+	},
+	"counselor": {
+		"introduction":    0,
+		"specialty":       200,
+		"office_location": 100,
+	},
+}
+
+// VerifyContactRequest 验证新手机号或邮箱请求结构
+type VerifyContactRequest struct {
+	Channel string `json:"channel" binding:"required,oneof=email sms"`
+	Code    string `json:"code" binding:"required"`
+}
+
+// @Summary 获取个人资料
+// @Description 返回当前用户信息及其学生或咨询师档案
+// @Tags 个人中心
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "用户信息"
+// @Router /users/me [get]
+func GetMyProfile(c *gin.Context) {
+	var user models.User
+	if err := config.DB.Preload("Student").Preload("Counselor").First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":            user,
+		"editable_fields": editableFields(user.Role),
+	})
+}
+
+// editableFields 返回角色可自助修改的字段列表
+func editableFields(role string) []string {
+	fields := make([]string, 0, len(contactFields)+len(profileEditableFields[role]))
+	for f := range contactFields {
+		fields = append(fields, f)
+	}
+	for f := range profileEditableFields[role] {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// @Summary 修改个人资料
+// @Description 仅可修改本角色允许的字段：学生可修改宿舍，咨询师可修改简介、专业领域和办公室位置；
+// @Description 修改手机号或邮箱时向新地址发送验证码，验证通过后才生效，提交空值可直接解除绑定
+// @Tags 个人中心
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body map[string]string true "要修改的字段"
+// @Success 200 {object} map[string]interface{} "修改成功，pending_verification 中为待验证的联系方式"
+// @Failure 400 {object} map[string]interface{} "包含不允许修改的字段或字段格式错误"
+// @Failure 409 {object} map[string]interface{} "手机号或邮箱已被使用"
+// @Router /users/me [put]
+func UpdateMyProfile(c *gin.Context) {
+	var req map[string]interface{}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	roleFields := profileEditableFields[user.Role]
+	profile := map[string]interface{}{}
+	contacts := map[string]string{}
+	for field, raw := range req {
+		value, ok := raw.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "字段 " + field + " 必须为字符串"})
+			return
+		}
+		value = strings.TrimSpace(value)
+
+		if _, isContact := contactFields[field]; isContact {
+			if msg := validateContact(field, value); msg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+			contacts[field] = value
+			continue
+		}
+
+		maxLen, allowed := roleFields[field]
+		if !allowed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不允许修改字段: " + field, "editable_fields": editableFields(user.Role)})
+			return
+		}
+		if maxLen > 0 && utf8.RuneCountInString(value) > maxLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("字段 %s 长度不能超过 %d", field, maxLen)})
+			return
+		}
+		profile[field] = value
+	}
+
+	var pending []gin.H
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(profile) > 0 {
+			var model interface{} = &models.Student{}
+			if user.Role == "counselor" {
+				model = &models.Counselor{}
+			}
+			result := tx.Model(model).Where("user_id = ?", user.ID).Updates(profile)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+
+		for field, value := range contacts {
+			current := user.Phone
+			if field == "email" {
+				current = user.Email
+			}
+			if value == current {
+				continue
+			}
+			// 解除绑定无需验证
+			if value == "" {
+				if err := tx.Model(&user).UpdateColumn(field, "").Error; err != nil {
+					return err
+				}
+				continue
+			}
+			phone, email := value, ""
+			if field == "email" {
+				phone, email = "", value
+			}
+			if err := checkUserUnique(tx, user.ID, "", phone, email); err != nil {
+				return err
+			}
+			sent, err := sendContactVerification(tx, user.ID, contactFields[field], value)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, gin.H{"channel": contactFields[field], "target": value, "sent": sent})
+		}
+		return nil
+	})
+
+	var conflict *errUserConflict
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未建立档案，请联系管理员"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改个人资料失败"})
+		return
+	}
+
+	config.DB.Preload("Student").Preload("Counselor").First(&user, user.ID)
+	resp := gin.H{"message": "修改成功", "user": user}
+	if len(pending) > 0 {
+		resp["pending_verification"] = pending
+		resp["message"] = "修改成功，新的联系方式需验证后生效"
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// validateContact 校验手机号或邮箱格式，返回错误提示
+func validateContact(field, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch field {
+	case "phone":
+		if !phonePattern.MatchString(value) {
+			return "手机号格式错误"
+		}
+	case "email":
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value || len(value) > 100 {
+			return "邮箱格式错误"
+		}
+	}
+	return ""
+}
+
+// sendContactVerification 生成验证码并发送到新的手机号或邮箱
+// 距上次发送不足间隔时间时不重复发送，返回 false
+func sendContactVerification(tx *gorm.DB, userID uint, channel, target string) (bool, error) {
+	var recent int64
+	if err := tx.Model(&models.ContactVerification{}).
+		Where("user_id = ? AND channel = ? AND target = ? AND used_at IS NULL AND created_at > ?",
+			userID, channel, target, time.Now().Add(-contactResendInterval)).
+		Count(&recent).Error; err != nil {
+		return false, err
+	}
+	if recent > 0 {
+		return false, nil
+	}
+
+	code, err := utils.RandomDigits(resetCodeLength)
+	if err != nil {
+		return false, err
+	}
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+
+	ttl := utils.DurationFromEnv("CONTACT_VERIFY_CODE_TTL", defaultContactCodeTTL)
+	now := time.Now()
+	// 同一渠道只保留最新的验证码
+	if err := tx.Model(&models.ContactVerification{}).
+		Where("user_id = ? AND channel = ? AND used_at IS NULL", userID, channel).
+		Update("used_at", &now).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Create(&models.ContactVerification{
+		UserID:    userID,
+		Channel:   channel,
+		Target:    target,
+		CodeHash:  string(codeHash),
+		ExpiresAt: now.Add(ttl),
+	}).Error; err != nil {
+		return false, err
+	}
+
+	msg := utils.Message{
+		Channel: channel,
+		To:      target,
+		Subject: "联系方式验证码",
+		Body:    fmt.Sprintf("您正在为心理健康系统账户绑定新的联系方式，验证码为 %s，%d 分钟内有效。如非本人操作请忽略。", code, int(ttl.Minutes())),
+	}
+	if err := utils.Notify(msg); err != nil {
+		log.Printf("发送联系方式验证码失败: user_id=%d channel=%s err=%v", userID, channel, err)
+	}
+	return true, nil
+}
+
+// @Summary 验证新的手机号或邮箱
+// @Description 提交发送到新地址的验证码，验证通过后新的手机号或邮箱生效
+// @Tags 个人中心
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body VerifyContactRequest true "渠道和验证码"
+// @Success 200 {object} map[string]interface{} "验证成功"
+// @Failure 400 {object} map[string]interface{} "验证码错误或已过期"
+// @Failure 409 {object} map[string]interface{} "手机号或邮箱已被使用"
+// @Router /users/me/contact/verify [post]
+func VerifyMyContact(c *gin.Context) {
+	var req VerifyContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	userID := currentUserID(c)
+	maxAttempts := utils.IntFromEnv("PASSWORD_RESET_MAX_ATTEMPTS", defaultResetMaxAttempt)
+	var mismatch bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var v models.ContactVerification
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND channel = ? AND used_at IS NULL AND expires_at > ?", userID, req.Channel, time.Now()).
+			Order("created_at DESC").First(&v).Error; err != nil {
+			return errInvalidResetCode
+		}
+
+		now := time.Now()
+		if bcrypt.CompareHashAndPassword([]byte(v.CodeHash), []byte(req.Code)) != nil {
+			updates := map[string]interface{}{"attempts": v.Attempts + 1}
+			if v.Attempts+1 >= maxAttempts {
+				updates["used_at"] = &now
+			}
+			mismatch = true
+			return tx.Model(&v).Updates(updates).Error
+		}
+
+		// 发送验证码后该地址可能已被其他用户绑定
+		column, phone, email := "phone", v.Target, ""
+		if v.Channel == utils.ChannelEmail {
+			column, phone, email = "email", "", v.Target
+		}
+		if err := checkUserUnique(tx, userID, "", phone, email); err != nil {
+			return err
+		}
+		if err := tx.Model(&v).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumn(column, v.Target).Error
+	})
+
+	var conflict *errUserConflict
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+		return
+	case errors.Is(err, errInvalidResetCode) || (err == nil && mismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误或已过期"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "验证成功，新的联系方式已生效"})
+}
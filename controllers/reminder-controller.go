@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 预约提醒相关配置
+const (
+	defaultReminderOffsets  = "24h,1h"           // 提前多久提醒，可通过 APPOINTMENT_REMINDER_OFFSETS 配置，逗号分隔
+	defaultReminderChannels = "in_app,email,sms" // 提醒渠道，可通过 APPOINTMENT_REMINDER_CHANNELS 配置，逗号分隔
+	reminderMaxAttempts     = 3                  // 所有渠道均失败时最多尝试的次数
+	reminderClaimLease      = 10 * time.Minute   // 领取后超过该时长仍未完成，视为发送中断，允许其他实例重新领取
+)
+
+// reminderOffsets 解析提醒时间点，按从小到大排序，无效项忽略
+func reminderOffsets() []time.Duration {
+	raw := os.Getenv("APPOINTMENT_REMINDER_OFFSETS")
+	if raw == "" {
+		raw = defaultReminderOffsets
+	}
+
+	seen := make(map[time.Duration]bool)
+	var offsets []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil || d < time.Minute {
+			log.Printf("忽略无效的预约提醒时间点: %q", part)
+			continue
+		}
+		d = d.Truncate(time.Minute)
+		if !seen[d] {
+			seen[d] = true
+			offsets = append(offsets, d)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// reminderChannels 解析提醒渠道
+func reminderChannels() []string {
+	raw := os.Getenv("APPOINTMENT_REMINDER_CHANNELS")
+	if raw == "" {
+		raw = defaultReminderChannels
+	}
+	var channels []string
+	for _, part := range strings.Split(raw, ",") {
+		switch channel := strings.TrimSpace(part); channel {
+		case utils.ChannelInApp, utils.ChannelEmail, utils.ChannelSMS:
+			channels = append(channels, channel)
+		case "":
+		default:
+			log.Printf("忽略未知的预约提醒渠道: %q", channel)
+		}
+	}
+	return channels
+}
+
+// dueReminderOffset 返回当前应发送的提醒时间点：已到达的最小时间点。
+// 预约创建或最近一次改约时已经过了的时间点不再补发，已错过的较早时间点在较晚时间点到达后也不再发送
+func dueReminderOffset(appointment *models.Appointment, offsets []time.Duration, now time.Time) (time.Duration, bool) {
+	bookedAt := appointment.CreatedAt
+	if appointment.RescheduledAt != nil && appointment.RescheduledAt.After(bookedAt) {
+		bookedAt = *appointment.RescheduledAt
+	}
+	for _, offset := range offsets {
+		at := appointment.StartTime.Add(-offset)
+		if !now.Before(at) && !bookedAt.After(at) {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+// claimReminder 领取一条提醒。首次领取通过唯一索引插入记录，只有一个实例能插入成功；
+// 发送失败或发送中断的记录通过按状态的条件更新重新领取。返回 nil 表示已被其他实例领取或已发送。
+// 记录以预约当前的开始时间区分，改约后各时间点重新提醒
+func claimReminder(appointment *models.Appointment, offsetMinutes int, now time.Time) (*models.AppointmentReminder, error) {
+	// 数据库时间精度为微秒，截断后才能在 finishReminder 中按领取时间精确匹配
+	now = now.Truncate(time.Microsecond)
+	reminder := models.AppointmentReminder{
+		AppointmentID: appointment.ID,
+		StartTime:     appointment.StartTime,
+		OffsetMinutes: offsetMinutes,
+		Status:        models.ReminderSending,
+		Attempts:      1,
+		ClaimedAt:     now,
+	}
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &reminder, nil
+	}
+
+	query := func() *gorm.DB {
+		return config.DB.Model(&models.AppointmentReminder{}).
+			Where("appointment_id = ? AND start_time = ? AND offset_minutes = ?",
+				appointment.ID, appointment.StartTime, offsetMinutes)
+	}
+	result = query().
+		Where("attempts < ? AND (status = ? OR (status = ? AND claimed_at < ?))", reminderMaxAttempts,
+			models.ReminderFailed, models.ReminderSending, now.Add(-reminderClaimLease)).
+		Updates(map[string]interface{}{
+			"status":     models.ReminderSending,
+			"claimed_at": now,
+			"attempts":   gorm.Expr("attempts + 1"),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	if err := query().First(&reminder).Error; err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+// reminderRecipient 提醒的一个接收人及其通知内容
+type reminderRecipient struct {
+	user *models.User
+	body string
+}
+
+// reminderRecipients 预约的学生和咨询师，以及各自的提醒内容
+func reminderRecipients(appointment *models.Appointment) []reminderRecipient {
+	var location string
+	var counselor models.Counselor
+	if config.DB.Where("user_id = ?", appointment.CounselorID).First(&counselor).Error == nil {
+		location = counselor.OfficeLocation
+	}
+	start := appointment.StartTime.Format(appointmentTimeLayout)
+	suffix := ""
+	if location != "" {
+		suffix = "，地点：" + location
+	}
+	if appointment.Status == models.AppointmentStatusPending {
+		suffix += "。该预约尚未确认"
+	}
+
+	var recipients []reminderRecipient
+	var student models.User
+	if config.DB.First(&student, appointment.UserID).Error == nil {
+		recipients = append(recipients, reminderRecipient{&student,
+			fmt.Sprintf("您预约的心理咨询将于 %s 开始，咨询师：%s%s。如需取消或改约请尽早操作。",
+				start, appointment.CounselorName, suffix)})
+	}
+	var counselorUser models.User
+	if config.DB.First(&counselorUser, appointment.CounselorID).Error == nil {
+		recipients = append(recipients, reminderRecipient{&counselorUser,
+			fmt.Sprintf("学生 %s 的咨询预约（编号 %d）将于 %s 开始%s。",
+				appointment.Username, appointment.ID, start, suffix)})
+	}
+	return recipients
+}
+
+// sendAppointmentReminder 通过各渠道向预约双方发送提醒，返回至少成功发送一次的渠道和最后一个错误
+func sendAppointmentReminder(appointment *models.Appointment, channels []string) ([]string, error) {
+	return deliverReminder(appointment.ID, reminderRecipients(appointment), channels)
+}
+
+// deliverReminder 通过各渠道向接收人发送提醒，未绑定该渠道的接收人跳过
+func deliverReminder(appointmentID uint, recipients []reminderRecipient, channels []string) ([]string, error) {
+	const subject = "心理咨询预约提醒"
+
+	delivered := make(map[string]bool)
+	var lastErr error
+	for _, r := range recipients {
+		for _, channel := range channels {
+			msg := utils.Message{Channel: channel, Subject: subject, Body: r.body}
+			switch channel {
+			case utils.ChannelInApp:
+				msg.To = strconv.FormatUint(uint64(r.user.ID), 10)
+			case utils.ChannelEmail:
+				msg.To = r.user.Email
+			case utils.ChannelSMS:
+				msg.To = r.user.Phone
+			}
+			if msg.To == "" {
+				continue
+			}
+			if err := utils.Notify(msg); err != nil {
+				lastErr = fmt.Errorf("%s: %w", channel, err)
+				log.Printf("发送预约提醒失败: appointment_id=%d user_id=%d channel=%s err=%v",
+					appointmentID, r.user.ID, channel, err)
+				continue
+			}
+			delivered[channel] = true
+		}
+	}
+
+	var sent []string
+	for _, channel := range channels {
+		if delivered[channel] {
+			sent = append(sent, channel)
+		}
+	}
+	return sent, lastErr
+}
+
+// finishReminder 记录发送结果。以领取时间为条件，被其他实例重新领取后不再覆盖其结果
+func finishReminder(reminder *models.AppointmentReminder, sent []string, sendErr error) error {
+	updates := map[string]interface{}{
+		"status":   models.ReminderFailed,
+		"channels": strings.Join(sent, ","),
+		"error":    "",
+	}
+	if len(sent) > 0 {
+		now := time.Now()
+		updates["status"] = models.ReminderSent
+		updates["sent_at"] = &now
+	} else if sendErr == nil {
+		sendErr = fmt.Errorf("预约双方均未绑定可用的提醒渠道")
+	}
+	if sendErr != nil {
+		msg := []rune(sendErr.Error())
+		if len(msg) > 500 {
+			msg = msg[:500]
+		}
+		updates["error"] = string(msg)
+	}
+	return config.DB.Model(&models.AppointmentReminder{}).
+		Where("id = ? AND status = ? AND claimed_at = ?", reminder.ID, models.ReminderSending, reminder.ClaimedAt).
+		Updates(updates).Error
+}
+
+// SendAppointmentReminders 定时任务：在预约开始前的各个时间点提醒学生和咨询师。
+// 多个后端实例同时运行时，每条提醒只会被一个实例领取并发送
+func SendAppointmentReminders() {
+	offsets := reminderOffsets()
+	channels := reminderChannels()
+	if len(offsets) == 0 || len(channels) == 0 {
+		return
+	}
+	now := time.Now()
+
+	var appointments []models.Appointment
+	if err := config.DB.Where("status IN ? AND start_time > ? AND start_time <= ?",
+		[]string{models.AppointmentStatusPending, models.AppointmentStatusConfirmed},
+		now, now.Add(offsets[len(offsets)-1])).
+		Order("start_time").Find(&appointments).Error; err != nil {
+		log.Printf("发送预约提醒失败: %v", err)
+		return
+	}
+
+	sent := 0
+	for i := range appointments {
+		appointment := &appointments[i]
+		offset, ok := dueReminderOffset(appointment, offsets, now)
+		if !ok {
+			continue
+		}
+		reminder, err := claimReminder(appointment, int(offset/time.Minute), now)
+		if err != nil {
+			log.Printf("领取预约提醒失败: appointment_id=%d err=%v", appointment.ID, err)
+			continue
+		}
+		if reminder == nil {
+			continue
+		}
+
+		delivered, sendErr := sendAppointmentReminder(appointment, channels)
+		if err := finishReminder(reminder, delivered, sendErr); err != nil {
+			log.Printf("记录预约提醒结果失败: appointment_id=%d err=%v", appointment.ID, err)
+		}
+		if len(delivered) > 0 {
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Printf("预约提醒发送完成，共 %d 个预约", sent)
+	}
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ental-health-system/models"
+	"ental-health-system/utils"
+)
+
+func TestDueReminderOffset(t *testing.T) {
+	offsets := []time.Duration{time.Hour, 24 * time.Hour}
+	start := time.Date(2026, 3, 10, 14, 0, 0, 0, time.Local)
+	booked := start.Add(-72 * time.Hour)
+
+	tests := []struct {
+		name        string
+		createdAt   time.Time
+		rescheduled *time.Time
+		now         time.Time
+		want        time.Duration
+		ok          bool
+	}{
+		{"too early", booked, nil, start.Add(-25 * time.Hour), 0, false},
+		{"24h reached", booked, nil, start.Add(-23 * time.Hour), 24 * time.Hour, true},
+		{"1h reached", booked, nil, start.Add(-30 * time.Minute), time.Hour, true},
+		{"booked after 24h point", start.Add(-10 * time.Hour), nil, start.Add(-9 * time.Hour), 0, false},
+		{"booked after 24h point, 1h reached", start.Add(-10 * time.Hour), nil, start.Add(-time.Hour), time.Hour, true},
+		{"rescheduled after 24h point", booked, timePtr(start.Add(-5 * time.Hour)), start.Add(-4 * time.Hour), 0, false},
+		{"rescheduled before 24h point", booked, timePtr(start.Add(-48 * time.Hour)), start.Add(-20 * time.Hour), 24 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appointment := &models.Appointment{StartTime: start, CreatedAt: tt.createdAt, RescheduledAt: tt.rescheduled}
+			got, ok := dueReminderOffset(appointment, offsets, tt.now)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("dueReminderOffset = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// useFakeNotifier 将各渠道替换为 FakeNotifier，测试结束后恢复为写日志
+func useFakeNotifier(t *testing.T) *utils.FakeNotifier {
+	t.Helper()
+	fake := &utils.FakeNotifier{}
+	channels := []string{utils.ChannelInApp, utils.ChannelEmail, utils.ChannelSMS}
+	for _, channel := range channels {
+		utils.RegisterNotifier(channel, fake)
+	}
+	t.Cleanup(func() {
+		for _, channel := range channels {
+			utils.RegisterNotifier(channel, utils.LogNotifier{})
+		}
+	})
+	return fake
+}
+
+func TestDeliverReminder(t *testing.T) {
+	fake := useFakeNotifier(t)
+	recipients := []reminderRecipient{
+		{&models.User{ID: 7, Email: "stu@example.edu", Phone: "13800000000"}, "学生提醒"},
+		{&models.User{ID: 8, Email: "coun@example.edu"}, "咨询师提醒"},
+	}
+	channels := []string{utils.ChannelInApp, utils.ChannelEmail, utils.ChannelSMS}
+
+	sent, err := deliverReminder(1, recipients, channels)
+	if err != nil {
+		t.Fatalf("deliverReminder: %v", err)
+	}
+	if len(sent) != 3 {
+		t.Fatalf("sent channels = %v", sent)
+	}
+	want := []utils.Message{
+		{Channel: utils.ChannelInApp, To: "7", Body: "学生提醒"},
+		{Channel: utils.ChannelEmail, To: "stu@example.edu", Body: "学生提醒"},
+		{Channel: utils.ChannelSMS, To: "13800000000", Body: "学生提醒"},
+		{Channel: utils.ChannelInApp, To: "8", Body: "咨询师提醒"},
+		{Channel: utils.ChannelEmail, To: "coun@example.edu", Body: "咨询师提醒"},
+	}
+	got := fake.Messages()
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d: %+v", len(got), len(want), got)
+	}
+	for i, m := range got {
+		if m.Channel != want[i].Channel || m.To != want[i].To || m.Body != want[i].Body || m.Subject == "" {
+			t.Errorf("message %d = %+v, want %+v", i, m, want[i])
+		}
+	}
+
+	// 所有渠道均失败时不返回成功渠道，并返回错误
+	fake.Reset()
+	fake.Err = errors.New("gateway down")
+	sent, err = deliverReminder(1, recipients, channels)
+	if len(sent) != 0 || err == nil {
+		t.Fatalf("failing notifier: sent=%v err=%v", sent, err)
+	}
+}
+
+func TestClaimReminderOnce(t *testing.T) {
+	db := openTestDB(t, &models.AppointmentReminder{})
+	appointment := &models.Appointment{
+		ID:        uint(time.Now().UnixNano() % 1e9),
+		StartTime: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	t.Cleanup(func() {
+		db.Where("appointment_id = ?", appointment.ID).Delete(&models.AppointmentReminder{})
+	})
+
+	// 多个实例同时领取同一条提醒，只有一个能领取成功
+	claimAll := func(now time.Time) []*models.AppointmentReminder {
+		const workers = 16
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var claimed []*models.AppointmentReminder
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reminder, err := claimReminder(appointment, 60, now)
+				if err != nil {
+					t.Errorf("claimReminder: %v", err)
+					return
+				}
+				if reminder != nil {
+					mu.Lock()
+					claimed = append(claimed, reminder)
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		return claimed
+	}
+
+	now := time.Now()
+	claimed := claimAll(now)
+	if len(claimed) != 1 {
+		t.Fatalf("first claim: %d instances claimed the reminder", len(claimed))
+	}
+	// 发送中的提醒在租约内不能重新领取
+	if again := claimAll(now.Add(time.Minute)); len(again) != 0 {
+		t.Fatalf("claimed %d times while sending", len(again))
+	}
+	// 发送失败后只有一个实例能重新领取
+	if err := finishReminder(claimed[0], nil, errors.New("gateway down")); err != nil {
+		t.Fatal(err)
+	}
+	retried := claimAll(now.Add(2 * time.Minute))
+	if len(retried) != 1 || retried[0].Attempts != 2 {
+		t.Fatalf("retry: %+v", retried)
+	}
+	// 发送成功后不再领取
+	if err := finishReminder(retried[0], []string{utils.ChannelEmail}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if again := claimAll(now.Add(time.Hour)); len(again) != 0 {
+		t.Fatalf("claimed %d times after sent", len(again))
+	}
+
+	// 改约后按新的开始时间重新提醒
+	appointment.StartTime = appointment.StartTime.Add(24 * time.Hour)
+	if rescheduled := claimAll(now.Add(time.Hour)); len(rescheduled) != 1 {
+		t.Fatalf("after reschedule: %d instances claimed the reminder", len(rescheduled))
+	}
+}
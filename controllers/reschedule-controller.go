@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 改约规则默认值，可通过 APPOINTMENT_RESCHEDULE_MIN_NOTICE、APPOINTMENT_MAX_RESCHEDULES 配置
+const (
+	defaultRescheduleMinNotice = 24 * time.Hour
+	defaultMaxReschedules      = 2
+)
+
+// RescheduleAppointmentRequest 改约请求结构
+type RescheduleAppointmentRequest struct {
+	TimeSlotID uint   `json:"time_slot_id" binding:"required"` // 新的时间段，须为同一咨询师的可预约时间段
+	Reason     string `json:"reason" binding:"max=500"`
+}
+
+// rescheduleAppointment 在事务中改约：释放原时间段、预约新时间段、更新预约时间并写入变更记录。
+// 管理人员不受提前时间和改约次数限制。返回原时间段ID
+func rescheduleAppointment(tx *gorm.DB, appointment *models.Appointment, slotID uint, actorID uint, actor, reason string, now time.Time) (uint, error) {
+	if appointment.Status != models.AppointmentStatusPending && appointment.Status != models.AppointmentStatusConfirmed {
+		return 0, &appointmentError{http.StatusConflict, "当前状态不允许改约"}
+	}
+	if uint(appointment.TimeSlotID) == slotID {
+		return 0, &appointmentError{http.StatusBadRequest, "新时间段与原时间段相同"}
+	}
+	if actor != models.AppointmentActorAdmin {
+		notice := utils.DurationFromEnv("APPOINTMENT_RESCHEDULE_MIN_NOTICE", defaultRescheduleMinNotice)
+		if appointment.StartTime.Sub(now) < notice {
+			return 0, &appointmentError{http.StatusConflict,
+				fmt.Sprintf("距预约开始不足 %s，不能改约", notice)}
+		}
+		if limit := utils.IntFromEnv("APPOINTMENT_MAX_RESCHEDULES", defaultMaxReschedules); appointment.RescheduleCount >= limit {
+			return 0, &appointmentError{http.StatusConflict, fmt.Sprintf("每个预约最多改约 %d 次", limit)}
+		}
+	}
+
+	slot, err := lockBookableSlot(tx, slotID, now)
+	if err != nil {
+		return 0, err
+	}
+	if slot.CounselorID != appointment.CounselorID {
+		return 0, &appointmentError{http.StatusBadRequest, "只能改约到同一咨询师的时间段"}
+	}
+	// 锁定学生行，与新预约的冲突检测串行化
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		First(&models.User{}, appointment.UserID).Error; err != nil {
+		return 0, err
+	}
+	if err := checkStudentOverlap(tx, uint(appointment.UserID), appointment.ID, slot.StartTime, slot.EndTime); err != nil {
+		return 0, err
+	}
+
+	oldSlotID := uint(appointment.TimeSlotID)
+	oldStart := appointment.StartTime
+	if oldSlotID > 0 {
+		if err := tx.Model(&models.TimeSlot{}).
+			Where("id = ? AND status = ?", oldSlotID, models.TimeSlotStatusBooked).
+			Update("status", models.TimeSlotStatusAvailable).Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Model(slot).Update("status", models.TimeSlotStatusBooked).Error; err != nil {
+		return 0, err
+	}
+
+	result := tx.Model(&models.Appointment{}).
+		Where("id = ? AND time_slot_id = ?", appointment.ID, appointment.TimeSlotID).
+		Updates(map[string]interface{}{
+			"time_slot_id":     slot.ID,
+			"start_time":       slot.StartTime,
+			"end_time":         slot.EndTime,
+			"reschedule_count": gorm.Expr("reschedule_count + 1"),
+			"rescheduled_at":   now,
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, &appointmentError{http.StatusConflict, "预约已变化，请刷新后重试"}
+	}
+
+	note := fmt.Sprintf("改约：%s → %s", oldStart.Format(appointmentTimeLayout), slot.StartTime.Format(appointmentTimeLayout))
+	if reason = strings.TrimSpace(reason); reason != "" {
+		note += "；" + reason
+	}
+	if err := recordAppointmentHistory(tx, appointment.ID, appointment.Status, appointment.Status,
+		&actorID, actor, note); err != nil {
+		return 0, err
+	}
+
+	appointment.TimeSlotID = int(slot.ID)
+	appointment.StartTime = slot.StartTime
+	appointment.EndTime = slot.EndTime
+	appointment.RescheduleCount++
+	appointment.RescheduledAt = &now
+	return oldSlotID, nil
+}
+
+// notifyReschedule 通知改约的另一方：学生改约时通知咨询师，咨询师或管理人员改约时通知学生
+func notifyReschedule(appointment *models.Appointment, actor string, oldStart time.Time) {
+	body := fmt.Sprintf("预约（编号 %d）的咨询时间已由 %s 改为 %s。",
+		appointment.ID, oldStart.Format(appointmentTimeLayout), appointment.StartTime.Format(appointmentTimeLayout))
+
+	var recipientIDs []int
+	if actor != models.AppointmentActorStudent {
+		recipientIDs = append(recipientIDs, appointment.UserID)
+	}
+	if actor != models.AppointmentActorCounselor {
+		recipientIDs = append(recipientIDs, appointment.CounselorID)
+	}
+	for _, id := range recipientIDs {
+		var user models.User
+		if err := config.DB.First(&user, id).Error; err == nil {
+			notifyUser(&user, "咨询预约改约通知", body)
+		}
+	}
+}
+
+// @Summary 改约
+// @Description 将预约改到同一咨询师的另一个可预约时间段，原时间段重新开放。
+// @Description 学生和咨询师须在预约开始前的规定时间之前改约，且每个预约的改约次数有上限；改约后通知另一方
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "预约ID"
+// @Param data body RescheduleAppointmentRequest true "新的时间段"
+// @Success 200 {object} map[string]interface{} "改约成功"
+// @Failure 409 {object} map[string]interface{} "时间段不可预约或不满足改约规则"
+// @Router /appointments/{id}/reschedule [post]
+func RescheduleAppointment(c *gin.Context) {
+	var req RescheduleAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的预约ID"})
+		return
+	}
+
+	userID := currentUserID(c)
+	var appointment models.Appointment
+	var actor string
+	var oldSlotID uint
+	var oldStart time.Time
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appointment, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &appointmentError{http.StatusNotFound, "预约不存在"}
+			}
+			return err
+		}
+		actors := appointmentActorRoles(c, &appointment)
+		if len(actors) == 0 {
+			return &appointmentError{http.StatusNotFound, "预约不存在"}
+		}
+		actor = actors[0]
+		oldStart = appointment.StartTime
+
+		var err error
+		oldSlotID, err = rescheduleAppointment(tx, &appointment, req.TimeSlotID, userID, actor, req.Reason, time.Now())
+		return err
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "改约失败")
+		return
+	}
+
+	if oldSlotID > 0 {
+		promoteWaitlist(oldSlotID)
+	}
+	notifyReschedule(&appointment, actor, oldStart)
+
+	redactAppointmentNotes(c, &appointment)
+	c.JSON(http.StatusOK, gin.H{"message": "改约成功", "appointment": appointment})
+}
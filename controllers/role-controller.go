@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	roleNamePattern       = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+	permissionCodePattern = regexp.MustCompile(`^(\*|[a-z_]+)(:(\*|[a-z_]+))*$`)
+)
+
+// CreateRoleRequest 创建角色请求结构
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	DisplayName string   `json:"display_name" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest 修改角色请求结构
+type UpdateRoleRequest struct {
+	DisplayName string `json:"display_name" binding:"required,max=50"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// SetRolePermissionsRequest 设置角色权限请求结构
+type SetRolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+// errUnknownPermission 提交的权限编码不存在
+var errUnknownPermission = errors.New("unknown permission")
+
+// resolvePermissions 将权限编码转换为权限记录
+// 普通编码必须已在权限表中存在，包含 * 的通配编码按需创建
+func resolvePermissions(tx *gorm.DB, codes []string) ([]models.Permission, error) {
+	perms := make([]models.Permission, 0, len(codes))
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		if !permissionCodePattern.MatchString(code) {
+			return nil, errUnknownPermission
+		}
+
+		var perm models.Permission
+		if strings.Contains(code, "*") {
+			if err := tx.Where(models.Permission{Code: code}).FirstOrCreate(&perm).Error; err != nil {
+				return nil, err
+			}
+		} else if err := tx.Where("code = ?", code).First(&perm).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errUnknownPermission
+			}
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	return perms, nil
+}
+
+// findRole 按路径参数查询角色
+func findRole(c *gin.Context) (*models.Role, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return nil, false
+	}
+	var role models.Role
+	if err := config.DB.First(&role, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return nil, false
+	}
+	return &role, true
+}
+
+// @Summary 获取角色列表
+// @Tags 角色管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "角色列表（含权限）"
+// @Router /roles [get]
+func GetRoleList(c *gin.Context) {
+	var roles []models.Role
+	if err := config.DB.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// @Summary 获取权限点列表
+// @Tags 角色管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "权限点列表"
+// @Router /permissions [get]
+func GetPermissionList(c *gin.Context) {
+	var perms []models.Permission
+	if err := config.DB.Order("code").Find(&perms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取权限列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": perms})
+}
+
+// @Summary 创建角色
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body CreateRoleRequest true "角色信息"
+// @Success 200 {object} map[string]interface{} "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或权限不存在"
+// @Failure 409 {object} map[string]interface{} "角色已存在"
+// @Router /roles [post]
+func CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "无效的请求参数",
+			"details": "角色标识需以小写字母开头，仅包含小写字母、数字和下划线",
+		})
+		return
+	}
+
+	var existing models.Role
+	if config.DB.Where("name = ?", req.Name).First(&existing).Error == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "角色已存在"})
+		return
+	}
+
+	role := models.Role{Name: req.Name, DisplayName: req.DisplayName, Description: req.Description}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		perms, err := resolvePermissions(tx, req.Permissions)
+		if err != nil {
+			return err
+		}
+		role.Permissions = perms
+		return tx.Create(&role).Error
+	})
+	if errors.Is(err, errUnknownPermission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "包含不存在的权限"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建角色失败"})
+		return
+	}
+
+	config.InvalidatePermissionCache()
+	c.JSON(http.StatusOK, gin.H{"message": "创建成功", "role": role})
+}
+
+// @Summary 修改角色信息
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "角色ID"
+// @Param data body UpdateRoleRequest true "角色信息"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 404 {object} map[string]interface{} "角色不存在"
+// @Router /roles/{id} [put]
+func UpdateRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Model(role).Updates(map[string]interface{}{
+		"display_name": req.DisplayName,
+		"description":  req.Description,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改角色失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功", "role": role})
+}
+
+// @Summary 设置角色权限
+// @Description 用提交的权限编码整体替换角色的权限，修改立即对本实例生效
+// @Tags 角色管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "角色ID"
+// @Param data body SetRolePermissionsRequest true "权限编码列表"
+// @Success 200 {object} map[string]interface{} "设置成功"
+// @Failure 400 {object} map[string]interface{} "权限不存在"
+// @Failure 403 {object} map[string]interface{} "管理员角色的权限不可修改"
+// @Router /roles/{id}/permissions [put]
+func SetRolePermissions(c *gin.Context) {
+	var req SetRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+	// 防止误操作导致无人可以管理系统
+	if role.Name == "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "管理员角色的权限不可修改"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		perms, err := resolvePermissions(tx, req.Permissions)
+		if err != nil {
+			return err
+		}
+		return tx.Model(role).Association("Permissions").Replace(perms)
+	})
+	if errors.Is(err, errUnknownPermission) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "包含不存在的权限"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置角色权限失败"})
+		return
+	}
+
+	config.InvalidatePermissionCache()
+	c.JSON(http.StatusOK, gin.H{"message": "设置成功", "role": role})
+}
+
+// @Summary 删除角色
+// @Description 内置角色和仍有用户使用的角色不可删除
+// @Tags 角色管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "角色ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 409 {object} map[string]interface{} "角色不可删除"
+// @Router /roles/{id} [delete]
+func DeleteRole(c *gin.Context) {
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+	if role.IsSystem {
+		c.JSON(http.StatusConflict, gin.H{"error": "内置角色不可删除"})
+		return
+	}
+
+	var users int64
+	config.DB.Model(&models.User{}).Where("role = ?", role.Name).Count(&users)
+	if users > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "仍有用户使用该角色，无法删除"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除角色失败"})
+		return
+	}
+
+	config.InvalidatePermissionCache()
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
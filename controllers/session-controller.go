@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionInfo 登录会话信息，同一令牌家族的访问令牌和刷新令牌合并为一个会话
+type SessionInfo struct {
+	ID        uint       `json:"id"`         // 会话ID（会话中刷新令牌的记录ID）
+	UserAgent string     `json:"user_agent"` // 用户代理
+	ClientIP  string     `json:"client_ip"`  // 客户端IP
+	LastUsed  *time.Time `json:"last_used"`  // 最后使用时间
+	CreatedAt time.Time  `json:"created_at"` // 登录时间
+	ExpiresAt time.Time  `json:"expires_at"` // 会话过期时间
+	Current   bool       `json:"current"`    // 是否为当前请求所在会话
+}
+
+// @Summary 退出登录
+// @Description 撤销当前登录会话的访问令牌和刷新令牌
+// @Tags 认证
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "退出成功"
+// @Failure 401 {object} map[string]interface{} "未授权"
+// @Router /logout [post]
+func Logout(c *gin.Context) {
+	var token models.Token
+	if err := config.DB.First(&token, c.GetUint("tokenID")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
+		return
+	}
+
+	if err := revokeSession(config.DB, &token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "退出成功"})
+}
+
+// @Summary 获取我的登录会话
+// @Description 列出当前用户所有未过期且未撤销的登录会话
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "会话列表"
+// @Router /users/me/sessions [get]
+func GetMySessions(c *gin.Context) {
+	var tokens []models.Token
+	if err := config.DB.Where("user_id = ? AND is_revoked = ? AND expires_at > ?",
+		currentUserID(c), false, time.Now()).Order("created_at").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": buildSessions(tokens, c.GetString("tokenFamily"), c.GetUint("tokenID"))})
+}
+
+// buildSessions 按令牌家族合并令牌记录
+func buildSessions(tokens []models.Token, currentFamily string, currentTokenID uint) []SessionInfo {
+	sessions := make([]SessionInfo, 0)
+	index := make(map[string]int)
+
+	for _, t := range tokens {
+		// 没有家族ID的旧令牌单独作为一个会话
+		key := t.FamilyID
+		if key == "" {
+			key = "token:" + strconv.FormatUint(uint64(t.ID), 10)
+		}
+
+		i, ok := index[key]
+		if !ok {
+			sessions = append(sessions, SessionInfo{
+				ID:        t.ID,
+				UserAgent: t.UserAgent,
+				ClientIP:  t.ClientIP,
+				CreatedAt: t.CreatedAt,
+			})
+			i = len(sessions) - 1
+			index[key] = i
+		}
+
+		s := &sessions[i]
+		if t.Type == utils.TokenTypeRefresh {
+			s.ID = t.ID
+		}
+		if t.ExpiresAt.After(s.ExpiresAt) {
+			s.ExpiresAt = t.ExpiresAt
+		}
+		if t.LastUsed != nil && (s.LastUsed == nil || t.LastUsed.After(*s.LastUsed)) {
+			s.LastUsed = t.LastUsed
+		}
+		if (t.FamilyID != "" && t.FamilyID == currentFamily) || t.ID == currentTokenID {
+			s.Current = true
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// @Summary 注销指定登录会话
+// @Description 远程注销当前用户的某个登录会话（例如丢失的设备）
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "会话ID"
+// @Success 200 {object} map[string]interface{} "注销成功"
+// @Failure 404 {object} map[string]interface{} "会话不存在"
+// @Router /users/me/sessions/{id} [delete]
+func RevokeMySession(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return
+	}
+
+	var token models.Token
+	if err := config.DB.Where("id = ? AND user_id = ? AND is_revoked = ?", id, currentUserID(c), false).
+		First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	if err := revokeSession(config.DB, &token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "注销成功"})
+}
+
+// @Summary 退出所有设备
+// @Description 注销当前用户的所有登录会话，except_current=true 时保留当前会话
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Param except_current query bool false "是否保留当前会话"
+// @Success 200 {object} map[string]interface{} "注销成功"
+// @Router /users/me/sessions [delete]
+func RevokeAllMySessions(c *gin.Context) {
+	now := time.Now()
+	query := config.DB.Model(&models.Token{}).
+		Where("user_id = ? AND is_revoked = ?", currentUserID(c), false)
+	if c.Query("except_current") == "true" {
+		if family := c.GetString("tokenFamily"); family != "" {
+			query = query.Where("family_id <> ?", family)
+		} else {
+			query = query.Where("id <> ?", c.GetUint("tokenID"))
+		}
+	}
+
+	result := query.Updates(map[string]interface{}{"is_revoked": true, "revoked_at": &now})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "注销成功", "revoked": result.RowsAffected})
+}
+
+// @Summary 强制下线用户
+// @Description 管理员注销指定用户的所有登录会话（例如封禁账户时）
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "注销成功"
+// @Failure 403 {object} map[string]interface{} "无权管理该用户"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Router /users/{id}/sessions [delete]
+func RevokeUserSessions(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+		return
+	}
+
+	if err := revokeUserTokens(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "注销成功"})
+}
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 单点登录来源
+const (
+	ssoProviderOIDC = "oidc"
+	ssoProviderCAS  = "cas"
+)
+
+// ssoStateTTL OIDC 授权请求的有效期
+const ssoStateTTL = 10 * time.Minute
+
+// ssoStateCookie 保存 OIDC 授权 state 的 Cookie，回调时必须与请求中的 state 一致，
+// 确保回调来自发起授权的同一浏览器，防止攻击者让受害者登录到攻击者的账户
+const ssoStateCookie = "sso_state"
+
+// setSSOStateCookie 写入或清除（maxAge < 0）授权 state Cookie，仅限单点登录接口读取
+func setSSOStateCookie(c *gin.Context, state string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, state, maxAge, "/api/v1/sso", "", secure, true)
+}
+
+// OIDCCallbackRequest OIDC 回调请求结构，由前端回调页转发授权码
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// CASCallbackRequest CAS 回调请求结构，由前端回调页转发票据
+type CASCallbackRequest struct {
+	Ticket string `json:"ticket" binding:"required"`
+}
+
+// externalProfile 从外部身份中提取的用户资料
+type externalProfile struct {
+	Provider    string
+	Subject     string // 外部身份唯一标识
+	CampusID    string // 学号或工号
+	Name        string
+	Email       string
+	Affiliation string // 身份类型，如 student/staff
+}
+
+// errSSONotProvisioned 外部身份无法匹配本地用户且不允许自动开通
+var errSSONotProvisioned = errors.New("sso user not provisioned")
+
+// ssoClaim 读取单点登录属性名配置
+func ssoClaim(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// claimString 读取声明中的字符串值，多值时取第一个
+func claimString(claims map[string]interface{}, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return s
+			}
+		}
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// isStudentAffiliation 判断身份类型是否为学生；未配置身份类型属性时视为学生
+func isStudentAffiliation(affiliation string) bool {
+	if os.Getenv("SSO_AFFILIATION_CLAIM") == "" {
+		return true
+	}
+	for _, a := range strings.Split(ssoClaim("SSO_STUDENT_AFFILIATIONS", "student"), ",") {
+		if strings.EqualFold(strings.TrimSpace(a), affiliation) {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcProfile 从 ID Token 声明中提取用户资料
+func oidcProfile(claims map[string]interface{}) *externalProfile {
+	return &externalProfile{
+		Provider:    ssoProviderOIDC,
+		Subject:     claimString(claims, "sub"),
+		CampusID:    claimString(claims, ssoClaim("SSO_ID_CLAIM", "preferred_username")),
+		Name:        claimString(claims, ssoClaim("SSO_NAME_CLAIM", "name")),
+		Email:       claimString(claims, "email"),
+		Affiliation: claimString(claims, os.Getenv("SSO_AFFILIATION_CLAIM")),
+	}
+}
+
+// casProfile 从CAS票据校验结果中提取用户资料
+func casProfile(identity *utils.CASIdentity) *externalProfile {
+	// CAS 用户名通常即为学号/工号，可通过 SSO_ID_CLAIM 指定属性
+	campusID := identity.User
+	if attr := os.Getenv("SSO_ID_CLAIM"); attr != "" && identity.Attributes[attr] != "" {
+		campusID = identity.Attributes[attr]
+	}
+	return &externalProfile{
+		Provider:    ssoProviderCAS,
+		Subject:     identity.User,
+		CampusID:    campusID,
+		Name:        identity.Attributes[ssoClaim("SSO_NAME_CLAIM", "name")],
+		Email:       identity.Attributes["email"],
+		Affiliation: identity.Attributes[os.Getenv("SSO_AFFILIATION_CLAIM")],
+	}
+}
+
+// resolveExternalUser 将外部身份映射为本地用户
+// 依次按已绑定身份、学号、工号匹配；均未匹配时为学生自动开通账户
+func resolveExternalUser(tx *gorm.DB, p *externalProfile) (*models.User, error) {
+	now := time.Now()
+
+	var identity models.ExternalIdentity
+	err := tx.Where("provider = ? AND subject = ?", p.Provider, p.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := tx.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		return &user, tx.Model(&identity).Update("last_login_at", &now).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user, err := matchCampusUser(tx, p.CampusID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if user, err = provisionStudent(tx, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, tx.Create(&models.ExternalIdentity{
+		UserID:      user.ID,
+		Provider:    p.Provider,
+		Subject:     p.Subject,
+		LastLoginAt: &now,
+	}).Error
+}
+
+// matchCampusUser 按学号或工号查找本地用户，未找到时返回nil
+func matchCampusUser(tx *gorm.DB, campusID string) (*models.User, error) {
+	if campusID == "" {
+		return nil, nil
+	}
+
+	var userID uint
+	var student models.Student
+	var counselor models.Counselor
+	if err := tx.Where("student_id = ?", campusID).First(&student).Error; err == nil {
+		userID = student.UserID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	} else if err := tx.Where("employee_id = ?", campusID).First(&counselor).Error; err == nil {
+		userID = counselor.UserID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	} else {
+		return nil, nil
+	}
+
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// provisionStudent 首次登录时自动开通学生账户；非学生身份需由管理员预先开通
+func provisionStudent(tx *gorm.DB, p *externalProfile) (*models.User, error) {
+	if os.Getenv("SSO_AUTO_PROVISION") == "false" || p.CampusID == "" || !isStudentAffiliation(p.Affiliation) {
+		return nil, errSSONotProvisioned
+	}
+
+	// 优先使用学号作为用户名，被占用时追加来源前缀
+	username := p.CampusID
+	var count int64
+	tx.Model(&models.User{}).Where("username = ?", username).Count(&count)
+	if count > 0 {
+		username = p.Provider + "_" + p.CampusID
+	}
+
+	// 统一认证用户不使用本地密码，设置随机密码占位
+	password, err := utils.RandomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		Username:          username,
+		Password:          password,
+		Name:              p.Name,
+		Role:              "student",
+		Status:            "active",
+		PasswordChangedAt: &now,
+	}
+	// 邮箱已被其他账户使用时不写入，避免违反唯一约束
+	if p.Email != "" {
+		tx.Model(&models.User{}).Where("email = ?", p.Email).Count(&count)
+		if count == 0 {
+			user.Email = p.Email
+		}
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.Student{UserID: user.ID, StudentID: p.CampusID}).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// finishSSOLogin 统一认证通过后完成本地登录：映射用户并签发令牌（或返回二次验证挑战）
+func finishSSOLogin(c *gin.Context, p *externalProfile) {
+	var user *models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = resolveExternalUser(tx, p)
+		return err
+	})
+	if errors.Is(err, errSSONotProvisioned) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该统一认证账户尚未开通本系统权限，请联系管理员"})
+		return
+	}
+	if err != nil {
+		log.Printf("单点登录映射用户失败: provider=%s subject=%s err=%v", p.Provider, p.Subject, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+
+	if user.Status != "active" {
+		recordLoginAttempt(c, &user.ID, user.Username, false, loginAttemptReasonInactive)
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		return
+	}
+	// 本地启用了二次验证的账户仍需完成二次验证，通过后才记录登录成功
+	challenge, err := twoFactorChallenge(config.DB, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	recordLoginAttempt(c, &user.ID, user.Username, true, p.Provider)
+
+	pair, err := issueTokenPair(config.DB, c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	resp := pair.response()
+	resp["user"] = loginUserInfo(user)
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary 获取OIDC授权地址
+// @Description 生成授权码+PKCE流程的授权地址，前端跳转后由回调页调用回调接口；
+// @Description state 同时写入 HttpOnly Cookie，回调时须由同一浏览器携带
+// @Tags 单点登录
+// @Produce json
+// @Success 200 {object} map[string]interface{} "授权地址"
+// @Failure 404 {object} map[string]interface{} "未启用OIDC登录"
+// @Router /sso/oidc/authorize [get]
+func OIDCAuthorize(c *gin.Context) {
+	cfg := utils.OIDCConfigFromEnv()
+	if cfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用OIDC登录"})
+		return
+	}
+
+	state, err1 := utils.RandomHex(16)
+	nonce, err2 := utils.RandomHex(16)
+	verifier, err3 := utils.RandomHex(32)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成授权请求失败"})
+		return
+	}
+
+	authURL, err := cfg.AuthorizationURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("生成OIDC授权地址失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "统一认证服务不可用"})
+		return
+	}
+
+	// 顺带清理过期的授权状态
+	config.DB.Where("expires_at < ?", time.Now()).Delete(&models.SSOState{})
+	if err := config.DB.Create(&models.SSOState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ssoStateTTL),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成授权请求失败"})
+		return
+	}
+
+	setSSOStateCookie(c, state, int(ssoStateTTL/time.Second))
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL, "state": state})
+}
+
+// @Summary OIDC登录回调
+// @Description 使用授权码换取并校验ID Token，映射到本地用户后签发令牌；首次登录的学生自动开通账户
+// @Tags 单点登录
+// @Accept json
+// @Produce json
+// @Param data body OIDCCallbackRequest true "授权码和state"
+// @Success 200 {object} map[string]interface{} "登录成功返回用户信息和令牌；需要二次验证时返回挑战令牌"
+// @Failure 401 {object} map[string]interface{} "授权失败或 state 与 Cookie 不一致"
+// @Failure 403 {object} map[string]interface{} "账户未开通或已被禁用"
+// @Router /sso/oidc/callback [post]
+func OIDCCallback(c *gin.Context) {
+	cfg := utils.OIDCConfigFromEnv()
+	if cfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用OIDC登录"})
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	// 授权请求必须由同一浏览器发起
+	cookie, _ := c.Cookie(ssoStateCookie)
+	setSSOStateCookie(c, "", -1)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(req.State)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "授权请求无效或已过期，请重新登录"})
+		return
+	}
+
+	// 一次性消费授权状态
+	var state models.SSOState
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state = ? AND expires_at > ?", req.State, time.Now()).First(&state).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&state).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "授权请求无效或已过期，请重新登录"})
+		return
+	}
+
+	claims, err := cfg.Exchange(req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC授权码校验失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "统一认证失败"})
+		return
+	}
+
+	finishSSOLogin(c, oidcProfile(claims))
+}
+
+// @Summary 获取CAS登录地址
+// @Tags 单点登录
+// @Produce json
+// @Success 200 {object} map[string]interface{} "CAS登录地址"
+// @Failure 404 {object} map[string]interface{} "未启用CAS登录"
+// @Router /sso/cas/login [get]
+func CASLogin(c *gin.Context) {
+	cfg := utils.CASConfigFromEnv()
+	if cfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用CAS登录"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"login_url": cfg.LoginURL()})
+}
+
+// @Summary CAS登录回调
+// @Description 校验CAS service ticket（2.0/3.0协议），映射到本地用户后签发令牌；首次登录的学生自动开通账户
+// @Tags 单点登录
+// @Accept json
+// @Produce json
+// @Param data body CASCallbackRequest true "service ticket"
+// @Success 200 {object} map[string]interface{} "登录成功返回用户信息和令牌；需要二次验证时返回挑战令牌"
+// @Failure 401 {object} map[string]interface{} "票据无效"
+// @Failure 403 {object} map[string]interface{} "账户未开通或已被禁用"
+// @Router /sso/cas/callback [post]
+func CASCallback(c *gin.Context) {
+	cfg := utils.CASConfigFromEnv()
+	if cfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用CAS登录"})
+		return
+	}
+
+	var req CASCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	identity, err := cfg.ValidateTicket(req.Ticket)
+	if err != nil {
+		log.Printf("CAS票据校验失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "统一认证失败"})
+		return
+	}
+
+	finishSSOLogin(c, casProfile(identity))
+}
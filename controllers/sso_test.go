@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ental-health-system/models"
+	"ental-health-system/utils/ssotest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestOIDCProfileMapping(t *testing.T) {
+	t.Setenv("SSO_ID_CLAIM", "student_no")
+	t.Setenv("SSO_AFFILIATION_CLAIM", "eduPersonAffiliation")
+
+	idp := ssotest.NewProvider("mhs")
+	defer idp.Close()
+	cfg := idp.OIDCConfig("https://app.example.edu/sso/callback")
+
+	verifier, nonce := "verifier-0123456789abcdef0123456789abcdef", "nonce-1"
+	authURL, err := cfg.AuthorizationURL("state-1", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	code, err := idp.Authorize(authURL, jwt.MapClaims{
+		"sub":                  "idp-42",
+		"student_no":           "2023001",
+		"name":                 "张三",
+		"email":                "zs@example.edu",
+		"eduPersonAffiliation": []string{"student", "member"},
+	})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	claims, err := cfg.Exchange(code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	p := oidcProfile(claims)
+	want := externalProfile{Provider: ssoProviderOIDC, Subject: "idp-42", CampusID: "2023001",
+		Name: "张三", Email: "zs@example.edu", Affiliation: "student"}
+	if *p != want {
+		t.Fatalf("oidcProfile = %+v, want %+v", *p, want)
+	}
+	if !isStudentAffiliation(p.Affiliation) {
+		t.Fatal("student affiliation not recognized")
+	}
+}
+
+func TestCASProfileMapping(t *testing.T) {
+	t.Setenv("SSO_ID_CLAIM", "employeeNumber")
+	t.Setenv("SSO_AFFILIATION_CLAIM", "type")
+
+	idp := ssotest.NewProvider("mhs")
+	defer idp.Close()
+	const service = "https://app.example.edu/sso/cas"
+	cfg := idp.CASConfig(service, "3")
+
+	ticket := idp.IssueTicket(service, "li.teacher", map[string]string{
+		"employeeNumber": "T1001", "name": "李老师", "type": "staff",
+	})
+	identity, err := cfg.ValidateTicket(ticket)
+	if err != nil {
+		t.Fatalf("ValidateTicket: %v", err)
+	}
+
+	p := casProfile(identity)
+	want := externalProfile{Provider: ssoProviderCAS, Subject: "li.teacher", CampusID: "T1001",
+		Name: "李老师", Affiliation: "staff"}
+	if *p != want {
+		t.Fatalf("casProfile = %+v, want %+v", *p, want)
+	}
+	if isStudentAffiliation(p.Affiliation) {
+		t.Fatal("staff treated as student")
+	}
+}
+
+func TestResolveExternalUser(t *testing.T) {
+	db := openTestDB(t, &models.User{}, &models.Student{}, &models.Counselor{}, &models.ExternalIdentity{})
+	t.Setenv("SSO_AFFILIATION_CLAIM", "type")
+	t.Setenv("SSO_AUTO_PROVISION", "")
+
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	suffix := uniqueSuffix(t)
+	student := models.User{Username: "sso-stu-" + suffix, Password: "x", Role: "student", Status: "active"}
+	counselor := models.User{Username: "sso-coun-" + suffix, Password: "x", Role: "counselor", Status: "active"}
+	if err := tx.Create(&student).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(&counselor).Error; err != nil {
+		t.Fatal(err)
+	}
+	studentID, employeeID := "S"+suffix, "E"+suffix
+	if err := tx.Create(&models.Student{UserID: student.ID, StudentID: studentID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(&models.Counselor{UserID: counselor.ID, EmployeeID: employeeID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := func(p externalProfile) (*models.User, error) {
+		t.Helper()
+		sp := tx.SavePoint("resolve")
+		user, err := resolveExternalUser(tx, &p)
+		if err != nil {
+			sp.RollbackTo("resolve")
+		}
+		return user, err
+	}
+
+	// 按学号匹配并绑定外部身份
+	user, err := resolve(externalProfile{Provider: ssoProviderOIDC, Subject: "sub-s-" + suffix, CampusID: studentID, Affiliation: "student"})
+	if err != nil || user.ID != student.ID {
+		t.Fatalf("student match: user=%v err=%v", user, err)
+	}
+	// 已绑定的外部身份不再依赖学号
+	user, err = resolve(externalProfile{Provider: ssoProviderOIDC, Subject: "sub-s-" + suffix, CampusID: "changed"})
+	if err != nil || user.ID != student.ID {
+		t.Fatalf("bound identity: user=%v err=%v", user, err)
+	}
+	// 按工号匹配咨询师
+	user, err = resolve(externalProfile{Provider: ssoProviderCAS, Subject: "sub-c-" + suffix, CampusID: employeeID, Affiliation: "staff"})
+	if err != nil || user.ID != counselor.ID {
+		t.Fatalf("employee match: user=%v err=%v", user, err)
+	}
+
+	// 未匹配的学生自动开通
+	newID := "N" + suffix
+	user, err = resolve(externalProfile{Provider: ssoProviderOIDC, Subject: "sub-n-" + suffix, CampusID: newID, Name: "新同学", Affiliation: "student"})
+	if err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+	var provisioned models.Student
+	if err := tx.Where("user_id = ?", user.ID).First(&provisioned).Error; err != nil || provisioned.StudentID != newID ||
+		user.Role != "student" || user.Username != newID {
+		t.Fatalf("provisioned user=%+v student=%+v err=%v", user, provisioned, err)
+	}
+
+	// 未匹配的教职工不自动开通
+	if _, err := resolve(externalProfile{Provider: ssoProviderCAS, Subject: "sub-x-" + suffix, CampusID: "X" + suffix, Affiliation: "staff"}); !errors.Is(err, errSSONotProvisioned) {
+		t.Fatalf("staff provisioning: err=%v", err)
+	}
+	// 关闭自动开通
+	t.Setenv("SSO_AUTO_PROVISION", "false")
+	if _, err := resolve(externalProfile{Provider: ssoProviderOIDC, Subject: "sub-y-" + suffix, CampusID: "Y" + suffix, Affiliation: "student"}); !errors.Is(err, errSSONotProvisioned) {
+		t.Fatalf("auto provision disabled: err=%v", err)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OIDC_ISSUER", "https://idp.example.edu")
+	r := gin.New()
+	r.POST("/api/v1/sso/oidc/callback", OIDCCallback)
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"no cookie", ""},
+		{"state from another browser", "attacker-state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/sso/oidc/callback",
+				strings.NewReader(`{"code":"attacker-code","state":"victim-state"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: ssoStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"os"
+	"testing"
+
+	"ental-health-system/config"
+	"ental-health-system/utils"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 连接 TEST_DATABASE_DSN 指定的 PostgreSQL 测试库，迁移给定的模型并设置为 config.DB。
+// 未配置时跳过测试；测试会写入数据，请使用专用的测试库
+func openTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("未配置 TEST_DATABASE_DSN，跳过需要数据库的测试")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+
+	prev := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = prev })
+	return db
+}
+
+// uniqueSuffix 生成随机后缀，避免测试数据与已有数据冲突
+func uniqueSuffix(t *testing.T) string {
+	t.Helper()
+	s, err := utils.RandomHex(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefreshTokenRequest 刷新令牌请求结构
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// tokenPair 一次签发的访问令牌和刷新令牌
+type tokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	RefreshRecord    models.Token
+}
+
+// response 转换为返回给客户端的结构
+func (p *tokenPair) response() gin.H {
+	return gin.H{
+		"token":              p.AccessToken,
+		"token_type":         "Bearer",
+		"expires_in":         int64(time.Until(p.AccessExpiresAt).Seconds()),
+		"refresh_token":      p.RefreshToken,
+		"refresh_expires_in": int64(time.Until(p.RefreshExpiresAt).Seconds()),
+	}
+}
+
+// issueTokenPair 为用户签发一对访问/刷新令牌并保存到数据库
+// familyID 为空时表示新的登录会话，会生成新的令牌家族
+func issueTokenPair(tx *gorm.DB, c *gin.Context, user *models.User, familyID string) (*tokenPair, error) {
+	if familyID == "" {
+		id, err := utils.RandomHex(16)
+		if err != nil {
+			return nil, err
+		}
+		familyID = id
+	}
+
+	now := time.Now()
+	pair := &tokenPair{
+		AccessExpiresAt:  now.Add(utils.AccessTokenTTL()),
+		RefreshExpiresAt: now.Add(utils.RefreshTokenTTL()),
+	}
+
+	var err error
+	if pair.AccessToken, err = utils.GenerateToken(user.ID, user.Role, utils.TokenTypeAccess, pair.AccessExpiresAt); err != nil {
+		return nil, err
+	}
+	if pair.RefreshToken, err = utils.GenerateToken(user.ID, user.Role, utils.TokenTypeRefresh, pair.RefreshExpiresAt); err != nil {
+		return nil, err
+	}
+
+	accessRecord := models.Token{
+		UserID:    user.ID,
+		Token:     pair.AccessToken,
+		Type:      utils.TokenTypeAccess,
+		FamilyID:  familyID,
+		ExpiresAt: pair.AccessExpiresAt,
+		UserAgent: c.Request.UserAgent(),
+		ClientIP:  c.ClientIP(),
+	}
+	pair.RefreshRecord = models.Token{
+		UserID:    user.ID,
+		Token:     pair.RefreshToken,
+		Type:      utils.TokenTypeRefresh,
+		FamilyID:  familyID,
+		ExpiresAt: pair.RefreshExpiresAt,
+		UserAgent: c.Request.UserAgent(),
+		ClientIP:  c.ClientIP(),
+	}
+
+	if err := tx.Create(&accessRecord).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&pair.RefreshRecord).Error; err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// revokeTokenFamily 撤销同一令牌家族下的所有未撤销令牌
+func revokeTokenFamily(tx *gorm.DB, familyID string) error {
+	now := time.Now()
+	return tx.Model(&models.Token{}).
+		Where("family_id = ? AND is_revoked = ?", familyID, false).
+		Updates(map[string]interface{}{"is_revoked": true, "revoked_at": &now}).Error
+}
+
+// errRefreshTokenReused 已轮换的刷新令牌被再次使用
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// @Summary 刷新令牌
+// @Description 使用刷新令牌换取新的访问令牌和刷新令牌，旧的刷新令牌随即失效；重复使用已轮换的刷新令牌会注销整个登录会话
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} map[string]interface{} "新的访问令牌和刷新令牌"
+// @Failure 400 {object} map[string]interface{} "请求参数错误"
+// @Failure 401 {object} map[string]interface{} "刷新令牌无效、已过期或已被重复使用"
+// @Failure 403 {object} map[string]interface{} "账户已被禁用"
+// @Router /token/refresh [post]
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	claims, err := utils.ParseToken(req.RefreshToken)
+	if err != nil || claims.Type != utils.TokenTypeRefresh {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效或已过期的刷新令牌"})
+		return
+	}
+
+	var (
+		pair        *tokenPair
+		inactive    bool
+		reuseFamily string
+	)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定刷新令牌记录，保证并发刷新时只有一个请求能完成轮换
+		var record models.Token
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token = ? AND type = ?", req.RefreshToken, utils.TokenTypeRefresh).
+			First(&record).Error; err != nil {
+			return err
+		}
+
+		if record.IsRevoked {
+			// 已轮换过的刷新令牌被重放，视为令牌泄露
+			if record.ReplacedByID != nil {
+				reuseFamily = record.FamilyID
+				return errRefreshTokenReused
+			}
+			return gorm.ErrRecordNotFound
+		}
+		if record.ExpiresAt.Before(time.Now()) {
+			return gorm.ErrRecordNotFound
+		}
+
+		var user models.User
+		if err := tx.First(&user, record.UserID).Error; err != nil {
+			return err
+		}
+		if user.Status != "active" {
+			inactive = true
+			return revokeTokenFamily(tx, record.FamilyID)
+		}
+
+		// 轮换前先撤销该会话中仍有效的旧令牌
+		if err := revokeTokenFamily(tx, record.FamilyID); err != nil {
+			return err
+		}
+
+		if pair, err = issueTokenPair(tx, c, &user, record.FamilyID); err != nil {
+			return err
+		}
+
+		return tx.Model(&record).Update("replaced_by_id", pair.RefreshRecord.ID).Error
+	})
+
+	switch {
+	case errors.Is(err, errRefreshTokenReused):
+		// 事务已回滚，在事务外注销整个令牌家族
+		if err := revokeTokenFamily(config.DB, reuseFamily); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "检测到刷新令牌被重复使用，该登录会话已失效，请重新登录"})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效或已过期的刷新令牌"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新令牌失败"})
+		return
+	case inactive:
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pair.response())
+}
+
+// revokeUserTokens 撤销用户的所有未撤销令牌
+func revokeUserTokens(tx *gorm.DB, userID uint) error {
+	now := time.Now()
+	return tx.Model(&models.Token{}).
+		Where("user_id = ? AND is_revoked = ?", userID, false).
+		Updates(map[string]interface{}{"is_revoked": true, "revoked_at": &now}).Error
+}
+
+// revokeSession 撤销令牌所在的登录会话，旧令牌没有家族ID时只撤销其本身
+func revokeSession(tx *gorm.DB, token *models.Token) error {
+	if token.FamilyID != "" {
+		return revokeTokenFamily(tx, token.FamilyID)
+	}
+	now := time.Now()
+	return tx.Model(token).Updates(map[string]interface{}{"is_revoked": true, "revoked_at": &now}).Error
+}
+
+// @Summary 获取JWT公钥集合
+// @Description 返回用于验证本系统签发令牌的公钥（JWKS），供其他校园服务验签使用；HS256 对称密钥不会公开
+// @Tags 认证
+// @Produce json
+// @Success 200 {object} utils.JSONWebKeySet "公钥集合"
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	set, err := utils.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取公钥失败"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,653 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 二次验证相关默认配置
+const (
+	defaultTwoFactorChallengeTTL = 5 * time.Minute  // 挑战令牌默认有效期
+	defaultTwoFactorMaxAttempts  = 5                // 连续校验失败上限，达到后锁定一段时间
+	defaultTwoFactorLockout      = 15 * time.Minute // 连续失败达到上限后的锁定时长，可通过 TWO_FACTOR_LOCKOUT 配置
+	defaultTOTPIssuer            = "心理健康系统"         // 验证器应用中显示的签发方
+	recoveryCodeCount            = 10               // 每次生成的恢复码数量
+)
+
+// TwoFactorChallengeRequest 登录第二步请求结构
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`          // 验证器应用中的动态码
+	RecoveryCode   string `json:"recovery_code"` // 恢复码，动态码不可用时使用
+}
+
+// TwoFactorCodeRequest 已登录用户提交动态码的请求结构
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTwoFactorRequest 关闭二次验证请求结构
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	TwoFactorCodeRequest
+}
+
+// errTooManyTwoFactorAttempts 二次验证连续失败次数过多
+var errTooManyTwoFactorAttempts = errors.New("too many two-factor attempts")
+
+// roleRequiresTwoFactor 角色是否被强制要求二次验证，通过 TWO_FACTOR_REQUIRED_ROLES 配置（如 admin,counselor）
+func roleRequiresTwoFactor(role string) bool {
+	for _, r := range strings.Split(os.Getenv("TWO_FACTOR_REQUIRED_ROLES"), ",") {
+		if strings.TrimSpace(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTwoFactor 查询用户的二次验证配置，不存在时返回nil
+func loadTwoFactor(tx *gorm.DB, userID uint) (*models.TwoFactor, error) {
+	var tf models.TwoFactor
+	err := tx.Where("user_id = ?", userID).First(&tf).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// twoFactorChallenge 密码校验通过后判断是否需要二次验证，需要时返回挑战令牌响应，否则返回nil
+func twoFactorChallenge(tx *gorm.DB, user *models.User) (gin.H, error) {
+	tf, err := loadTwoFactor(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	enrolled := tf != nil && tf.Enabled
+	if !enrolled && !roleRequiresTwoFactor(user.Role) {
+		return nil, nil
+	}
+
+	ttl := utils.DurationFromEnv("TWO_FACTOR_CHALLENGE_TTL", defaultTwoFactorChallengeTTL)
+	token, err := utils.GenerateToken(user.ID, user.Role, utils.TokenTypeTwoFactor, time.Now().Add(ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"two_factor_required": true,
+		"enrolled":            enrolled, // false 表示角色要求二次验证但尚未绑定，需先调用 /login/2fa/setup
+		"challenge_token":     token,
+		"expires_in":          int64(ttl.Seconds()),
+	}, nil
+}
+
+// parseChallengeUser 校验挑战令牌并返回对应的有效用户
+func parseChallengeUser(tx *gorm.DB, challengeToken string) (*models.User, bool) {
+	claims, err := utils.ParseToken(challengeToken)
+	if err != nil || claims.Type != utils.TokenTypeTwoFactor {
+		return nil, false
+	}
+	var user models.User
+	if err := tx.First(&user, claims.UserID).Error; err != nil || user.Status != "active" {
+		return nil, false
+	}
+	return &user, true
+}
+
+// startTwoFactorSetup 生成新的待绑定密钥，覆盖尚未启用的旧密钥
+func startTwoFactorSetup(tx *gorm.DB, user *models.User) (gin.H, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tf, err := loadTwoFactor(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		err = tx.Create(&models.TwoFactor{UserID: user.ID, Secret: secret}).Error
+	} else {
+		err = tx.Model(tf).Updates(map[string]interface{}{
+			"secret":          secret,
+			"last_used_step":  0,
+			"failed_attempts": 0,
+			"locked_until":    nil,
+		}).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	return gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(issuer, user.Username, secret),
+	}, nil
+}
+
+// hashRecoveryCode 计算恢复码哈希，忽略大小写、空格和连字符
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes 重新生成恢复码，旧的恢复码全部失效；返回的明文只展示一次
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.RandomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor 在事务中锁定二次验证配置并校验动态码或恢复码
+// 校验失败时累加失败次数（调用方需提交事务），连续失败达到上限后在锁定期内拒绝校验；
+// 失败次数只在二次验证通过或锁定期结束后清零，重新登录不会重置。返回是否通过
+func verifySecondFactor(tx *gorm.DB, userID uint, code, recoveryCode string) (*models.TwoFactor, bool, error) {
+	var tf models.TwoFactor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).First(&tf).Error; err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	maxAttempts := utils.IntFromEnv("TWO_FACTOR_MAX_ATTEMPTS", defaultTwoFactorMaxAttempts)
+	if tf.FailedAttempts >= maxAttempts {
+		if tf.LockedUntil != nil && now.Before(*tf.LockedUntil) {
+			return &tf, false, errTooManyTwoFactorAttempts
+		}
+		// 锁定期已过，重新计数
+		if err := tx.Model(&tf).Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil}).Error; err != nil {
+			return &tf, false, err
+		}
+		tf.FailedAttempts = 0
+	}
+
+	switch {
+	case code != "":
+		if step, ok := utils.ValidateTOTP(tf.Secret, code, time.Now(), tf.LastUsedStep); ok {
+			err := tx.Model(&tf).Updates(map[string]interface{}{
+				"last_used_step": step, "failed_attempts": 0, "locked_until": nil,
+			}).Error
+			return &tf, true, err
+		}
+	case recoveryCode != "" && tf.Enabled:
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(recoveryCode)).
+			Update("used_at", &now)
+		if result.Error != nil {
+			return &tf, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			err := tx.Model(&tf).Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil}).Error
+			return &tf, true, err
+		}
+	}
+
+	updates := map[string]interface{}{"failed_attempts": gorm.Expr("failed_attempts + 1")}
+	if tf.FailedAttempts+1 >= maxAttempts {
+		lockedUntil := now.Add(utils.DurationFromEnv("TWO_FACTOR_LOCKOUT", defaultTwoFactorLockout))
+		updates["locked_until"] = &lockedUntil
+	}
+	err := tx.Model(&tf).Updates(updates).Error
+	return &tf, false, err
+}
+
+// enableTwoFactor 启用二次验证并生成恢复码
+func enableTwoFactor(tx *gorm.DB, tf *models.TwoFactor) ([]string, error) {
+	now := time.Now()
+	if err := tx.Model(tf).Updates(map[string]interface{}{"enabled": true, "enabled_at": &now}).Error; err != nil {
+		return nil, err
+	}
+	return generateRecoveryCodes(tx, tf.UserID)
+}
+
+// @Summary 登录时绑定二次验证
+// @Description 角色要求二次验证但尚未绑定时，使用挑战令牌获取TOTP密钥和扫码URI
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body TwoFactorChallengeRequest true "挑战令牌"
+// @Success 200 {object} map[string]interface{} "TOTP密钥和扫码URI"
+// @Failure 401 {object} map[string]interface{} "挑战令牌无效或已过期"
+// @Failure 409 {object} map[string]interface{} "已启用二次验证"
+// @Router /login/2fa/setup [post]
+func SetupTwoFactorOnLogin(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	user, ok := parseChallengeUser(config.DB, req.ChallengeToken)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "挑战令牌无效或已过期，请重新登录"})
+		return
+	}
+
+	tf, err := loadTwoFactor(config.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取二次验证信息失败"})
+		return
+	}
+	if tf != nil && tf.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已启用二次验证"})
+		return
+	}
+
+	resp, err := startTwoFactorSetup(config.DB, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成二次验证密钥失败"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary 登录第二步：二次验证
+// @Description 使用挑战令牌和动态码（或恢复码）完成登录；首次绑定时同时启用二次验证并返回恢复码
+// @Tags 认证
+// @Accept json
+// @Produce json
+// @Param data body TwoFactorChallengeRequest true "挑战令牌和动态码"
+// @Success 200 {object} map[string]interface{} "登录成功返回用户信息、访问令牌和刷新令牌"
+// @Failure 401 {object} map[string]interface{} "挑战令牌无效或动态码错误"
+// @Failure 403 {object} map[string]interface{} "密码已过期，返回修改密码令牌"
+// @Failure 429 {object} map[string]interface{} "失败次数过多"
+// @Router /login/2fa [post]
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	user, ok := parseChallengeUser(config.DB, req.ChallengeToken)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "挑战令牌无效或已过期，请重新登录"})
+		return
+	}
+
+	// 与密码校验共用账户锁定和渐进延迟
+	if reason, wait := loginBlocked(user, time.Now()); reason != "" {
+		recordLoginAttempt(c, &user.ID, user.Username, false, reason)
+		respondLoginBlocked(c, reason, wait)
+		return
+	}
+
+	var (
+		pair          *tokenPair
+		recoveryCodes []string
+		verified      bool
+		expired       gin.H
+	)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		tf, ok, err := verifySecondFactor(tx, user.ID, req.Code, req.RecoveryCode)
+		if err != nil || !ok {
+			return err
+		}
+		verified = true
+
+		// 强制绑定流程：首次校验通过即启用
+		if !tf.Enabled {
+			if recoveryCodes, err = enableTwoFactor(tx, tf); err != nil {
+				return err
+			}
+		}
+
+		// 员工账户密码过期时需先修改密码
+		if expired, err = passwordExpiredResponse(user); err != nil || expired != nil {
+			return err
+		}
+
+		pair, err = issueTokenPair(tx, c, user, "")
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未绑定二次验证"})
+		return
+	case errors.Is(err, errTooManyTwoFactorAttempts):
+		recordLoginAttempt(c, &user.ID, user.Username, false, loginAttemptReasonLocked)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证失败次数过多，请稍后再试"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "二次验证失败"})
+		return
+	case !verified:
+		recordLoginAttempt(c, &user.ID, user.Username, false, loginAttemptReasonTwoFactor)
+		respondLoginFailure(c, user.ID, "动态码或恢复码错误")
+		return
+	}
+
+	// 二次验证通过才算登录成功，此时才清除登录失败计数
+	recordLoginAttempt(c, &user.ID, user.Username, true, "")
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		clearLoginFailures(config.DB, user.ID)
+	}
+
+	if expired != nil {
+		if recoveryCodes != nil {
+			expired["recovery_codes"] = recoveryCodes
+		}
+		c.JSON(http.StatusForbidden, expired)
+		return
+	}
+
+	resp := pair.response()
+	resp["user"] = loginUserInfo(user)
+	if recoveryCodes != nil {
+		resp["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary 获取二次验证状态
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "二次验证状态"
+// @Router /users/me/2fa [get]
+func GetTwoFactorStatus(c *gin.Context) {
+	userID := currentUserID(c)
+	tf, err := loadTwoFactor(config.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取二次验证信息失败"})
+		return
+	}
+
+	var remaining int64
+	if tf != nil && tf.Enabled {
+		config.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  tf != nil && tf.Enabled,
+		"required":                 roleRequiresTwoFactor(currentUserRole(c)),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// @Summary 开始绑定二次验证
+// @Description 生成TOTP密钥和扫码URI，需调用启用接口提交动态码后才生效
+// @Tags 用户
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "TOTP密钥和扫码URI"
+// @Failure 409 {object} map[string]interface{} "已启用二次验证"
+// @Router /users/me/2fa/setup [post]
+func SetupTwoFactor(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	tf, err := loadTwoFactor(config.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取二次验证信息失败"})
+		return
+	}
+	if tf != nil && tf.Enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已启用二次验证"})
+		return
+	}
+
+	resp, err := startTwoFactorSetup(config.DB, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成二次验证密钥失败"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary 启用二次验证
+// @Description 提交验证器应用中的动态码完成绑定，返回一次性展示的恢复码
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body TwoFactorCodeRequest true "动态码"
+// @Success 200 {object} map[string]interface{} "启用成功返回恢复码"
+// @Failure 400 {object} map[string]interface{} "动态码错误"
+// @Router /users/me/2fa/enable [post]
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var (
+		codes    []string
+		verified bool
+		enabled  bool
+	)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		tf, ok, err := verifySecondFactor(tx, currentUserID(c), req.Code, "")
+		if err != nil || !ok {
+			return err
+		}
+		verified = true
+		if tf.Enabled {
+			enabled = true
+			return nil
+		}
+		codes, err = enableTwoFactor(tx, tf)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先生成二次验证密钥"})
+		return
+	case errors.Is(err, errTooManyTwoFactorAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证失败次数过多，请重新生成密钥"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "启用二次验证失败"})
+		return
+	case !verified:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "动态码错误"})
+		return
+	case enabled:
+		c.JSON(http.StatusConflict, gin.H{"error": "已启用二次验证"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "二次验证已启用", "recovery_codes": codes})
+}
+
+// @Summary 重新生成恢复码
+// @Description 校验动态码后重新生成恢复码，旧的恢复码全部失效
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body TwoFactorCodeRequest true "动态码"
+// @Success 200 {object} map[string]interface{} "新的恢复码"
+// @Failure 400 {object} map[string]interface{} "动态码错误或未启用二次验证"
+// @Router /users/me/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var (
+		codes    []string
+		verified bool
+	)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		tf, ok, err := verifySecondFactor(tx, currentUserID(c), req.Code, "")
+		if err != nil || !ok {
+			return err
+		}
+		if !tf.Enabled {
+			return gorm.ErrRecordNotFound
+		}
+		verified = true
+		codes, err = generateRecoveryCodes(tx, tf.UserID)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未启用二次验证"})
+		return
+	case errors.Is(err, errTooManyTwoFactorAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证失败次数过多，请稍后再试"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	case !verified:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "动态码错误"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// @Summary 关闭二次验证
+// @Description 校验密码和动态码（或恢复码）后关闭二次验证；角色被强制要求二次验证时不可关闭
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body DisableTwoFactorRequest true "密码和动态码"
+// @Success 200 {object} map[string]interface{} "关闭成功"
+// @Failure 400 {object} map[string]interface{} "密码或动态码错误"
+// @Failure 403 {object} map[string]interface{} "当前角色必须启用二次验证"
+// @Router /users/me/2fa [delete]
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if roleRequiresTwoFactor(currentUserRole(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "当前角色必须启用二次验证"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, currentUserID(c)).Error; err != nil || !user.ValidatePassword(req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+
+	var verified bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		_, ok, err := verifySecondFactor(tx, user.ID, req.Code, req.RecoveryCode)
+		if err != nil || !ok {
+			return err
+		}
+		verified = true
+		return deleteTwoFactor(tx, user.ID)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未启用二次验证"})
+		return
+	case errors.Is(err, errTooManyTwoFactorAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证失败次数过多，请稍后再试"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭二次验证失败"})
+		return
+	case !verified:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "动态码或恢复码错误"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "二次验证已关闭"})
+}
+
+// deleteTwoFactor 删除用户的二次验证配置和恢复码
+func deleteTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// @Summary 重置用户二次验证
+// @Description 管理员清除指定用户的二次验证绑定（例如设备丢失），同时注销其所有登录会话
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "重置成功"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Failure 403 {object} map[string]interface{} "无权管理该用户"
+// @Router /users/{id}/2fa [delete]
+func ResetUserTwoFactor(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置二次验证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "二次验证已重置"})
+}
@@ -1,56 +1,689 @@
 package controllers
 
 import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// CreateUser 创建用户
+// StudentProfileInput 学生档案字段
+type StudentProfileInput struct {
+	StudentID      *string `json:"student_id" binding:"omitempty,max=50"`
+	Major          *string `json:"major" binding:"omitempty,max=100"`
+	ClassName      *string `json:"class_name" binding:"omitempty,max=50"`
+	Grade          *string `json:"grade" binding:"omitempty,max=20"`
+	EnrollmentDate *string `json:"enrollment_date"` // 格式 2006-01-02
+	GraduationDate *string `json:"graduation_date"` // 格式 2006-01-02
+	Dormitory      *string `json:"dormitory" binding:"omitempty,max=50"`
+}
+
+// CounselorProfileInput 咨询师档案字段
+type CounselorProfileInput struct {
+	EmployeeID     *string `json:"employee_id" binding:"omitempty,max=50"`
+	Title          *string `json:"title" binding:"omitempty,max=50"`
+	Specialty      *string `json:"specialty" binding:"omitempty,max=200"`
+	Introduction   *string `json:"introduction"`
+	Department     *string `json:"department" binding:"omitempty,max=100"`
+	OfficeLocation *string `json:"office_location" binding:"omitempty,max=100"`
+	Status         *int    `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// CreateUserRequest 管理员创建用户请求结构
+type CreateUserRequest struct {
+	Username  string                 `json:"username" binding:"required,min=3,max=50"`
+	Password  string                 `json:"password" binding:"required"`
+	Name      string                 `json:"name" binding:"max=50"`
+	Sex       string                 `json:"sex" binding:"max=10"`
+	Phone     string                 `json:"phone" binding:"max=20"`
+	Email     string                 `json:"email" binding:"omitempty,email,max=100"`
+	Role      string                 `json:"role" binding:"required"`
+	Status    string                 `json:"status" binding:"omitempty,oneof=active inactive blocked"`
+	Remark    string                 `json:"remark" binding:"max=500"`
+	Student   *StudentProfileInput   `json:"student"`
+	Counselor *CounselorProfileInput `json:"counselor"`
+}
+
+// UpdateUserRequest 管理员修改用户请求结构，未提交的字段保持不变
+type UpdateUserRequest struct {
+	Name      *string                `json:"name" binding:"omitempty,max=50"`
+	Sex       *string                `json:"sex" binding:"omitempty,max=10"`
+	Phone     *string                `json:"phone" binding:"omitempty,max=20"`
+	Email     *string                `json:"email" binding:"omitempty,email,max=100"`
+	Role      *string                `json:"role"`
+	Status    *string                `json:"status" binding:"omitempty,oneof=active inactive blocked"`
+	Remark    *string                `json:"remark" binding:"omitempty,max=500"`
+	Password  *string                `json:"password"` // 管理员重置密码，成功后该用户所有会话失效
+	Student   *StudentProfileInput   `json:"student"`
+	Counselor *CounselorProfileInput `json:"counselor"`
+}
+
+// userSortColumns 用户列表允许排序的字段
+var userSortColumns = map[string]string{
+	"id":              "users.id",
+	"username":        "users.username",
+	"name":            "users.name",
+	"role":            "users.role",
+	"status":          "users.status",
+	"created_at":      "users.created_at",
+	"updated_at":      "users.updated_at",
+	"student_id":      "students.student_id",
+	"grade":           "students.grade",
+	"major":           "students.major",
+	"employee_id":     "counselors.employee_id",
+	"department":      "counselors.department",
+	"enrollment_date": "students.enrollment_date",
+}
+
+// errUserConflict 用户名、手机号、邮箱、学号或工号已被占用
+type errUserConflict struct{ field string }
+
+func (e *errUserConflict) Error() string { return e.field + "已存在" }
+
+// escapeLike 转义 LIKE 查询中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// userListQuery 根据筛选参数构建用户查询，列表和导出共用
+// 支持 role/status/keyword/grade/major/class_name/department 筛选，deleted=only 查询已删除用户
+func userListQuery(c *gin.Context) *gorm.DB {
+	query := config.DB.Model(&models.User{}).
+		Joins("LEFT JOIN students ON students.user_id = users.id AND students.deleted_at IS NULL").
+		Joins("LEFT JOIN counselors ON counselors.user_id = users.id AND counselors.deleted_at IS NULL")
+
+	if c.Query("deleted") == "only" {
+		query = query.Unscoped().Where("users.deleted_at IS NOT NULL")
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("users.role = ?", role)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("users.status = ?", status)
+	}
+	if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+		like := "%" + escapeLike(keyword) + "%"
+		query = query.Where("users.username ILIKE ? OR users.name ILIKE ? OR users.phone ILIKE ? OR students.student_id ILIKE ? OR counselors.employee_id ILIKE ?",
+			like, like, like, like, like)
+	}
+	if grade := c.Query("grade"); grade != "" {
+		query = query.Where("students.grade = ?", grade)
+	}
+	if major := c.Query("major"); major != "" {
+		query = query.Where("students.major = ?", major)
+	}
+	if className := c.Query("class_name"); className != "" {
+		query = query.Where("students.class_name = ?", className)
+	}
+	if department := c.Query("department"); department != "" {
+		query = query.Where("counselors.department = ?", department)
+	}
+	return query
+}
+
+// userListOrder 解析排序参数 sort_by/order，默认按创建时间倒序
+func userListOrder(c *gin.Context) string {
+	column, ok := userSortColumns[c.Query("sort_by")]
+	if !ok {
+		column = "users.created_at"
+	}
+	direction := "DESC"
+	if strings.EqualFold(c.Query("order"), "asc") {
+		direction = "ASC"
+	}
+	return column + " " + direction + ", users.id " + direction
+}
+
+// preloadProfiles 预加载学生/咨询师档案，包含已软删除的档案以便展示已删除用户
+func preloadProfiles(query *gorm.DB) *gorm.DB {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	return query.Preload("Student", unscoped).Preload("Counselor", unscoped)
+}
+
+// roleExists 判断角色是否存在
+func roleExists(tx *gorm.DB, name string) bool {
+	var count int64
+	tx.Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+// canManageRole 当前用户的权限是否覆盖目标角色的全部权限，不能管理权限比自己大的用户
+func canManageRole(c *gin.Context, role string) bool {
+	return config.RoleCovers(currentUserRole(c), role)
+}
+
+// canAssignRole 当前用户能否为用户指定角色：学生以外的角色需要角色管理权限，且不能超出自己的权限
+func canAssignRole(c *gin.Context, role string) bool {
+	if role != "student" && !config.HasPermission(currentUserRole(c), "role:manage") {
+		return false
+	}
+	return canManageRole(c, role)
+}
+
+// parseDate 解析 2006-01-02 格式的日期，空字符串返回零值
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// checkUserUnique 检查用户名、手机号、邮箱是否被其他用户（含已删除用户）占用
+func checkUserUnique(tx *gorm.DB, excludeID uint, username, phone, email string) error {
+	checks := []struct{ column, value, field string }{
+		{"username", username, "用户名"},
+		{"phone", phone, "手机号"},
+		{"email", email, "邮箱"},
+	}
+	for _, ch := range checks {
+		if ch.value == "" {
+			continue
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).
+			Where(ch.column+" = ? AND id <> ?", ch.value, excludeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return &errUserConflict{field: ch.field}
+		}
+	}
+	return nil
+}
+
+// applyStudentProfile 将提交的学生档案字段写入模型
+func applyStudentProfile(tx *gorm.DB, s *models.Student, in *StudentProfileInput) error {
+	if in == nil {
+		return nil
+	}
+	if in.StudentID != nil && *in.StudentID != s.StudentID && *in.StudentID != "" {
+		var count int64
+		tx.Unscoped().Model(&models.Student{}).Where("student_id = ? AND id <> ?", *in.StudentID, s.ID).Count(&count)
+		if count > 0 {
+			return &errUserConflict{field: "学号"}
+		}
+	}
+	setString(&s.StudentID, in.StudentID)
+	setString(&s.Major, in.Major)
+	setString(&s.ClassName, in.ClassName)
+	setString(&s.Grade, in.Grade)
+	setString(&s.Dormitory, in.Dormitory)
+	if in.EnrollmentDate != nil {
+		d, err := parseDate(*in.EnrollmentDate)
+		if err != nil {
+			return err
+		}
+		s.EnrollmentDate = d
+	}
+	if in.GraduationDate != nil {
+		d, err := parseDate(*in.GraduationDate)
+		if err != nil {
+			return err
+		}
+		s.GraduationDate = d
+	}
+	return nil
+}
+
+// applyCounselorProfile 将提交的咨询师档案字段写入模型
+func applyCounselorProfile(tx *gorm.DB, co *models.Counselor, in *CounselorProfileInput) error {
+	if in == nil {
+		return nil
+	}
+	if in.EmployeeID != nil && *in.EmployeeID != co.EmployeeID && *in.EmployeeID != "" {
+		var count int64
+		tx.Unscoped().Model(&models.Counselor{}).Where("employee_id = ? AND id <> ?", *in.EmployeeID, co.ID).Count(&count)
+		if count > 0 {
+			return &errUserConflict{field: "工号"}
+		}
+	}
+	setString(&co.EmployeeID, in.EmployeeID)
+	setString(&co.Title, in.Title)
+	setString(&co.Specialty, in.Specialty)
+	setString(&co.Introduction, in.Introduction)
+	setString(&co.Department, in.Department)
+	setString(&co.OfficeLocation, in.OfficeLocation)
+	if in.Status != nil {
+		co.Status = *in.Status
+	}
+	return nil
+}
+
+// setString 提交了该字段时才覆盖原值
+func setString(dst *string, src *string) {
+	if src != nil {
+		*dst = strings.TrimSpace(*src)
+	}
+}
+
+// saveProfile 创建或更新用户对应角色的档案
+func saveProfile(tx *gorm.DB, user *models.User, student *StudentProfileInput, counselor *CounselorProfileInput) error {
+	switch user.Role {
+	case "student":
+		var s models.Student
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).First(&s).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		s.UserID = user.ID
+		s.DeletedAt = gorm.DeletedAt{}
+		if err := applyStudentProfile(tx, &s, student); err != nil {
+			return err
+		}
+		return tx.Unscoped().Save(&s).Error
+	case "counselor":
+		var co models.Counselor
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).First(&co).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			co.Status = 1
+		}
+		co.UserID = user.ID
+		co.DeletedAt = gorm.DeletedAt{}
+		if err := applyCounselorProfile(tx, &co, counselor); err != nil {
+			return err
+		}
+		return tx.Unscoped().Save(&co).Error
+	}
+	return nil
+}
+
+// respondUserError 将用户写操作中的错误转换为响应
+func respondUserError(c *gin.Context, err error, fallback string) {
+	var conflict *errUserConflict
+	var parseErr *time.ParseError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": conflict.Error()})
+	case errors.As(err, &parseErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误，应为 YYYY-MM-DD"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// @Summary 创建用户
+// @Description 管理员创建用户，并在同一事务中创建对应的学生或咨询师档案
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body CreateUserRequest true "用户信息"
+// @Success 200 {object} map[string]interface{} "创建成功"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或密码不符合安全策略"
+// @Failure 409 {object} map[string]interface{} "用户名、手机号、邮箱、学号或工号已存在"
+// @Failure 403 {object} map[string]interface{} "无权分配该角色"
+// @Router /users [post]
 func CreateUser(c *gin.Context) {
-	// TODO: 实现用户创建逻辑
-	// 1. 验证请求数据
-	// 2. 密码加密
-	// 3. 保存到数据库
-	// 4. 返回创建结果
-	c.JSON(http.StatusOK, gin.H{"message": "创建用户接口待实现"})
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+	if !roleExists(config.DB, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户角色"})
+		return
+	}
+	if !canAssignRole(c, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权分配该角色"})
+		return
+	}
+	violations, err := checkNewPassword(config.DB, 0, req.Username, req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	now := time.Now()
+	user := models.User{
+		Username:          req.Username,
+		Password:          req.Password, // 密码会在 BeforeSave 钩子中自动加密
+		Name:              req.Name,
+		Sex:               req.Sex,
+		Phone:             req.Phone,
+		Email:             req.Email,
+		Role:              req.Role,
+		Status:            req.Status,
+		Remark:            req.Remark,
+		PasswordChangedAt: &now,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkUserUnique(tx, 0, user.Username, user.Phone, user.Email); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := recordPasswordHistory(tx, user.ID, user.Password); err != nil {
+			return err
+		}
+		return saveProfile(tx, &user, req.Student, req.Counselor)
+	})
+	if err != nil {
+		respondUserError(c, err, "创建用户失败")
+		return
+	}
+
+	preloadProfiles(config.DB).First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "创建成功", "user": user})
 }
 
-// GetUserList 获取用户列表
+// @Summary 获取用户列表
+// @Description 分页查询用户，支持按角色、状态、关键字（用户名/姓名/手机号/学号/工号）、年级、专业、班级、部门筛选及排序
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Param role query string false "角色"
+// @Param status query string false "状态：active/inactive/blocked"
+// @Param keyword query string false "关键字"
+// @Param grade query string false "年级"
+// @Param major query string false "专业"
+// @Param class_name query string false "班级"
+// @Param department query string false "部门"
+// @Param deleted query string false "only：仅查询已删除用户"
+// @Param sort_by query string false "排序字段：id/username/name/role/status/created_at/updated_at/student_id/grade/major/employee_id/department/enrollment_date"
+// @Param order query string false "排序方向：asc/desc，默认desc"
+// @Success 200 {object} map[string]interface{} "用户列表"
+// @Router /users [get]
 func GetUserList(c *gin.Context) {
-	// TODO: 实现获取用户列表逻辑
-	// 1. 处理分页参数
-	// 2. 处理筛选条件
-	// 3. 查询数据库
-	// 4. 返回用户列表
-	c.JSON(http.StatusOK, gin.H{"message": "获取用户列表接口待实现"})
+	var total int64
+	if err := userListQuery(c).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var users []models.User
+	if err := preloadProfiles(userListQuery(c)).Select("users.*").Order(userListOrder(c)).
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list":      users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
 }
 
-// GetUserByID 获取用户详情
+// @Summary 获取用户详情
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "用户信息（含学生或咨询师档案）"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Router /users/{id} [get]
 func GetUserByID(c *gin.Context) {
-	// TODO: 实现获取用户详情逻辑
-	// 1. 获取用户ID
-	// 2. 查询数据库
-	// 3. 返回用户信息
-	c.JSON(http.StatusOK, gin.H{"message": "获取用户详情接口待实现"})
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := preloadProfiles(config.DB).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
-// UpdateUser 更新用户信息
+// @Summary 修改用户
+// @Description 管理员修改用户信息及其档案；禁用用户或重置密码会注销其所有登录会话
+// @Tags 用户管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Param data body UpdateUserRequest true "用户信息"
+// @Success 200 {object} map[string]interface{} "修改成功"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Failure 409 {object} map[string]interface{} "手机号、邮箱、学号或工号已存在"
+// @Failure 403 {object} map[string]interface{} "无权管理该用户或分配该角色"
+// @Router /users/{id} [put]
 func UpdateUser(c *gin.Context) {
-	// TODO: 实现更新用户信息逻辑
-	// 1. 获取用户ID
-	// 2. 验证请求数据
-	// 3. 更新数据库
-	// 4. 返回更新结果
-	c.JSON(http.StatusOK, gin.H{"message": "更新用户接口待实现"})
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数", "details": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+		return
+	}
+	if req.Role != nil && !roleExists(config.DB, *req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户角色"})
+		return
+	}
+	if req.Role != nil && *req.Role != user.Role && !canAssignRole(c, *req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权分配该角色"})
+		return
+	}
+	if id == currentUserID(c) && ((req.Role != nil && *req.Role != user.Role) || (req.Status != nil && *req.Status != "active")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色或禁用自己"})
+		return
+	}
+	if req.Password != nil {
+		violations, err := checkNewPassword(config.DB, user.ID, user.Username, *req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改用户失败"})
+			return
+		}
+		if len(violations) > 0 {
+			c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+			return
+		}
+	}
+
+	updates := map[string]interface{}{}
+	setField := func(column string, v *string) {
+		if v != nil {
+			updates[column] = strings.TrimSpace(*v)
+		}
+	}
+	setField("name", req.Name)
+	setField("sex", req.Sex)
+	setField("phone", req.Phone)
+	setField("email", req.Email)
+	setField("role", req.Role)
+	setField("status", req.Status)
+	setField("remark", req.Remark)
+
+	// 禁用账户、变更角色或重置密码后旧令牌中的信息已失效
+	revoke := req.Password != nil ||
+		(req.Status != nil && *req.Status != "active") ||
+		(req.Role != nil && *req.Role != user.Role)
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		phone, email := "", ""
+		if req.Phone != nil {
+			phone = strings.TrimSpace(*req.Phone)
+		}
+		if req.Email != nil {
+			email = strings.TrimSpace(*req.Email)
+		}
+		if err := checkUserUnique(tx, user.ID, "", phone, email); err != nil {
+			return err
+		}
+
+		if len(updates) > 0 {
+			// 使用 UpdateColumns 跳过 BeforeSave，避免密码哈希被重复加密
+			if err := tx.Model(&user).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			if err := tx.First(&user, user.ID).Error; err != nil {
+				return err
+			}
+		}
+		if req.Password != nil {
+			if err := setUserPassword(tx, user.ID, *req.Password); err != nil {
+				return err
+			}
+		}
+		if req.Student != nil || req.Counselor != nil || req.Role != nil {
+			if err := saveProfile(tx, &user, req.Student, req.Counselor); err != nil {
+				return err
+			}
+		}
+		if revoke {
+			return revokeUserTokens(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		respondUserError(c, err, "修改用户失败")
+		return
+	}
+
+	preloadProfiles(config.DB).First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "修改成功", "user": user})
 }
 
-// DeleteUser 删除用户
+// @Summary 删除用户
+// @Description 软删除用户及其档案并注销所有登录会话，尚未开始的预约一并取消；可通过恢复接口还原，已取消的预约不会恢复
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "删除成功"
+// @Failure 404 {object} map[string]interface{} "用户不存在"
+// @Failure 403 {object} map[string]interface{} "无权管理该用户"
+// @Router /users/{id} [delete]
 func DeleteUser(c *gin.Context) {
-	// TODO: 实现删除用户逻辑
-	// 1. 获取用户ID
-	// 2. 验证权限
-	// 3. 执行删除操作
-	// 4. 返回删除结果
-	c.JSON(http.StatusOK, gin.H{"message": "删除用户接口待实现"})
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	if id == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能删除自己"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+		return
+	}
+
+	var released []uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 尚未开始的预约一并取消，避免被删除的咨询师的预约继续占用学生或被标记为爽约
+		var err error
+		if released, err = cancelDepartedUserAppointments(tx, user.ID, "用户账户已删除", time.Now()); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Student{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Counselor{}).Error; err != nil {
+			return err
+		}
+		if err := revokeUserTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "删除用户失败")
+		return
+	}
+	for _, slotID := range released {
+		promoteWaitlist(slotID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// @Summary 恢复已删除用户
+// @Description 还原被软删除的用户及其档案
+// @Tags 用户管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} map[string]interface{} "恢复成功"
+// @Failure 404 {object} map[string]interface{} "已删除的用户不存在"
+// @Failure 409 {object} map[string]interface{} "用户的个人数据已删除，无法恢复"
+// @Failure 403 {object} map[string]interface{} "无权管理该用户"
+// @Router /users/{id}/restore [post]
+func RestoreUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "已删除的用户不存在"})
+		return
+	}
+	// 数据已被删除的账户只保留统计所需的假名记录，不能恢复
+	if user.Status == "erased" {
+		c.JSON(http.StatusConflict, gin.H{"error": "该用户的个人数据已删除，无法恢复"})
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权管理该用户"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Student{}).Where("user_id = ?", user.ID).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Counselor{}).Where("user_id = ?", user.ID).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复用户失败"})
+		return
+	}
+
+	preloadProfiles(config.DB).First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "恢复成功", "user": user})
 }
@@ -0,0 +1,577 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 名单导入导出相关配置
+const (
+	importMaxFileSize      = 10 << 20 // 导入文件最大10MB
+	importMaxRows          = 10000    // 单次导入的最大数据行数
+	defaultImportBatchSize = 200      // 每个事务写入的行数，可通过 IMPORT_BATCH_SIZE 配置
+	exportMaxRows          = 50000    // 单次导出的最大行数
+	exportPageSize         = 500      // 导出时每次查询的行数
+)
+
+// importColumnAliases 导入文件表头（去除空格、下划线并转小写后）与字段的对应关系，兼容导出文件的中文表头
+var importColumnAliases = map[string]string{
+	"studentid": "student_id", "学号": "student_id",
+	"name": "name", "姓名": "name",
+	"username": "username", "用户名": "username",
+	"password": "password", "密码": "password",
+	"sex": "sex", "gender": "sex", "性别": "sex",
+	"phone": "phone", "手机号": "phone", "手机": "phone",
+	"email": "email", "邮箱": "email",
+	"major": "major", "专业": "major",
+	"classname": "class_name", "class": "class_name", "班级": "class_name",
+	"grade": "grade", "年级": "grade",
+	"enrollmentdate": "enrollment_date", "入学日期": "enrollment_date",
+	"graduationdate": "graduation_date", "毕业日期": "graduation_date", "预计毕业日期": "graduation_date",
+	"dormitory": "dormitory", "宿舍": "dormitory",
+}
+
+// importFieldLimits 导入字段的最大长度
+var importFieldLimits = map[string]int{
+	"student_id": 50, "name": 50, "username": 50, "sex": 10, "major": 100,
+	"class_name": 50, "grade": 20, "dormitory": 50,
+}
+
+// importDateLayouts 导入时支持的日期格式
+var importDateLayouts = []string{"2006-01-02", "2006/01/02", "2006/1/2", "2006-1-2", "2006.01.02", "20060102"}
+
+// errImportDryRun 试运行时回滚事务
+var errImportDryRun = errors.New("dry run")
+
+// errImportRow 导入行不满足写入条件，内容为面向用户的说明
+type errImportRow string
+
+func (e errImportRow) Error() string { return string(e) }
+
+// importRow 校验通过的导入行
+type importRow struct {
+	line           int
+	values         map[string]string
+	enrollmentDate time.Time
+	graduationDate time.Time
+}
+
+// ImportRowError 导入失败的行及原因
+type ImportRowError struct {
+	Row       int      `json:"row"` // 文件中的行号，表头为第1行
+	StudentID string   `json:"student_id"`
+	Errors    []string `json:"errors"`
+}
+
+// readRoster 按扩展名读取 CSV 或 XLSX 文件的所有行
+func readRoster(filename string, data []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		// Excel 导出的 CSV 带有 UTF-8 BOM
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		if !utf8.Valid(data) {
+			return nil, errors.New("CSV 文件需使用 UTF-8 编码")
+		}
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		return r.ReadAll()
+	case ".xlsx":
+		return utils.ReadXLSX(bytes.NewReader(data), int64(len(data)))
+	}
+	return nil, errors.New("仅支持 .csv 和 .xlsx 文件")
+}
+
+// normalizeHeader 统一表头写法
+func normalizeHeader(h string) string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(h)
+}
+
+// parseImportDate 解析导入文件中的日期，支持常见文本格式和 Excel 日期序列号
+func parseImportDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range importDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial > 0 && serial < 2958466 {
+		t := utils.ExcelSerialToTime(serial)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("无法识别的日期: %s", s)
+}
+
+// validateImportRow 校验单行数据的格式
+func validateImportRow(row *importRow) []string {
+	var errs []string
+	v := row.values
+	if v["student_id"] == "" {
+		errs = append(errs, "学号不能为空")
+	}
+	if v["name"] == "" {
+		errs = append(errs, "姓名不能为空")
+	}
+	if v["username"] == "" {
+		v["username"] = v["student_id"]
+	}
+	if n := utf8.RuneCountInString(v["username"]); v["username"] != "" && n < 3 {
+		errs = append(errs, "用户名至少3个字符")
+	}
+	for field, limit := range importFieldLimits {
+		if utf8.RuneCountInString(v[field]) > limit {
+			errs = append(errs, fmt.Sprintf("%s 长度不能超过 %d", field, limit))
+		}
+	}
+	for _, field := range []string{"phone", "email"} {
+		if msg := validateContact(field, v[field]); msg != "" {
+			errs = append(errs, msg)
+		}
+	}
+
+	var err error
+	if row.enrollmentDate, err = parseImportDate(v["enrollment_date"]); err != nil {
+		errs = append(errs, "入学日期格式错误")
+	}
+	if row.graduationDate, err = parseImportDate(v["graduation_date"]); err != nil {
+		errs = append(errs, "毕业日期格式错误")
+	}
+	return errs
+}
+
+// importStudentRow 写入一行数据：学号已存在时更新用户和档案，否则创建新学生
+// 已存在用户的密码不会被导入文件覆盖
+func importStudentRow(tx *gorm.DB, row *importRow, defaultHash string) (created bool, err error) {
+	v := row.values
+
+	var student models.Student
+	err = tx.Unscoped().Where("student_id = ?", v["student_id"]).First(&student).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	profile := map[string]interface{}{}
+	for _, field := range []string{"major", "class_name", "grade", "dormitory"} {
+		if v[field] != "" {
+			profile[field] = v[field]
+		}
+	}
+	if !row.enrollmentDate.IsZero() {
+		profile["enrollment_date"] = row.enrollmentDate
+	}
+	if !row.graduationDate.IsZero() {
+		profile["graduation_date"] = row.graduationDate
+	}
+
+	if err == nil {
+		if student.DeletedAt.Valid {
+			return false, errImportRow("该学号对应的用户已被删除，请先恢复")
+		}
+		var user models.User
+		if err := tx.First(&user, student.UserID).Error; err != nil {
+			return false, errImportRow("该学号对应的用户已被删除，请先恢复")
+		}
+		if user.Role != "student" {
+			return false, errImportRow("该学号已绑定非学生用户")
+		}
+		if err := checkUserUnique(tx, user.ID, "", v["phone"], v["email"]); err != nil {
+			return false, err
+		}
+
+		updates := map[string]interface{}{}
+		for _, field := range []string{"name", "sex", "phone", "email"} {
+			if v[field] != "" {
+				updates[field] = v[field]
+			}
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+				return false, err
+			}
+		}
+		if len(profile) > 0 {
+			if err := tx.Model(&models.Student{}).Where("id = ?", student.ID).Updates(profile).Error; err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	hash := defaultHash
+	if v["password"] != "" {
+		if violations := utils.CurrentPasswordPolicy().Validate(v["password"], v["username"]); len(violations) > 0 {
+			return false, errImportRow("密码不符合安全策略: " + strings.Join(violations, "；"))
+		}
+		if hash, err = models.HashPassword(v["password"]); err != nil {
+			return false, err
+		}
+	}
+	if hash == "" {
+		return false, errImportRow("新用户需提供密码列或默认密码")
+	}
+	if err := checkUserUnique(tx, 0, v["username"], v["phone"], v["email"]); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		Username:          v["username"],
+		Password:          hash,
+		Name:              v["name"],
+		Sex:               v["sex"],
+		Phone:             v["phone"],
+		Email:             v["email"],
+		Role:              "student",
+		Status:            "active",
+		PasswordChangedAt: &now,
+	}
+	// 密码已加密，跳过 BeforeSave 钩子避免重复加密
+	if err := tx.Session(&gorm.Session{SkipHooks: true}).Create(&user).Error; err != nil {
+		return false, err
+	}
+	if err := recordPasswordHistory(tx, user.ID, hash); err != nil {
+		return false, err
+	}
+	return true, tx.Create(&models.Student{
+		UserID:         user.ID,
+		StudentID:      v["student_id"],
+		Major:          v["major"],
+		ClassName:      v["class_name"],
+		Grade:          v["grade"],
+		EnrollmentDate: row.enrollmentDate,
+		GraduationDate: row.graduationDate,
+		Dormitory:      v["dormitory"],
+	}).Error
+}
+
+// @Summary 批量导入学生
+// @Description 上传 CSV 或 XLSX 名单，按学号新增或更新学生；逐行校验并分批在事务中写入，返回每行的错误。
+// @Description 表头支持 student_id/学号、name/姓名、username/用户名、password/密码、sex/性别、phone/手机号、email/邮箱、major/专业、class_name/班级、grade/年级、enrollment_date/入学日期、graduation_date/毕业日期、dormitory/宿舍
+// @Tags 用户管理
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Param file formData file true "名单文件（.csv 或 .xlsx）"
+// @Param dry_run formData bool false "试运行，仅校验不写入"
+// @Param default_password formData string false "未提供密码列的新用户使用的初始密码"
+// @Success 200 {object} map[string]interface{} "导入结果及逐行错误"
+// @Failure 400 {object} map[string]interface{} "文件格式错误"
+// @Router /users/import [post]
+func ImportStudents(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传名单文件"})
+		return
+	}
+	if fileHeader.Size > importMaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件不能超过10MB"})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.Query("dry_run")))
+
+	var defaultHash string
+	if pw := c.PostForm("default_password"); pw != "" {
+		if violations := utils.CurrentPasswordPolicy().Validate(pw, ""); len(violations) > 0 {
+			c.JSON(http.StatusBadRequest, passwordPolicyError(violations))
+			return
+		}
+		if defaultHash, err = models.HashPassword(pw); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导入失败"})
+			return
+		}
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, importMaxFileSize+1))
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	records, err := readRoster(fileHeader.Filename, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "解析文件失败", "details": err.Error()})
+		return
+	}
+	if len(records) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件中没有数据行"})
+		return
+	}
+
+	// 解析表头
+	columns := make([]string, len(records[0]))
+	present := map[string]bool{}
+	var ignored []string
+	for i, h := range records[0] {
+		if field, ok := importColumnAliases[normalizeHeader(h)]; ok && !present[field] {
+			columns[i] = field
+			present[field] = true
+		} else if strings.TrimSpace(h) != "" {
+			ignored = append(ignored, h)
+		}
+	}
+	if !present["student_id"] || !present["name"] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少必需的列：学号(student_id)、姓名(name)"})
+		return
+	}
+
+	// 逐行校验格式及文件内重复
+	var rows []*importRow
+	var rowErrors []ImportRowError
+	seen := map[string]map[string]int{"student_id": {}, "username": {}, "phone": {}, "email": {}}
+	total := 0
+	for i, record := range records[1:] {
+		row := &importRow{line: i + 2, values: map[string]string{}}
+		empty := true
+		for j, value := range record {
+			if j < len(columns) && columns[j] != "" {
+				row.values[columns[j]] = strings.TrimSpace(value)
+				empty = empty && row.values[columns[j]] == ""
+			}
+		}
+		if empty {
+			continue
+		}
+		if total++; total > importMaxRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次最多导入 %d 行", importMaxRows)})
+			return
+		}
+
+		errs := validateImportRow(row)
+		for field, lines := range seen {
+			value := strings.ToLower(row.values[field])
+			if value == "" {
+				continue
+			}
+			if first, dup := lines[value]; dup {
+				errs = append(errs, fmt.Sprintf("%s 与第 %d 行重复", field, first))
+			} else {
+				lines[value] = row.line
+			}
+		}
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, ImportRowError{Row: row.line, StudentID: row.values["student_id"], Errors: errs})
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	// 分批写入，每行使用保存点，单行失败不影响同批其他行
+	batchSize := utils.IntFromEnv("IMPORT_BATCH_SIZE", defaultImportBatchSize)
+	created, updated := 0, 0
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:min(start+batchSize, len(rows))]
+		batchCreated, batchUpdated := 0, 0
+		var batchErrors []ImportRowError
+
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			for _, row := range batch {
+				if err := tx.SavePoint("import_row").Error; err != nil {
+					return err
+				}
+				isNew, err := importStudentRow(tx, row, defaultHash)
+				if err != nil {
+					if rbErr := tx.RollbackTo("import_row").Error; rbErr != nil {
+						return rbErr
+					}
+					batchErrors = append(batchErrors, ImportRowError{
+						Row: row.line, StudentID: row.values["student_id"], Errors: []string{importErrorMessage(err)},
+					})
+					continue
+				}
+				if isNew {
+					batchCreated++
+				} else {
+					batchUpdated++
+				}
+			}
+			if dryRun {
+				return errImportDryRun
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errImportDryRun) {
+			// 整批回滚，该批所有行均未写入
+			batchErrors = batchErrors[:0]
+			for _, row := range batch {
+				batchErrors = append(batchErrors, ImportRowError{
+					Row: row.line, StudentID: row.values["student_id"], Errors: []string{"批次写入失败，请重试"},
+				})
+			}
+			batchCreated, batchUpdated = 0, 0
+		}
+		created += batchCreated
+		updated += batchUpdated
+		rowErrors = append(rowErrors, batchErrors...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":         dryRun,
+		"total":           total,
+		"created":         created,
+		"updated":         updated,
+		"failed":          len(rowErrors),
+		"errors":          rowErrors,
+		"ignored_columns": ignored,
+	})
+}
+
+// importErrorMessage 将写入错误转换为面向用户的说明，数据库错误不向客户端暴露细节
+func importErrorMessage(err error) string {
+	var conflict *errUserConflict
+	var rowErr errImportRow
+	switch {
+	case errors.As(err, &conflict):
+		return conflict.Error()
+	case errors.As(err, &rowErr):
+		return string(rowErr)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return "与已有数据重复"
+	}
+	return "写入失败"
+}
+
+// exportHeader 导出文件的表头，与导入支持的中文表头一致
+var exportHeader = []string{
+	"ID", "用户名", "姓名", "性别", "手机号", "邮箱", "角色", "状态",
+	"学号", "专业", "班级", "年级", "入学日期", "毕业日期", "宿舍",
+	"工号", "部门", "创建时间",
+}
+
+// formatDate 格式化日期，零值返回空字符串
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// exportUserRow 将用户转换为导出行
+func exportUserRow(u *models.User) []string {
+	row := []string{
+		strconv.FormatUint(uint64(u.ID), 10), u.Username, u.Name, u.Sex, u.Phone, u.Email, u.Role, u.Status,
+		"", "", "", "", "", "", "", "", "", u.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if s := u.Student; s != nil {
+		copy(row[8:15], []string{s.StudentID, s.Major, s.ClassName, s.Grade,
+			formatDate(s.EnrollmentDate), formatDate(s.GraduationDate), s.Dormitory})
+	}
+	if co := u.Counselor; co != nil {
+		row[15], row[16] = co.EmployeeID, co.Department
+	}
+	return row
+}
+
+// csvSafe 防止单元格内容在电子表格中被当作公式执行
+func csvSafe(value string) string {
+	if value == "" {
+		return value
+	}
+	switch value[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + value
+	case '+', '-':
+		if len(value) > 1 && (value[1] < '0' || value[1] > '9') {
+			return "'" + value
+		}
+	}
+	return value
+}
+
+// @Summary 导出用户列表
+// @Description 按与用户列表相同的筛选和排序条件导出用户，支持 CSV 和 XLSX 格式
+// @Tags 用户管理
+// @Produce octet-stream
+// @Security ApiKeyAuth
+// @Param format query string false "导出格式：csv/xlsx，默认csv"
+// @Param role query string false "角色"
+// @Param status query string false "状态"
+// @Param keyword query string false "关键字"
+// @Param grade query string false "年级"
+// @Param major query string false "专业"
+// @Param class_name query string false "班级"
+// @Param department query string false "部门"
+// @Success 200 {file} file "导出文件"
+// @Failure 400 {object} map[string]interface{} "导出格式错误或数据量过大"
+// @Router /users/export [get]
+func ExportUsers(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持 csv 和 xlsx 格式"})
+		return
+	}
+
+	var total int64
+	if err := userListQuery(c).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+		return
+	}
+	if total > exportMaxRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("导出数据超过 %d 行，请缩小筛选范围", exportMaxRows)})
+		return
+	}
+
+	rows := make([][]string, 0, total+1)
+	rows = append(rows, exportHeader)
+	for offset := 0; offset < int(total); offset += exportPageSize {
+		var users []models.User
+		if err := preloadProfiles(userListQuery(c)).Select("users.*").Order(userListOrder(c)).
+			Offset(offset).Limit(exportPageSize).Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+			return
+		}
+		for i := range users {
+			rows = append(rows, exportUserRow(&users[i]))
+		}
+	}
+
+	filename := "users-" + time.Now().Format("20060102150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "xlsx" {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Status(http.StatusOK)
+		if err := utils.WriteXLSX(c.Writer, rows); err != nil {
+			c.Error(err)
+		}
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	// 写入 BOM 以便 Excel 正确识别 UTF-8 编码
+	c.Writer.WriteString("\xef\xbb\xbf")
+	w := csv.NewWriter(c.Writer)
+	for _, row := range rows {
+		safe := make([]string, len(row))
+		for i, v := range row {
+			safe[i] = csvSafe(v)
+		}
+		w.Write(safe)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,472 @@
+package controllers
+
+import (
+	"ental-health-system/config"
+	"ental-health-system/models"
+	"ental-health-system/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultWaitlistHoldTTL 为候补学生保留时间段的默认时长，可通过 WAITLIST_HOLD_TTL 配置
+const defaultWaitlistHoldTTL = 2 * time.Hour
+
+// JoinWaitlistRequest 加入候补请求结构
+type JoinWaitlistRequest struct {
+	CounselorID uint   `json:"counselor_id" binding:"required"`
+	DateFrom    string `json:"date_from"` // 格式 2006-01-02
+	DateTo      string `json:"date_to"`   // 格式 2006-01-02
+	TimeFrom    string `json:"time_from"` // 格式 15:04
+	TimeTo      string `json:"time_to"`   // 格式 15:04
+	Reason      string `json:"reason" binding:"max=500"`
+}
+
+// openWaitlistStatuses 仍在队列中的候补状态
+var openWaitlistStatuses = []string{models.WaitlistWaiting, models.WaitlistOffered}
+
+// waitlistMatches 判断时间段是否符合候补的日期和时间偏好
+func waitlistMatches(entry *models.WaitlistEntry, slot *models.TimeSlot) bool {
+	day := dateKey(slot.StartTime)
+	if entry.DateFrom != nil && day < dateKey(*entry.DateFrom) {
+		return false
+	}
+	if entry.DateTo != nil && day > dateKey(*entry.DateTo) {
+		return false
+	}
+	if entry.TimeFrom != "" && slot.StartTime.Format("15:04") < entry.TimeFrom {
+		return false
+	}
+	// 跨天的时间段不符合"最晚结束时间"偏好
+	if entry.TimeTo != "" && (dateKey(slot.EndTime) != day || slot.EndTime.Format("15:04") > entry.TimeTo) {
+		return false
+	}
+	return true
+}
+
+// offerSlot 在事务中将可预约的时间段保留给第一个符合条件的候补学生，返回获得保留的候补记录，
+// 没有符合条件的候补时返回 nil
+func offerSlot(tx *gorm.DB, slotID uint, now time.Time) (*models.WaitlistEntry, error) {
+	var slot models.TimeSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&slot, slotID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if slot.Status != models.TimeSlotStatusAvailable || !slot.StartTime.After(now) {
+		return nil, nil
+	}
+	blackouts, err := applicableBlackouts(tx, uint(slot.CounselorID), slot.StartTime, slot.EndTime)
+	if err != nil || len(blackouts) > 0 {
+		return nil, err
+	}
+
+	var candidates []models.WaitlistEntry
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "waitlist_entries"}}).
+		Joins("JOIN users ON users.id = waitlist_entries.user_id AND users.deleted_at IS NULL AND users.status = ?", "active").
+		Where("waitlist_entries.counselor_id = ? AND waitlist_entries.status = ?", slot.CounselorID, models.WaitlistWaiting).
+		Where("NOT EXISTS (SELECT 1 FROM booking_restrictions WHERE booking_restrictions.user_id = waitlist_entries.user_id"+
+			" AND booking_restrictions.lifted_at IS NULL AND booking_restrictions.starts_at <= ? AND booking_restrictions.ends_at > ?)", now, now).
+		Order("waitlist_entries.id").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		entry := &candidates[i]
+		if !waitlistMatches(entry, &slot) {
+			continue
+		}
+		var overlapping int64
+		if err := tx.Model(&models.Appointment{}).
+			Where("user_id = ? AND status IN ? AND start_time < ? AND end_time > ?",
+				entry.UserID, activeAppointmentStatuses, slot.EndTime, slot.StartTime).
+			Count(&overlapping).Error; err != nil {
+			return nil, err
+		}
+		if overlapping > 0 {
+			continue
+		}
+
+		// 保留期不超过时间段开始时间
+		expiresAt := now.Add(utils.DurationFromEnv("WAITLIST_HOLD_TTL", defaultWaitlistHoldTTL))
+		if expiresAt.After(slot.StartTime) {
+			expiresAt = slot.StartTime
+		}
+		if err := tx.Model(&slot).Update("status", models.TimeSlotStatusHeld).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(entry).Updates(map[string]interface{}{
+			"status":           models.WaitlistOffered,
+			"offered_slot_id":  slot.ID,
+			"offer_expires_at": expiresAt,
+		}).Error; err != nil {
+			return nil, err
+		}
+		entry.Status = models.WaitlistOffered
+		entry.OfferedSlotID = &slot.ID
+		entry.OfferExpiresAt = &expiresAt
+		return entry, nil
+	}
+	return nil, nil
+}
+
+// releaseHeldSlot 收回保留给候补学生的时间段
+func releaseHeldSlot(tx *gorm.DB, entry *models.WaitlistEntry) error {
+	if entry.OfferedSlotID == nil {
+		return nil
+	}
+	return tx.Model(&models.TimeSlot{}).
+		Where("id = ? AND status = ?", *entry.OfferedSlotID, models.TimeSlotStatusHeld).
+		Update("status", models.TimeSlotStatusAvailable).Error
+}
+
+// notifyWaitlistOffer 通知候补学生确认保留的时间段
+func notifyWaitlistOffer(entry *models.WaitlistEntry) {
+	var student models.User
+	var slot models.TimeSlot
+	var counselor models.User
+	if config.DB.First(&student, entry.UserID).Error != nil ||
+		config.DB.First(&slot, *entry.OfferedSlotID).Error != nil ||
+		config.DB.First(&counselor, entry.CounselorID).Error != nil {
+		return
+	}
+	notifyUser(&student, "候补预约保留通知", fmt.Sprintf(
+		"您候补的 %s 咨询师有空出的时间段：%s，已为您保留至 %s，请在此之前登录系统确认预约，逾期将顺延给下一位候补同学。",
+		counselor.Name, slot.StartTime.Format(appointmentTimeLayout), entry.OfferExpiresAt.Format(appointmentTimeLayout)))
+}
+
+// promoteWaitlist 时间段空出后尝试保留给候补学生并发送通知，失败只记录日志，由定时任务补偿
+func promoteWaitlist(slotID uint) {
+	var entry *models.WaitlistEntry
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = offerSlot(tx, slotID, time.Now())
+		return err
+	})
+	if err != nil {
+		log.Printf("候补顺延失败: slot_id=%d err=%v", slotID, err)
+		return
+	}
+	if entry != nil {
+		notifyWaitlistOffer(entry)
+	}
+}
+
+// expireWaitlistOffers 将过期未确认的保留作废，并把时间段顺延给下一位候补学生
+func expireWaitlistOffers(now time.Time) {
+	var ids []uint
+	if err := config.DB.Model(&models.WaitlistEntry{}).
+		Where("status = ? AND offer_expires_at <= ?", models.WaitlistOffered, now).
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("查询过期的候补保留失败: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		var slotID uint
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var entry models.WaitlistEntry
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ?", id, models.WaitlistOffered).First(&entry).Error; err != nil {
+				return err
+			}
+			if err := releaseHeldSlot(tx, &entry); err != nil {
+				return err
+			}
+			if entry.OfferedSlotID != nil {
+				slotID = *entry.OfferedSlotID
+			}
+			return tx.Model(&entry).Update("status", models.WaitlistExpired).Error
+		})
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("作废候补保留失败: entry_id=%d err=%v", id, err)
+			}
+			continue
+		}
+		if slotID > 0 {
+			promoteWaitlist(slotID)
+		}
+	}
+}
+
+// ProcessWaitlist 定时处理候补队列：作废过期的保留，并为排队中的学生匹配空出的时间段
+func ProcessWaitlist() {
+	now := time.Now()
+	expireWaitlistOffers(now)
+
+	var counselorIDs []uint
+	if err := config.DB.Model(&models.WaitlistEntry{}).Where("status = ?", models.WaitlistWaiting).
+		Distinct().Pluck("counselor_id", &counselorIDs).Error; err != nil {
+		log.Printf("处理候补队列失败: %v", err)
+		return
+	}
+	for _, counselorID := range counselorIDs {
+		var slotIDs []uint
+		if err := config.DB.Model(&models.TimeSlot{}).
+			Where("counselor_id = ? AND status = ? AND start_time > ?", counselorID, models.TimeSlotStatusAvailable, now).
+			Order("start_time").Pluck("id", &slotIDs).Error; err != nil {
+			log.Printf("处理候补队列失败: counselor_id=%d err=%v", counselorID, err)
+			continue
+		}
+		for _, slotID := range slotIDs {
+			promoteWaitlist(slotID)
+		}
+	}
+}
+
+// waitlistPosition 候补记录在队列中的位置，从1开始；不在排队中时返回0
+func waitlistPosition(entry *models.WaitlistEntry) int64 {
+	if entry.Status != models.WaitlistWaiting {
+		return 0
+	}
+	var ahead int64
+	config.DB.Model(&models.WaitlistEntry{}).
+		Where("counselor_id = ? AND status = ? AND id < ?", entry.CounselorID, models.WaitlistWaiting, entry.ID).
+		Count(&ahead)
+	return ahead + 1
+}
+
+// findOwnWaitlistEntry 按路径参数查询当前用户的候补记录并加锁
+func findOwnWaitlistEntry(tx *gorm.DB, c *gin.Context) (*models.WaitlistEntry, error) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return nil, &appointmentError{http.StatusBadRequest, "无效的候补ID"}
+	}
+	var entry models.WaitlistEntry
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", id, currentUserID(c)).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &appointmentError{http.StatusNotFound, "候补记录不存在"}
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// @Summary 加入候补
+// @Description 咨询师时间已约满时排队候补，有时间段空出时按排队顺序为符合偏好的学生保留，学生需在保留期内确认
+// @Tags 预约管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param data body JoinWaitlistRequest true "候补信息"
+// @Success 200 {object} map[string]interface{} "加入成功"
+// @Failure 409 {object} map[string]interface{} "已在该咨询师的候补队列中"
+// @Router /waitlist [post]
+func JoinWaitlist(c *gin.Context) {
+	var req JoinWaitlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("id = ? AND role = ? AND status = ?", req.CounselorID, "counselor", "active").Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "咨询师不存在"})
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		UserID:      currentUserID(c),
+		CounselorID: req.CounselorID,
+		Status:      models.WaitlistWaiting,
+		Reason:      req.Reason,
+	}
+	if req.DateFrom != "" {
+		date, err := parseDate(req.DateFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始日期"})
+			return
+		}
+		entry.DateFrom = &date
+	}
+	if req.DateTo != "" {
+		date, err := parseDate(req.DateTo)
+		if err != nil || (entry.DateFrom != nil && date.Before(*entry.DateFrom)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+			return
+		}
+		entry.DateTo = &date
+	}
+	if req.TimeFrom != "" {
+		if _, err := parseClock(req.TimeFrom); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间，格式应为 15:04"})
+			return
+		}
+		entry.TimeFrom = req.TimeFrom
+	}
+	if req.TimeTo != "" {
+		if _, err := parseClock(req.TimeTo); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间，格式应为 15:04"})
+			return
+		}
+		entry.TimeTo = req.TimeTo
+	}
+	if entry.TimeFrom != "" && entry.TimeTo != "" && entry.TimeTo <= entry.TimeFrom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束时间必须晚于开始时间"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定学生行，防止并发重复加入
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&models.User{}, entry.UserID).Error; err != nil {
+			return err
+		}
+		if err := checkBookingRestriction(tx, entry.UserID, time.Now()); err != nil {
+			return err
+		}
+		var open int64
+		if err := tx.Model(&models.WaitlistEntry{}).
+			Where("user_id = ? AND counselor_id = ? AND status IN ?", entry.UserID, entry.CounselorID, openWaitlistStatuses).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return &appointmentError{http.StatusConflict, "您已在该咨询师的候补队列中"}
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "加入候补失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已加入候补", "entry": entry, "position": waitlistPosition(&entry)})
+}
+
+// @Summary 候补列表
+// @Description 学生看到本人的候补，咨询师看到本人的候补队列，拥有 appointment:read:any 权限可查看全部
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param status query string false "状态：waiting/offered/booked/cancelled/expired"
+// @Param counselor_id query int false "咨询师用户ID"
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20，最大100"
+// @Success 200 {object} map[string]interface{} "候补列表"
+// @Router /waitlist [get]
+func GetWaitlist(c *gin.Context) {
+	query := scopeAppointments(c, config.DB.Model(&models.WaitlistEntry{}))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if counselorID, err := strconv.ParseUint(c.Query("counselor_id"), 10, 64); err == nil {
+		query = query.Where("counselor_id = ?", counselorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取候补列表失败"})
+		return
+	}
+
+	page, pageSize := parsePagination(c)
+	var entries []models.WaitlistEntry
+	if err := query.Order("id").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取候补列表失败"})
+		return
+	}
+
+	list := make([]gin.H, 0, len(entries))
+	for i := range entries {
+		list = append(list, gin.H{"entry": entries[i], "position": waitlistPosition(&entries[i])})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"list":      list,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// @Summary 确认候补保留的时间段
+// @Description 在保留期内确认后生成预约
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "候补ID"
+// @Success 200 {object} map[string]interface{} "预约成功"
+// @Failure 409 {object} map[string]interface{} "没有待确认的保留或已过期"
+// @Router /waitlist/{id}/accept [post]
+func AcceptWaitlistOffer(c *gin.Context) {
+	var appointment *models.Appointment
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		entry, err := findOwnWaitlistEntry(tx, c)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if entry.Status != models.WaitlistOffered || entry.OfferedSlotID == nil ||
+			entry.OfferExpiresAt == nil || !entry.OfferExpiresAt.After(now) {
+			return &appointmentError{http.StatusConflict, "没有待确认的保留或保留已过期"}
+		}
+
+		// 收回保留后立即在同一事务中预约，其他请求无法插入
+		if err := releaseHeldSlot(tx, entry); err != nil {
+			return err
+		}
+		appointment, err = bookTimeSlot(tx, entry.UserID, *entry.OfferedSlotID, entry.Reason, now)
+		if err != nil {
+			return err
+		}
+		return tx.Model(entry).Updates(map[string]interface{}{
+			"status":         models.WaitlistBooked,
+			"appointment_id": appointment.ID,
+		}).Error
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "确认预约失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "预约成功，等待咨询师确认", "appointment": appointment})
+}
+
+// @Summary 退出候补
+// @Description 退出候补队列；已为其保留时间段时视为拒绝，时间段顺延给下一位候补学生
+// @Tags 预约管理
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "候补ID"
+// @Success 200 {object} map[string]interface{} "已退出"
+// @Router /waitlist/{id} [delete]
+func LeaveWaitlist(c *gin.Context) {
+	var slotID uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		entry, err := findOwnWaitlistEntry(tx, c)
+		if err != nil {
+			return err
+		}
+		if entry.Status != models.WaitlistWaiting && entry.Status != models.WaitlistOffered {
+			return &appointmentError{http.StatusConflict, "候补已结束"}
+		}
+		if entry.Status == models.WaitlistOffered {
+			if err := releaseHeldSlot(tx, entry); err != nil {
+				return err
+			}
+			slotID = *entry.OfferedSlotID
+		}
+		return tx.Model(entry).Update("status", models.WaitlistCancelled).Error
+	})
+	if err != nil {
+		respondAppointmentError(c, err, "退出候补失败")
+		return
+	}
+	if slotID > 0 {
+		promoteWaitlist(slotID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已退出候补"})
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"ental-health-system/config"
+	"ental-health-system/controllers"
 	"ental-health-system/docs"
 	"ental-health-system/routes"
+	"ental-health-system/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -47,9 +50,32 @@ func main() {
 	}
 	gin.SetMode(mode)
 
+	// 加载JWT签名密钥
+	if err := utils.InitJWTKeys(); err != nil {
+		log.Fatalf("加载JWT密钥失败: %v", err)
+	}
+
 	// 初始化数据库连接
 	config.InitDB()
 
+	// 站内通知写入数据库；NOTIFIER_FAKE 模式下保留内存中的模拟渠道
+	if utils.FakeNotifications() == nil {
+		utils.RegisterNotifier(utils.ChannelInApp, controllers.InAppNotifier{})
+	}
+
+	// 启动定时任务
+	utils.RunPeriodically("学生毕业归档", time.Minute,
+		utils.DurationFromEnv("STUDENT_ARCHIVE_INTERVAL", 24*time.Hour), controllers.RunStudentArchiveJob)
+	utils.RunPeriodically("清理个人数据导出", time.Minute, time.Hour, controllers.CleanupDataExports)
+	utils.RunPeriodically("生成咨询时间段", time.Minute,
+		utils.DurationFromEnv("AVAILABILITY_GENERATE_INTERVAL", 6*time.Hour), controllers.GenerateAllTimeSlots)
+	utils.RunPeriodically("处理预约候补", time.Minute,
+		utils.DurationFromEnv("WAITLIST_INTERVAL", 5*time.Minute), controllers.ProcessWaitlist)
+	utils.RunPeriodically("自动标记爽约", time.Minute,
+		utils.DurationFromEnv("NO_SHOW_CHECK_INTERVAL", 10*time.Minute), controllers.MarkNoShows)
+	utils.RunPeriodically("发送预约提醒", time.Minute,
+		utils.DurationFromEnv("APPOINTMENT_REMINDER_INTERVAL", 5*time.Minute), controllers.SendAppointmentReminders)
+
 	// 创建Gin实例
 	r := gin.Default()
 
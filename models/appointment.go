@@ -2,23 +2,106 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// 预约状态
+const (
+	AppointmentStatusPending              = "pending"                // 待确认
+	AppointmentStatusConfirmed            = "confirmed"              // 已确认
+	AppointmentStatusCheckedIn            = "checked_in"             // 已签到
+	AppointmentStatusCompleted            = "completed"              // 已完成
+	AppointmentStatusCancelledByStudent   = "cancelled_by_student"   // 学生取消
+	AppointmentStatusCancelledByCounselor = "cancelled_by_counselor" // 咨询师取消
+	AppointmentStatusRejected             = "rejected"               // 咨询师拒绝
+	AppointmentStatusNoShow               = "no_show"                // 学生爽约
+)
+
+// 预约状态变更的操作方
+const (
+	AppointmentActorStudent   = "student"   // 预约的学生本人
+	AppointmentActorCounselor = "counselor" // 预约的咨询师本人
+	AppointmentActorAdmin     = "admin"     // 拥有 appointment:manage:any 权限的管理人员
+	AppointmentActorSystem    = "system"    // 系统任务
+)
+
+// AppointmentTransition 预约状态的一条合法变更
+type AppointmentTransition struct {
+	From           string   // 原状态
+	To             string   // 新状态
+	Actors         []string // 允许触发的操作方
+	ReasonRequired bool     // 是否必须填写原因
+	ReleasesSlot   bool     // 变更后是否释放时间段
+}
+
+// AppointmentTransitions 预约状态机：
+// pending → confirmed → checked_in → completed，以及取消、拒绝、爽约等终止状态
+var AppointmentTransitions = []AppointmentTransition{
+	{From: AppointmentStatusPending, To: AppointmentStatusConfirmed,
+		Actors: []string{AppointmentActorCounselor, AppointmentActorAdmin}},
+	{From: AppointmentStatusPending, To: AppointmentStatusRejected,
+		Actors: []string{AppointmentActorCounselor, AppointmentActorAdmin, AppointmentActorSystem}, ReasonRequired: true, ReleasesSlot: true},
+	{From: AppointmentStatusPending, To: AppointmentStatusCancelledByStudent,
+		Actors: []string{AppointmentActorStudent, AppointmentActorSystem}, ReasonRequired: true, ReleasesSlot: true},
+	{From: AppointmentStatusConfirmed, To: AppointmentStatusCheckedIn,
+		Actors: []string{AppointmentActorCounselor, AppointmentActorAdmin}},
+	{From: AppointmentStatusConfirmed, To: AppointmentStatusCancelledByStudent,
+		Actors: []string{AppointmentActorStudent, AppointmentActorSystem}, ReasonRequired: true, ReleasesSlot: true},
+	{From: AppointmentStatusConfirmed, To: AppointmentStatusCancelledByCounselor,
+		Actors: []string{AppointmentActorCounselor, AppointmentActorAdmin, AppointmentActorSystem}, ReasonRequired: true, ReleasesSlot: true},
+	{From: AppointmentStatusConfirmed, To: AppointmentStatusNoShow,
+		Actors: []string{AppointmentActorCounselor, AppointmentActorAdmin, AppointmentActorSystem}},
+	{From: AppointmentStatusCheckedIn, To: AppointmentStatusCompleted,
+		Actors: []string{AppointmentActorCounselor, AppointmentActorAdmin}},
+}
+
+// FindAppointmentTransition 查找从 from 到 to 的合法变更，不存在时返回 nil
+func FindAppointmentTransition(from, to string) *AppointmentTransition {
+	for i := range AppointmentTransitions {
+		if AppointmentTransitions[i].From == from && AppointmentTransitions[i].To == to {
+			return &AppointmentTransitions[i]
+		}
+	}
+	return nil
+}
+
+// AllowsActor 判断操作方是否可以触发该变更
+func (t *AppointmentTransition) AllowsActor(actor string) bool {
+	for _, a := range t.Actors {
+		if a == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// 时间段状态
+const (
+	TimeSlotStatusAvailable = "available" // 可预约
+	TimeSlotStatusBooked    = "booked"    // 已被预约
+	TimeSlotStatusHeld      = "held"      // 为候补学生保留中
 )
 
 // Appointment 咨询预约
 type Appointment struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	UserID        int       `gorm:"column:user_id" json:"user_id"`
-	Username      string    `json:"username"`
-	CounselorID   int       `gorm:"column:counselor_id" json:"counselor_id"`
-	CounselorName string    `gorm:"column:counselor_name" json:"counselor_name"`
-	TimeSlotID    int       `gorm:"column:time_slot_id" json:"time_slot_id"`
-	StartTime     time.Time `gorm:"column:start_time" json:"start_time"`
-	EndTime       time.Time `gorm:"column:end_time" json:"end_time"`
-	Status        string    `json:"status"`
-	Reason        string    `json:"reason"`
-	Notes         string    `json:"notes"`
-	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt     time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	UserID          int            `gorm:"column:user_id" json:"user_id"`
+	Username        string         `json:"username"`
+	CounselorID     int            `gorm:"column:counselor_id" json:"counselor_id"`
+	CounselorName   string         `gorm:"column:counselor_name" json:"counselor_name"`
+	TimeSlotID      int            `gorm:"column:time_slot_id" json:"time_slot_id"`
+	StartTime       time.Time      `gorm:"column:start_time" json:"start_time"`
+	EndTime         time.Time      `gorm:"column:end_time" json:"end_time"`
+	Status          string         `json:"status"`
+	Reason          string         `json:"reason"`
+	Notes           string         `json:"notes"`
+	RescheduleCount int            `gorm:"column:reschedule_count;not null;default:0" json:"reschedule_count"` // 已改约次数
+	LateCancelled   bool           `gorm:"column:late_cancelled;not null;default:false" json:"late_cancelled"` // 学生是否在临时取消时限内取消
+	RescheduledAt   *time.Time     `gorm:"column:rescheduled_at" json:"rescheduled_at"`                        // 最近一次改约时间
+	CreatedAt       time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"` // 软删除，变更记录仍可关联
 }
 
 // TimeSlot 咨询时间段
@@ -28,6 +111,55 @@ type TimeSlot struct {
 	StartTime   time.Time `gorm:"column:start_time" json:"start_time"`
 	EndTime     time.Time `gorm:"column:end_time" json:"end_time"`
 	Status      string    `json:"status"`
+	TemplateID  *uint     `gorm:"column:template_id;index" json:"template_id"` // 生成该时间段的可预约时间模板，手动创建时为空
 	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
+
+// AppointmentStatusHistory 预约状态变更记录
+type AppointmentStatusHistory struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	AppointmentID uint      `gorm:"not null;index" json:"appointment_id"` // 关联的预约ID
+	FromStatus    string    `gorm:"size:30" json:"from_status"`           // 原状态，创建预约时为空
+	ToStatus      string    `gorm:"size:30;not null" json:"to_status"`    // 新状态
+	ActorID       *uint     `gorm:"index" json:"actor_id"`                // 操作人用户ID，系统任务为空
+	ActorRole     string    `gorm:"size:20" json:"actor_role"`            // 操作方：student/counselor/admin/system
+	Reason        string    `gorm:"size:500" json:"reason"`               // 变更原因
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BookingRestriction 学生的预约限制，学期内爽约次数达到上限后自动生成，管理人员可提前解除
+type BookingRestriction struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"` // 被限制的学生用户ID
+	Reason    string     `gorm:"size:200" json:"reason"`        // 限制原因
+	StartsAt  time.Time  `gorm:"not null" json:"starts_at"`     // 开始时间
+	EndsAt    time.Time  `gorm:"not null;index" json:"ends_at"` // 结束时间
+	LiftedBy  *uint      `json:"lifted_by"`                     // 提前解除的管理人员用户ID
+	LiftedAt  *time.Time `json:"lifted_at"`                     // 提前解除时间
+	LiftNote  string     `gorm:"size:200" json:"lift_note"`     // 解除说明
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// 预约提醒状态
+const (
+	ReminderSending = "sending" // 已被某个实例领取，正在发送
+	ReminderSent    = "sent"    // 已发送
+	ReminderFailed  = "failed"  // 所有渠道均发送失败，等待重试
+)
+
+// AppointmentReminder 预约提醒的发送记录。每个预约的每个开始时间、每个提醒时间点只有一条记录，
+// 改约后按新的开始时间重新提醒；多个后端实例通过唯一索引和按状态的条件更新领取，保证同一提醒只发送一次
+type AppointmentReminder struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	AppointmentID uint       `gorm:"not null;uniqueIndex:idx_reminder_schedule" json:"appointment_id"` // 关联的预约ID
+	StartTime     time.Time  `gorm:"not null;uniqueIndex:idx_reminder_schedule" json:"start_time"`     // 提醒时预约的开始时间
+	OffsetMinutes int        `gorm:"not null;uniqueIndex:idx_reminder_schedule" json:"offset_minutes"` // 提前多少分钟提醒
+	Status        string     `gorm:"size:20;not null;index" json:"status"`                             // 状态：sending/sent/failed
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`                               // 已尝试发送次数
+	Channels      string     `gorm:"size:100" json:"channels"`                                         // 发送成功的渠道，逗号分隔
+	Error         string     `gorm:"size:500" json:"error"`                                            // 最近一次发送失败的原因
+	ClaimedAt     time.Time  `gorm:"not null" json:"claimed_at"`                                       // 最近一次领取时间
+	SentAt        *time.Time `json:"sent_at"`                                                          // 发送完成时间
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
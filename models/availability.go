@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+// AvailabilityTemplate 咨询师每周重复的可预约时间模板，
+// 如"周一、周三 14:00-17:00，每次50分钟，间隔10分钟"
+type AvailabilityTemplate struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	CounselorID    uint       `gorm:"not null;index" json:"counselor_id"`      // 咨询师用户ID
+	Weekdays       string     `gorm:"size:20;not null" json:"weekdays"`        // 重复的星期，逗号分隔，1-7 表示周一至周日
+	StartTime      string     `gorm:"size:5;not null" json:"start_time"`       // 每天开始时间，格式 15:04
+	EndTime        string     `gorm:"size:5;not null" json:"end_time"`         // 每天结束时间，格式 15:04
+	SessionMinutes int        `gorm:"not null" json:"session_minutes"`         // 每次咨询时长（分钟）
+	BreakMinutes   int        `gorm:"not null;default:0" json:"break_minutes"` // 两次咨询之间的间隔（分钟）
+	ValidFrom      time.Time  `gorm:"type:date;not null" json:"valid_from"`    // 生效日期
+	ValidUntil     *time.Time `gorm:"type:date" json:"valid_until"`            // 失效日期（含），为空表示长期有效
+	Active         bool       `gorm:"not null;default:true" json:"active"`     // 是否启用
+	Remark         string     `gorm:"size:200" json:"remark"`                  // 备注
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// AvailabilityException 可预约时间模板的例外日期，当天不按模板生成时间段
+type AvailabilityException struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CounselorID uint      `gorm:"not null;index" json:"counselor_id"` // 咨询师用户ID
+	TemplateID  *uint     `gorm:"index" json:"template_id"`           // 仅对指定模板生效，为空表示对该咨询师所有模板生效
+	Date        time.Time `gorm:"type:date;not null" json:"date"`     // 例外日期
+	Reason      string    `gorm:"size:200" json:"reason"`             // 原因
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// 停诊安排的适用范围
+const (
+	BlackoutScopeGlobal     = "global"     // 全校
+	BlackoutScopeDepartment = "department" // 指定部门的咨询师
+	BlackoutScopeCounselor  = "counselor"  // 指定咨询师
+)
+
+// 停诊安排类型
+const (
+	BlackoutKindHoliday = "holiday" // 节假日
+	BlackoutKindExam    = "exam"    // 考试周
+	BlackoutKindLeave   = "leave"   // 咨询师请假
+	BlackoutKindOther   = "other"   // 其他
+)
+
+// Blackout 停诊安排：期间不生成、不展示、不接受预约的时间段
+type Blackout struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Scope       string    `gorm:"size:20;not null;index" json:"scope"` // 适用范围：global/department/counselor
+	Department  string    `gorm:"size:100" json:"department"`          // 适用的部门，范围为 department 时有效
+	CounselorID *uint     `gorm:"index" json:"counselor_id"`           // 适用的咨询师用户ID，范围为 counselor 时有效
+	Kind        string    `gorm:"size:20;not null" json:"kind"`        // 类型：holiday/exam/leave/other
+	Title       string    `gorm:"size:100;not null" json:"title"`      // 名称，如"国庆节"
+	StartAt     time.Time `gorm:"not null;index" json:"start_at"`      // 开始时间
+	EndAt       time.Time `gorm:"not null;index" json:"end_at"`        // 结束时间（不含）
+	CreatedBy   uint      `json:"created_by"`                          // 创建人用户ID
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarFeed 用户的日历订阅，凭订阅链接中的令牌访问，每个用户最多一个，重新生成时令牌替换
+type CalendarFeed struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"uniqueIndex;not null" json:"user_id"`                // 订阅所属的用户ID
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`              // 订阅令牌的SHA-256哈希
+	LastUsedAt *time.Time `json:"last_used_at"`                                       // 日历应用最近一次拉取时间
+	CreatedAt  time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"` // 令牌生成时间
+	UpdatedAt  time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification 站内通知
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"` // 接收通知的用户ID
+	Title     string     `gorm:"size:200" json:"title"`         // 标题
+	Body      string     `gorm:"type:text" json:"body"`         // 正文
+	ReadAt    *time.Time `json:"read_at"`                       // 已读时间，为空表示未读
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// 个人数据导出状态
+const (
+	DataExportPending    = "pending"    // 等待生成
+	DataExportProcessing = "processing" // 生成中
+	DataExportReady      = "ready"      // 可下载
+	DataExportFailed     = "failed"     // 生成失败
+	DataExportExpired    = "expired"    // 已过期，文件已删除
+)
+
+// DataExport 个人数据导出任务
+type DataExport struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`        // 数据所属的用户ID
+	Status       string     `gorm:"size:20;not null;index" json:"status"` // 状态：pending/processing/ready/failed/expired
+	StorageKey   string     `gorm:"size:255" json:"-"`                    // 导出包在私有存储中的key
+	FileSize     int64      `json:"file_size"`                            // 导出包大小（字节）
+	TokenHash    string     `gorm:"size:64;not null" json:"-"`            // 下载令牌的SHA-256哈希
+	Error        string     `gorm:"size:255" json:"error,omitempty"`      // 失败原因
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`           // 下载链接过期时间
+	CompletedAt  *time.Time `json:"completed_at"`                         // 生成完成时间
+	DownloadedAt *time.Time `json:"downloaded_at"`                        // 最近一次下载时间
+	CreatedAt    time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// 数据删除申请状态
+const (
+	ErasurePending   = "pending"   // 待审核
+	ErasureRejected  = "rejected"  // 已驳回
+	ErasureCompleted = "completed" // 已审核通过并执行
+	ErasureFailed    = "failed"    // 审核通过但执行失败，可重新执行
+)
+
+// ErasureRequest 个人数据删除（被遗忘权）申请
+type ErasureRequest struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`        // 申请删除数据的用户ID
+	Status      string     `gorm:"size:20;not null;index" json:"status"` // 状态：pending/rejected/completed/failed
+	Reason      string     `gorm:"size:500" json:"reason"`               // 申请理由
+	ReviewerID  *uint      `json:"reviewer_id"`                          // 审核人用户ID
+	ReviewNote  string     `gorm:"size:500" json:"review_note"`          // 审核意见
+	ReviewedAt  *time.Time `json:"reviewed_at"`                          // 审核时间
+	Retained    string     `gorm:"size:255" json:"retained"`             // 执行时依法保留未处理的数据类别，逗号分隔
+	CompletedAt *time.Time `json:"completed_at"`                         // 执行完成时间
+	Error       string     `gorm:"size:255" json:"error,omitempty"`      // 执行失败原因
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Role 角色，Name 与 User.Role 中保存的角色标识对应
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"uniqueIndex;size:50;not null" json:"name"` // 角色标识，如 admin/student/advisor
+	DisplayName string       `gorm:"size:50" json:"display_name"`              // 显示名称，如 辅导员
+	Description string       `gorm:"size:255" json:"description"`              // 描述
+	IsSystem    bool         `gorm:"default:false" json:"is_system"`           // 内置角色，不可删除
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions,omitempty"`
+	CreatedAt   time.Time    `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time    `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// Permission 权限点，编码格式为 资源:操作[:范围]，如 appointment:read:any
+type Permission struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Code        string    `gorm:"uniqueIndex;size:100;not null" json:"code"` // 权限编码，支持 * 通配
+	Description string    `gorm:"size:255" json:"description"`               // 描述
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// RolePermission 角色与权限的关联
+type RolePermission struct {
+	RoleID       uint `gorm:"primaryKey"`
+	PermissionID uint `gorm:"primaryKey"`
+}
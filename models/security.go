@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset 找回密码验证码
+type PasswordReset struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"` // 关联的用户ID
+	CodeHash  string     `gorm:"size:100;not null" json:"-"`    // 验证码哈希，不保存明文
+	Channel   string     `gorm:"size:20" json:"channel"`        // 发送渠道：email/sms
+	Attempts  int        `gorm:"default:0" json:"attempts"`     // 校验失败次数
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`    // 过期时间
+	UsedAt    *time.Time `json:"used_at"`                       // 使用（或作废）时间，非空即失效
+	ClientIP  string     `gorm:"size:50" json:"client_ip"`      // 申请方IP
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TwoFactor 用户的TOTP二次验证配置
+type TwoFactor struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"uniqueIndex;not null" json:"user_id"` // 关联的用户ID
+	Secret         string     `gorm:"size:64;not null" json:"-"`           // Base32编码的TOTP密钥
+	Enabled        bool       `gorm:"default:false" json:"enabled"`        // 是否已完成绑定并启用
+	EnabledAt      *time.Time `json:"enabled_at"`                          // 启用时间
+	LastUsedStep   int64      `gorm:"default:0" json:"-"`                  // 上次成功使用的时间步，防止动态码重放
+	FailedAttempts int        `gorm:"default:0" json:"-"`                  // 连续校验失败次数
+	LockedUntil    *time.Time `json:"-"`                                   // 连续失败达到上限后的锁定截止时间
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// RecoveryCode 二次验证恢复码，每个只能使用一次
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"` // 关联的用户ID
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`     // 恢复码的SHA-256哈希
+	UsedAt    *time.Time `json:"used_at"`                       // 使用时间
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// LoginAttempt 登录尝试审计记录
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    *uint     `gorm:"index" json:"user_id"`           // 关联的用户ID，用户名不存在时为空
+	Username  string    `gorm:"size:50;index" json:"username"`  // 提交的用户名
+	Success   bool      `gorm:"default:false" json:"success"`   // 是否登录成功（密码校验通过）
+	Reason    string    `gorm:"size:50" json:"reason"`          // 失败原因：bad_password/unknown_user/locked/throttled/inactive
+	ClientIP  string    `gorm:"size:50;index" json:"client_ip"` // 客户端IP
+	UserAgent string    `gorm:"size:255" json:"user_agent"`     // 用户代理
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`
+}
+
+// PasswordHistory 历史密码哈希，用于禁止重复使用近期密码
+type PasswordHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"` // 关联的用户ID
+	PasswordHash string    `gorm:"size:100;not null" json:"-"`    // bcrypt 哈希
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// ExternalIdentity 外部身份（校园统一认证）与本地用户的绑定
+type ExternalIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`                                     // 关联的用户ID
+	Provider    string     `gorm:"size:20;not null;uniqueIndex:idx_provider_subject" json:"provider"` // 身份来源：oidc/cas
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_provider_subject" json:"subject"` // 外部身份唯一标识
+	LastLoginAt *time.Time `json:"last_login_at"`                                                     // 最近一次通过该身份登录的时间
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// SSOState OIDC 授权请求的临时状态，回调时一次性消费
+type SSOState struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	State        string    `gorm:"size:64;uniqueIndex;not null" json:"-"` // 防CSRF的state参数
+	Nonce        string    `gorm:"size:64;not null" json:"-"`             // 写入ID Token的nonce，防重放
+	CodeVerifier string    `gorm:"size:128;not null" json:"-"`            // PKCE code_verifier
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`      // 过期时间
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// ContactVerification 修改手机号或邮箱时发往新地址的验证码
+type ContactVerification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`   // 关联的用户ID
+	Channel   string     `gorm:"size:20;not null" json:"channel"` // 验证渠道：email/sms
+	Target    string     `gorm:"size:100;not null" json:"target"` // 待绑定的新邮箱或手机号
+	CodeHash  string     `gorm:"size:100;not null" json:"-"`      // 验证码哈希，不保存明文
+	Attempts  int        `gorm:"default:0" json:"attempts"`       // 校验失败次数
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`      // 过期时间
+	UsedAt    *time.Time `json:"used_at"`                         // 使用（或作废）时间，非空即失效
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
@@ -8,18 +8,21 @@ import (
 
 // Token 用户令牌表
 type Token struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	UserID    uint           `gorm:"not null;index" json:"user_id"`      // 关联的用户ID
-	Token     string         `gorm:"type:text;not null" json:"token"`    // JWT令牌
-	Type      string         `gorm:"size:20;default:access" json:"type"` // 令牌类型：access/refresh
-	ExpiresAt time.Time      `gorm:"not null" json:"expires_at"`         // 过期时间
-	LastUsed  *time.Time     `json:"last_used"`                          // 最后使用时间
-	UserAgent string         `gorm:"size:255" json:"user_agent"`         // 用户代理
-	ClientIP  string         `gorm:"size:50" json:"client_ip"`           // 客户端IP
-	IsRevoked bool           `gorm:"default:false" json:"is_revoked"`    // 是否已撤销
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	UserID       uint           `gorm:"not null;index" json:"user_id"`      // 关联的用户ID
+	Token        string         `gorm:"type:text;not null" json:"token"`    // JWT令牌
+	Type         string         `gorm:"size:20;default:access" json:"type"` // 令牌类型：access/refresh
+	FamilyID     string         `gorm:"size:64;index" json:"family_id"`     // 令牌家族ID，同一次登录轮换出的令牌共享
+	ExpiresAt    time.Time      `gorm:"not null" json:"expires_at"`         // 过期时间
+	LastUsed     *time.Time     `json:"last_used"`                          // 最后使用时间
+	UserAgent    string         `gorm:"size:255" json:"user_agent"`         // 用户代理
+	ClientIP     string         `gorm:"size:50" json:"client_ip"`           // 客户端IP
+	IsRevoked    bool           `gorm:"default:false" json:"is_revoked"`    // 是否已撤销
+	RevokedAt    *time.Time     `json:"revoked_at"`                         // 撤销时间
+	ReplacedByID *uint          `json:"replaced_by_id"`                     // 轮换后替代该刷新令牌的新令牌ID
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // TableName 指定表名
@@ -46,3 +49,15 @@ type Feedback struct {
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
+
+// AuditLog 审计日志，记录敏感操作
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActorID    *uint     `gorm:"index" json:"actor_id"`                // 操作人用户ID，系统任务为空
+	Action     string    `gorm:"size:50;index;not null" json:"action"` // 操作，如 data_export.requested
+	TargetType string    `gorm:"size:50" json:"target_type"`           // 操作对象类型，如 user/data_export
+	TargetID   uint      `gorm:"index" json:"target_id"`               // 操作对象ID
+	Detail     string    `gorm:"type:text" json:"detail"`              // 补充说明
+	ClientIP   string    `gorm:"size:50" json:"client_ip"`             // 客户端IP
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime;index" json:"created_at"`
+}
@@ -9,36 +9,50 @@ import (
 
 // User 用户基础信息
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Username  string         `gorm:"uniqueIndex;size:50;not null" json:"username"`                  // 用户名，唯一
-	Password  string         `gorm:"size:100;not null" json:"-"`                                    // 密码，json中隐藏
-	Name      string         `gorm:"size:50" json:"name"`                                           // 真实姓名
-	Sex       string         `gorm:"size:10" json:"sex"`                                            // 性别
-	Phone     string         `gorm:"size:20;uniqueIndex:idx_phone,where:phone <> ''" json:"phone"`  // 手机号，非空时唯一
-	Email     string         `gorm:"size:100;uniqueIndex:idx_email,where:email <> ''" json:"email"` // 邮箱，非空时唯一
-	Avatar    string         `gorm:"size:255" json:"avatar"`                                        // 头像URL
-	Role      string         `gorm:"size:20;default:student" json:"role"`                           // 角色：student/counselor/admin
-	Status    string         `gorm:"size:20;default:active" json:"status"`                          // 状态：active/inactive/blocked
-	Remark    string         `gorm:"size:500" json:"remark"`                                        // 备注
-	Student   *Student       `gorm:"foreignKey:UserID" json:"student,omitempty"`                    // 学生信息，一对一关系
-	Counselor *Counselor     `gorm:"foreignKey:UserID" json:"counselor,omitempty"`                  // 咨询师信息，一对一关系
-	CreatedAt time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`            // 创建时间
-	UpdatedAt time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`            // 更新时间
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`                                                // 软删除
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	Username          string         `gorm:"uniqueIndex;size:50;not null" json:"username"`                  // 用户名，唯一
+	Password          string         `gorm:"size:100;not null" json:"-"`                                    // 密码，json中隐藏
+	Name              string         `gorm:"size:50" json:"name"`                                           // 真实姓名
+	Sex               string         `gorm:"size:10" json:"sex"`                                            // 性别
+	Phone             string         `gorm:"size:20;uniqueIndex:idx_phone,where:phone <> ''" json:"phone"`  // 手机号，非空时唯一
+	Email             string         `gorm:"size:100;uniqueIndex:idx_email,where:email <> ''" json:"email"` // 邮箱，非空时唯一
+	Avatar            string         `gorm:"size:255" json:"avatar"`                                        // 头像URL
+	Role              string         `gorm:"size:20;default:student" json:"role"`                           // 角色：student/counselor/admin
+	Status            string         `gorm:"size:20;default:active" json:"status"`                          // 状态：active/inactive/blocked/archived(已毕业归档)/erased(数据已删除)
+	Remark            string         `gorm:"size:500" json:"remark"`                                        // 备注
+	FailedLogins      int            `gorm:"default:0" json:"failed_logins"`                                // 当前窗口内连续登录失败次数
+	LastFailedLogin   *time.Time     `json:"-"`                                                             // 最近一次登录失败时间
+	LockedUntil       *time.Time     `json:"locked_until"`                                                  // 账户锁定截止时间，为空或已过期表示未锁定
+	PasswordChangedAt *time.Time     `json:"password_changed_at"`                                           // 最近一次修改密码时间，为空时以创建时间为准
+	Student           *Student       `gorm:"foreignKey:UserID" json:"student,omitempty"`                    // 学生信息，一对一关系
+	Counselor         *Counselor     `gorm:"foreignKey:UserID" json:"counselor,omitempty"`                  // 咨询师信息，一对一关系
+	CreatedAt         time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`            // 创建时间
+	UpdatedAt         time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`            // 更新时间
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`                                                // 软删除
 }
 
 // BeforeSave 在保存前对密码进行加密
 func (u *User) BeforeSave(tx *gorm.DB) error {
 	if u.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		hashedPassword, err := HashPassword(u.Password)
 		if err != nil {
 			return err
 		}
-		u.Password = string(hashedPassword)
+		u.Password = hashedPassword
 	}
 	return nil
 }
 
+// HashPassword 使用bcrypt加密密码
+// 更新已有用户的密码时应先加密再通过 UpdateColumn 写入，避免 BeforeSave 对哈希值重复加密
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
 // ValidatePassword 验证密码
 func (u *User) ValidatePassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
@@ -47,19 +61,22 @@ func (u *User) ValidatePassword(password string) bool {
 
 // Student 学生信息
 type Student struct {
-	ID             uint           `gorm:"primaryKey" json:"id"`
-	UserID         uint           `gorm:"uniqueIndex;not null" json:"user_id"`                                         // 关联的用户ID
-	User           User           `gorm:"foreignKey:UserID" json:"-"`                                                  // 关联的用户信息
-	StudentID      string         `gorm:"size:50;uniqueIndex:idx_student_id,where:student_id <> ''" json:"student_id"` // 学号，非空时唯一
-	Major          string         `gorm:"size:100" json:"major"`                                                       // 专业
-	ClassName      string         `gorm:"column:class_name;size:50" json:"class_name"`                                 // 班级
-	Grade          string         `gorm:"size:20" json:"grade"`                                                        // 年级
-	EnrollmentDate time.Time      `gorm:"column:enrollment_date" json:"enrollment_date"`                               // 入学日期
-	GraduationDate time.Time      `gorm:"column:graduation_date" json:"graduation_date"`                               // 预计毕业日期
-	Dormitory      string         `gorm:"size:50" json:"dormitory"`                                                    // 宿舍信息
-	CreatedAt      time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
-	UpdatedAt      time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	UserID          uint           `gorm:"uniqueIndex;not null" json:"user_id"`                                         // 关联的用户ID
+	User            User           `gorm:"foreignKey:UserID" json:"-"`                                                  // 关联的用户信息
+	StudentID       string         `gorm:"size:50;uniqueIndex:idx_student_id,where:student_id <> ''" json:"student_id"` // 学号，非空时唯一
+	Major           string         `gorm:"size:100" json:"major"`                                                       // 专业
+	ClassName       string         `gorm:"column:class_name;size:50" json:"class_name"`                                 // 班级
+	Grade           string         `gorm:"size:20" json:"grade"`                                                        // 年级
+	EnrollmentDate  time.Time      `gorm:"column:enrollment_date" json:"enrollment_date"`                               // 入学日期
+	GraduationDate  time.Time      `gorm:"column:graduation_date" json:"graduation_date"`                               // 预计毕业日期
+	Dormitory       string         `gorm:"size:50" json:"dormitory"`                                                    // 宿舍信息
+	ArchivedAt      *time.Time     `json:"archived_at"`                                                                 // 毕业归档时间，重新激活后清空
+	NoShowCount     int            `gorm:"not null;default:0" json:"no_show_count"`                                     // 累计爽约次数
+	LateCancelCount int            `gorm:"not null;default:0" json:"late_cancel_count"`                                 // 累计临时取消次数
+	CreatedAt       time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // Counselor 咨询师信息
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// 候补状态
+const (
+	WaitlistWaiting   = "waiting"   // 排队中
+	WaitlistOffered   = "offered"   // 已为其保留时间段，等待确认
+	WaitlistBooked    = "booked"    // 已确认并完成预约
+	WaitlistCancelled = "cancelled" // 学生退出或拒绝保留的时间段
+	WaitlistExpired   = "expired"   // 未在保留期内确认
+)
+
+// WaitlistEntry 咨询师候补队列中的一条记录，按创建顺序排队
+type WaitlistEntry struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`                           // 排队的学生用户ID
+	CounselorID    uint       `gorm:"not null;index:idx_waitlist_queue" json:"counselor_id"`   // 咨询师用户ID
+	Status         string     `gorm:"size:20;not null;index:idx_waitlist_queue" json:"status"` // 状态：waiting/offered/booked/cancelled/expired
+	DateFrom       *time.Time `gorm:"type:date" json:"date_from"`                              // 期望的最早日期，为空不限
+	DateTo         *time.Time `gorm:"type:date" json:"date_to"`                                // 期望的最晚日期（含），为空不限
+	TimeFrom       string     `gorm:"size:5" json:"time_from"`                                 // 期望的最早开始时间，格式 15:04，为空不限
+	TimeTo         string     `gorm:"size:5" json:"time_to"`                                   // 期望的最晚结束时间，格式 15:04，为空不限
+	Reason         string     `gorm:"size:500" json:"reason"`                                  // 咨询原因，确认后写入预约
+	OfferedSlotID  *uint      `json:"offered_slot_id"`                                         // 为其保留的时间段
+	OfferExpiresAt *time.Time `json:"offer_expires_at"`                                        // 保留截止时间
+	AppointmentID  *uint      `json:"appointment_id"`                                          // 确认后生成的预约
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
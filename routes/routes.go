@@ -3,7 +3,9 @@ package routes
 import (
 	"ental-health-system/config"
 	"ental-health-system/controllers"
+	"ental-health-system/utils"
 
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +20,14 @@ func SetupRoutes(r *gin.Engine) {
 	r.Use(config.LoggerMiddleware())
 	r.Use(config.CORSMiddleware())
 
+	// 本地存储的上传文件（头像等）
+	if local, ok := utils.CurrentStorage().(*utils.LocalStorage); ok && strings.HasPrefix(local.URLPrefix, "/") {
+		r.Static(local.URLPrefix, local.Root)
+	}
+
+	// JWT公钥集合，供其他服务验签（不限流，便于定期拉取）
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	// API v1
 	v1 := r.Group("/api/v1")
 	{
@@ -26,28 +36,113 @@ func SetupRoutes(r *gin.Engine) {
 		public.Use(config.RateLimitMiddleware(limiter))
 		{
 			public.POST("/login", controllers.Login)
+			public.POST("/login/2fa", controllers.LoginTwoFactor)
+			public.POST("/login/2fa/setup", controllers.SetupTwoFactorOnLogin)
 			public.POST("/register", controllers.Register)
+			public.POST("/token/refresh", controllers.RefreshToken)
+			public.POST("/password/forgot", controllers.ForgotPassword)
+			public.POST("/password/reset", controllers.ResetPassword)
+			public.POST("/password/expired", controllers.ChangeExpiredPassword)
+
+			// 校园统一认证
+			public.GET("/sso/oidc/authorize", controllers.OIDCAuthorize)
+			public.POST("/sso/oidc/callback", controllers.OIDCCallback)
+			public.GET("/sso/cas/login", controllers.CASLogin)
+			public.POST("/sso/cas/callback", controllers.CASCallback)
+
+			// 个人数据导出包下载，凭下载令牌访问
+			public.GET("/exports/:id/download", controllers.DownloadDataExport)
+
+			// 日历订阅，凭订阅令牌访问
+			public.GET("/calendar/feeds/:token", controllers.GetCalendarFeed)
 		}
 
 		// 需要认证的路由
 		auth := v1.Group("")
 		auth.Use(config.JWTMiddleware())
 		{
+			auth.POST("/logout", controllers.Logout)
+
 			// 用户相关路由
 			users := auth.Group("/users")
 			{
-				// users.GET("/profile", controllers.GetUserProfile)
-				// users.PUT("/profile", controllers.UpdateUserProfile)
+				users.GET("/me", controllers.GetMyProfile)
+				users.PUT("/me", controllers.UpdateMyProfile)
+				users.POST("/me/contact/verify", controllers.VerifyMyContact)
+				users.POST("/me/avatar", controllers.UploadAvatar)
+				users.DELETE("/me/avatar", controllers.DeleteAvatar)
+				users.POST("/me/exports", controllers.RequestDataExport)
+				users.GET("/me/exports", controllers.GetMyDataExports)
+				users.POST("/me/erasure", controllers.RequestErasure)
+				users.GET("/me/erasure", controllers.GetMyErasureRequests)
+				users.GET("/me/booking-status", controllers.GetMyBookingStatus)
+				users.GET("/me/notifications", controllers.GetMyNotifications)
+				users.POST("/me/notifications/read-all", controllers.MarkAllNotificationsRead)
+				users.POST("/me/notifications/:id/read", controllers.MarkNotificationRead)
+				users.GET("/me/calendar-feed", controllers.GetMyCalendarFeed)
+				users.POST("/me/calendar-feed", controllers.RegenerateMyCalendarFeed)
+				users.DELETE("/me/calendar-feed", controllers.DeleteMyCalendarFeed)
+				users.PUT("/me/password", controllers.ChangePassword)
+				users.GET("/me/sessions", controllers.GetMySessions)
+				users.DELETE("/me/sessions", controllers.RevokeAllMySessions)
+				users.DELETE("/me/sessions/:id", controllers.RevokeMySession)
+				users.GET("/me/2fa", controllers.GetTwoFactorStatus)
+				users.POST("/me/2fa/setup", controllers.SetupTwoFactor)
+				users.POST("/me/2fa/enable", controllers.EnableTwoFactor)
+				users.POST("/me/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+				users.DELETE("/me/2fa", controllers.DisableTwoFactor)
 
-				// 管理员专用路由
-				admin := users.Group("")
-				admin.Use(config.RoleAuthMiddleware("admin"))
+				// 用户管理路由（按权限控制）
+				userRead := users.Group("")
+				userRead.Use(config.RequirePermission("user:read:any"))
 				{
-					admin.GET("", controllers.GetUserList)
-					admin.POST("", controllers.CreateUser)
-					admin.PUT("/:id", controllers.UpdateUser)
-					admin.DELETE("/:id", controllers.DeleteUser)
+					userRead.GET("", controllers.GetUserList)
+					userRead.GET("/locked", controllers.GetLockedUsers)
+					userRead.GET("/export", controllers.ExportUsers)
+					userRead.GET("/:id", controllers.GetUserByID)
+					userRead.GET("/:id/login-attempts", controllers.GetUserLoginAttempts)
 				}
+
+				userManage := users.Group("")
+				userManage.Use(config.RequirePermission("user:manage"))
+				{
+					userManage.POST("", controllers.CreateUser)
+					userManage.POST("/import", controllers.ImportStudents)
+					userManage.PUT("/:id", controllers.UpdateUser)
+					userManage.DELETE("/:id", controllers.DeleteUser)
+					userManage.POST("/:id/restore", controllers.RestoreUser)
+					userManage.DELETE("/:id/2fa", controllers.ResetUserTwoFactor)
+					userManage.POST("/:id/unlock", controllers.UnlockUser)
+					userManage.POST("/archive-graduated", controllers.RunStudentArchive)
+					userManage.POST("/:id/archive", controllers.ArchiveStudent)
+					userManage.POST("/:id/reactivate", controllers.ReactivateStudent)
+				}
+
+				users.DELETE("/:id/sessions", config.RequirePermission("session:manage:any"), controllers.RevokeUserSessions)
+				users.GET("/:id/appointments", config.RequirePermission("counseling:read:any"), controllers.GetUserCounselingHistory)
+				users.GET("/:id/booking-status", config.RequirePermission("appointment:read:any"), controllers.GetUserBookingStatus)
+			}
+
+			// 角色权限管理路由
+			roles := auth.Group("/roles")
+			roles.Use(config.RequirePermission("role:manage"))
+			{
+				roles.GET("", controllers.GetRoleList)
+				roles.POST("", controllers.CreateRole)
+				roles.PUT("/:id", controllers.UpdateRole)
+				roles.PUT("/:id/permissions", controllers.SetRolePermissions)
+				roles.DELETE("/:id", controllers.DeleteRole)
+			}
+			auth.GET("/permissions", config.RequirePermission("role:manage"), controllers.GetPermissionList)
+			auth.GET("/audit-logs", config.RequirePermission("audit:read"), controllers.GetAuditLogs)
+
+			// 数据删除申请审核路由
+			erasure := auth.Group("/erasure-requests")
+			erasure.Use(config.RequirePermission("privacy:manage"))
+			{
+				erasure.GET("", controllers.GetErasureRequests)
+				erasure.POST("/:id/approve", controllers.ApproveErasureRequest)
+				erasure.POST("/:id/reject", controllers.RejectErasureRequest)
 			}
 
 			// 学生专用路由
@@ -64,14 +159,50 @@ func SetupRoutes(r *gin.Engine) {
 				// 添加咨询师专用路由
 			}
 
+			// 可预约时间管理路由
+			availability := auth.Group("/availability")
+			availability.Use(config.RequirePermission("timeslot:manage:own", "timeslot:manage:any"))
+			{
+				availability.GET("", controllers.GetAvailability)
+				availability.POST("/templates", controllers.CreateAvailabilityTemplate)
+				availability.PUT("/templates/:id", controllers.UpdateAvailabilityTemplate)
+				availability.DELETE("/templates/:id", controllers.DeleteAvailabilityTemplate)
+				availability.POST("/exceptions", controllers.CreateAvailabilityException)
+				availability.DELETE("/exceptions/:id", controllers.DeleteAvailabilityException)
+			}
+			auth.GET("/timeslots", controllers.GetAvailableTimeSlots)
+
+			// 停诊日历路由
+			auth.GET("/blackouts", controllers.GetBlackouts)
+			auth.POST("/blackouts", config.RequirePermission("calendar:manage"), controllers.CreateBlackout)
+			auth.DELETE("/blackouts/:id", config.RequirePermission("calendar:manage"), controllers.DeleteBlackout)
+
+			// 预约规则路由
+			auth.GET("/appointment-policy", controllers.GetAppointmentPolicy)
+			auth.PUT("/appointment-policy", config.RequirePermission("appointment:manage:any"), controllers.UpdateAppointmentPolicy)
+			auth.POST("/booking-restrictions/:id/lift", config.RequirePermission("appointment:manage:any"), controllers.LiftBookingRestriction)
+
+			// 预约候补路由
+			waitlist := auth.Group("/waitlist")
+			{
+				waitlist.POST("", config.RequirePermission("appointment:create"), controllers.JoinWaitlist)
+				waitlist.GET("", config.RequirePermission("appointment:read:own", "appointment:read:any"), controllers.GetWaitlist)
+				waitlist.POST("/:id/accept", config.RequirePermission("appointment:create"), controllers.AcceptWaitlistOffer)
+				waitlist.DELETE("/:id", config.RequirePermission("appointment:create"), controllers.LeaveWaitlist)
+			}
+
 			// 预约相关路由
 			appointments := auth.Group("/appointments")
 			{
-				appointments.POST("/", controllers.CreateAppointment)
-				appointments.GET("/", controllers.GetAppointmentList)
-				appointments.GET("/:id", controllers.GetAppointmentByID)
-				appointments.PUT("/:id", controllers.UpdateAppointment)
-				appointments.DELETE("/:id", controllers.DeleteAppointment)
+				appointments.POST("", config.RequirePermission("appointment:create"), controllers.CreateAppointment)
+				appointments.GET("", config.RequirePermission("appointment:read:own", "appointment:read:any"), controllers.GetAppointmentList)
+				appointments.GET("/:id", config.RequirePermission("appointment:read:own", "appointment:read:any"), controllers.GetAppointmentByID)
+				appointments.GET("/:id/ics", config.RequirePermission("appointment:read:own", "appointment:read:any"), controllers.DownloadAppointmentICS)
+				appointments.GET("/:id/history", config.RequirePermission("appointment:read:own", "appointment:read:any"), controllers.GetAppointmentHistory)
+				appointments.POST("/:id/status", config.RequirePermission("appointment:create", "appointment:manage:own", "appointment:manage:any"), controllers.ChangeAppointmentStatus)
+				appointments.PUT("/:id", config.RequirePermission("appointment:create", "appointment:manage:own", "appointment:manage:any"), controllers.UpdateAppointment)
+				appointments.POST("/:id/reschedule", config.RequirePermission("appointment:create", "appointment:manage:own", "appointment:manage:any"), controllers.RescheduleAppointment)
+				appointments.DELETE("/:id", config.RequirePermission("appointment:delete"), controllers.DeleteAppointment)
 			}
 		}
 	}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// CASConfig CAS 客户端配置
+type CASConfig struct {
+	BaseURL    string       // CAS 服务地址，如 https://cas.example.edu/cas
+	ServiceURL string       // 本系统登记的 service 地址（前端回调页）
+	Version    string       // 协议版本：2 或 3，默认3（可返回用户属性）
+	HTTPClient *http.Client // 访问CAS服务使用的客户端，为空时使用默认客户端
+}
+
+// CASConfigFromEnv 从环境变量读取CAS配置，未配置 CAS_BASE_URL 时返回nil
+func CASConfigFromEnv() *CASConfig {
+	base := os.Getenv("CAS_BASE_URL")
+	if base == "" {
+		return nil
+	}
+	version := os.Getenv("CAS_VERSION")
+	if version == "" {
+		version = "3"
+	}
+	return &CASConfig{
+		BaseURL:    strings.TrimSuffix(base, "/"),
+		ServiceURL: os.Getenv("CAS_SERVICE_URL"),
+		Version:    version,
+	}
+}
+
+// LoginURL 生成跳转到CAS登录页的地址
+func (cfg *CASConfig) LoginURL() string {
+	return cfg.BaseURL + "/login?service=" + url.QueryEscape(cfg.ServiceURL)
+}
+
+// CASIdentity 票据校验成功后得到的用户身份
+type CASIdentity struct {
+	User       string
+	Attributes map[string]string
+}
+
+// casServiceResponse serviceValidate 响应的XML结构
+type casServiceResponse struct {
+	Success *struct {
+		User       string `xml:"user"`
+		Attributes struct {
+			Items []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"attributes"`
+	} `xml:"authenticationSuccess"`
+	Failure *struct {
+		Code    string `xml:"code,attr"`
+		Message string `xml:",chardata"`
+	} `xml:"authenticationFailure"`
+}
+
+// ValidateTicket 向CAS服务校验 service ticket
+func (cfg *CASConfig) ValidateTicket(ticket string) (*CASIdentity, error) {
+	path := "/p3/serviceValidate"
+	if cfg.Version == "2" {
+		path = "/serviceValidate"
+	}
+	u := cfg.BaseURL + path + "?service=" + url.QueryEscape(cfg.ServiceURL) + "&ticket=" + url.QueryEscape(ticket)
+
+	resp, err := ssoClient(cfg.HTTPClient).Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CAS票据校验失败: status %d", resp.StatusCode)
+	}
+
+	var sr casServiceResponse
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&sr); err != nil {
+		return nil, err
+	}
+	if sr.Failure != nil {
+		return nil, fmt.Errorf("CAS票据无效: %s %s", sr.Failure.Code, strings.TrimSpace(sr.Failure.Message))
+	}
+	if sr.Success == nil || strings.TrimSpace(sr.Success.User) == "" {
+		return nil, errors.New("CAS响应缺少用户信息")
+	}
+
+	identity := &CASIdentity{User: strings.TrimSpace(sr.Success.User), Attributes: make(map[string]string)}
+	for _, item := range sr.Success.Attributes.Items {
+		// 多值属性只保留第一个值
+		if _, ok := identity.Attributes[item.XMLName.Local]; !ok {
+			identity.Attributes[item.XMLName.Local] = strings.TrimSpace(item.Value)
+		}
+	}
+	return identity, nil
+}
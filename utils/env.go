@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// DurationFromEnv 从环境变量读取时长，未配置或格式错误时返回默认值
+func DurationFromEnv(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+// IntFromEnv 从环境变量读取正整数，未配置或格式错误时返回默认值
+func IntFromEnv(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// NonNegativeIntFromEnv 从环境变量读取非负整数，0 通常表示关闭对应功能；未配置或格式错误时返回默认值
+func NonNegativeIntFromEnv(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar 事件状态
+const (
+	ICalStatusTentative = "TENTATIVE" // 待确认
+	ICalStatusConfirmed = "CONFIRMED" // 已确认
+	ICalStatusCancelled = "CANCELLED" // 已取消
+)
+
+// ICalEvent 日历中的一个事件（VEVENT）
+type ICalEvent struct {
+	UID          string    // 全局唯一标识，同一事件更新时保持不变
+	Start        time.Time // 开始时间
+	End          time.Time // 结束时间
+	Summary      string    // 标题
+	Description  string    // 描述
+	Location     string    // 地点
+	Status       string    // 状态：TENTATIVE/CONFIRMED/CANCELLED
+	Sequence     int       // 修订号，事件时间或状态变化时递增
+	LastModified time.Time // 最后修改时间
+	Transparent  bool      // 是否不占用忙闲时间
+}
+
+// ICalendar 日历（VCALENDAR）
+type ICalendar struct {
+	Name   string // 日历名称，订阅时显示
+	Events []ICalEvent
+}
+
+// icalTimeLayout UTC 时间格式
+const icalTimeLayout = "20060102T150405Z"
+
+// icalEscape 转义 TEXT 类型的值
+func icalEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return strings.ReplaceAll(s, "\r", `\n`)
+}
+
+// icalLine 写入一行内容，超过75字节时按 RFC 5545 折行，不拆分多字节字符
+func icalLine(w io.Writer, name, value string) error {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, err := io.WriteString(w, line[:cut]+"\r\n "); err != nil {
+			return err
+		}
+		line = line[cut:]
+		limit = 74 // 续行开头的空格占1字节
+	}
+	_, err := io.WriteString(w, line+"\r\n")
+	return err
+}
+
+// WriteICalendar 按 RFC 5545 输出日历
+func WriteICalendar(w io.Writer, cal *ICalendar, now time.Time) error {
+	lines := [][2]string{
+		{"BEGIN", "VCALENDAR"},
+		{"VERSION", "2.0"},
+		{"PRODID", "-//Mental Health System//Appointments//ZH"},
+		{"CALSCALE", "GREGORIAN"},
+		{"METHOD", "PUBLISH"},
+	}
+	if cal.Name != "" {
+		lines = append(lines, [2]string{"X-WR-CALNAME", icalEscape(cal.Name)})
+	}
+
+	stamp := now.UTC().Format(icalTimeLayout)
+	for _, e := range cal.Events {
+		lines = append(lines,
+			[2]string{"BEGIN", "VEVENT"},
+			[2]string{"UID", icalEscape(e.UID)},
+			[2]string{"DTSTAMP", stamp},
+			[2]string{"DTSTART", e.Start.UTC().Format(icalTimeLayout)},
+			[2]string{"DTEND", e.End.UTC().Format(icalTimeLayout)},
+			[2]string{"SUMMARY", icalEscape(e.Summary)},
+			[2]string{"SEQUENCE", fmt.Sprint(e.Sequence)},
+		)
+		if e.Description != "" {
+			lines = append(lines, [2]string{"DESCRIPTION", icalEscape(e.Description)})
+		}
+		if e.Location != "" {
+			lines = append(lines, [2]string{"LOCATION", icalEscape(e.Location)})
+		}
+		if e.Status != "" {
+			lines = append(lines, [2]string{"STATUS", e.Status})
+		}
+		if !e.LastModified.IsZero() {
+			lines = append(lines, [2]string{"LAST-MODIFIED", e.LastModified.UTC().Format(icalTimeLayout)})
+		}
+		if e.Transparent {
+			lines = append(lines, [2]string{"TRANSP", "TRANSPARENT"})
+		}
+		lines = append(lines, [2]string{"END", "VEVENT"})
+	}
+	lines = append(lines, [2]string{"END", "VCALENDAR"})
+
+	for _, l := range lines {
+		if err := icalLine(w, l[0], l[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
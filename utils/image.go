@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	_ "image/png" // 注册PNG解码器
+	"net/http"
+)
+
+var (
+	// ErrUnsupportedImage 文件内容不是支持的图片格式
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	// ErrImageDimensions 图片尺寸不在允许范围内
+	ErrImageDimensions = errors.New("image dimensions out of range")
+)
+
+// imageFormats 允许上传的图片类型（按文件内容识别）及对应的解码器名称
+var imageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// DecodedImage 解码后的图片，只保留像素数据，EXIF等元数据均被丢弃
+type DecodedImage struct {
+	Image       image.Image
+	Format      string // jpeg/png/gif
+	Orientation int    // JPEG EXIF 中的方向（1-8），生成缩略图时据此旋转
+}
+
+// DecodeImage 按文件内容识别图片类型并解码，宽高需在 [minDim, maxDim] 内
+// 先读取尺寸再完整解码，避免超大图片耗尽内存
+func DecodeImage(data []byte, minDim, maxDim int) (*DecodedImage, error) {
+	format, ok := imageFormats[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width < minDim || cfg.Height < minDim || cfg.Width > maxDim || cfg.Height > maxDim {
+		return nil, ErrImageDimensions
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	d := &DecodedImage{Image: img, Format: format, Orientation: 1}
+	if format == "jpeg" {
+		d.Orientation = jpegOrientation(data)
+	}
+	return d, nil
+}
+
+// Thumbnail 居中裁剪为正方形并缩放到 size×size，透明部分以白色填充，并按 EXIF 方向摆正
+func (d *DecodedImage) Thumbnail(size int) image.Image {
+	b := d.Image.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+	thumb := resizeBox(d.Image, crop, size)
+	// 居中的正方形裁剪与旋转、翻转可交换，在缩略图上摆正方向开销最小
+	return orient(thumb, d.Orientation)
+}
+
+// resizeBox 使用区域平均将 src 中的正方形区域缩放为 size×size，结果合成到白色背景上
+func resizeBox(src image.Image, r image.Rectangle, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	side := r.Dx()
+	for dy := 0; dy < size; dy++ {
+		y0 := r.Min.Y + dy*side/size
+		y1 := max(r.Min.Y+(dy+1)*side/size, y0+1)
+		for dx := 0; dx < size; dx++ {
+			x0 := r.Min.X + dx*side/size
+			x1 := max(r.Min.X+(dx+1)*side/size, x0+1)
+
+			var sr, sg, sb, sa, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := src.At(x, y).RGBA()
+					sr, sg, sb, sa = sr+uint64(cr), sg+uint64(cg), sb+uint64(cb), sa+uint64(ca)
+					n++
+				}
+			}
+			// 预乘alpha的颜色叠加到白色背景
+			bg := 0xffff - sa/n
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8((sr/n + bg) >> 8),
+				G: uint8((sg/n + bg) >> 8),
+				B: uint8((sb/n + bg) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// orient 按 EXIF 方向值旋转或翻转图片
+func orient(src *image.RGBA, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = w-1-x, y
+			case 3: // 旋转180度
+				sx, sy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				sx, sy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				sx, sy = y, x
+			case 6: // 顺时针旋转90度
+				sx, sy = y, h-1-x
+			case 7: // 沿副对角线翻转
+				sx, sy = w-1-y, h-1-x
+			case 8: // 逆时针旋转90度
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation 从 JPEG 的 EXIF(APP1) 段读取方向标签，读取失败时返回1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // 图像数据开始，之后不再有元数据段
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation 在 TIFF 结构的 IFD0 中查找方向标签(0x0112)
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// EncodeJPEG 将图片编码为不含任何元数据的 JPEG
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -7,44 +7,83 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-var jwtSecret = []byte("your-secret-key") // 在实际应用中应该从环境变量获取
+// 令牌类型
+const (
+	TokenTypeAccess         = "access"          // 访问令牌
+	TokenTypeRefresh        = "refresh"         // 刷新令牌
+	TokenTypeTwoFactor      = "2fa_challenge"   // 二次验证挑战令牌，仅用于完成登录第二步
+	TokenTypePasswordChange = "password_change" // 密码过期时签发，仅用于修改密码
+)
+
+// 默认有效期
+const (
+	defaultAccessTokenTTL  = 30 * time.Minute    // 访问令牌默认30分钟
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour // 刷新令牌默认30天
+)
 
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Role   string `json:"role"`
+	Type   string `json:"type"` // 令牌类型：access/refresh
 	jwt.StandardClaims
 }
 
-// GenerateToken 生成JWT token
-func GenerateToken(userID uint, role string) (string, error) {
-	nowTime := time.Now()
-	expireTime := nowTime.Add(24 * time.Hour) // token有效期24小时
+// AccessTokenTTL 访问令牌有效期，可通过 ACCESS_TOKEN_TTL 配置（如 30m）
+func AccessTokenTTL() time.Duration {
+	return DurationFromEnv("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL 刷新令牌有效期，可通过 REFRESH_TOKEN_TTL 配置（如 720h）
+func RefreshTokenTTL() time.Duration {
+	return DurationFromEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+// GenerateToken 生成指定类型的JWT token
+func GenerateToken(userID uint, role string, tokenType string, expiresAt time.Time) (string, error) {
+	// 每个令牌带有唯一的jti，避免同一秒内签发的令牌字符串相同
+	jti, err := RandomHex(16)
+	if err != nil {
+		return "", err
+	}
+
+	kr, err := currentKeyring()
+	if err != nil {
+		return "", err
+	}
 
 	claims := Claims{
 		UserID: userID,
 		Role:   role,
+		Type:   tokenType,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expireTime.Unix(),
-			IssuedAt:  nowTime.Unix(),
+			Id:        jti,
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    kr.issuer,
 		},
 	}
 
-	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := tokenClaims.SignedString(jwtSecret)
-	return token, err
+	tokenClaims := jwt.NewWithClaims(kr.current.Method, claims)
+	tokenClaims.Header["kid"] = kr.current.ID
+	return tokenClaims.SignedString(kr.current.SignKey)
 }
 
-// ParseToken 解析JWT token
+// ParseToken 解析JWT token，根据头部的kid从密钥环中选择验签密钥
 func ParseToken(token string) (*Claims, error) {
-	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	kr, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
 
+	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, kr.lookup)
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := tokenClaims.Claims.(*Claims); ok && tokenClaims.Valid {
+		if kr.issuer != "" && !claims.VerifyIssuer(kr.issuer, true) {
+			return nil, errors.New("invalid token issuer")
+		}
 		return claims, nil
 	}
 
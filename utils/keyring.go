@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256" // HMAC-SHA256，对称密钥
+	AlgRS256 = "RS256" // RSA-SHA256，非对称密钥
+	AlgEdDSA = "EdDSA" // Ed25519，非对称密钥
+)
+
+// signingKey 一个签名/验签密钥
+type signingKey struct {
+	ID        string            // 密钥ID，写入JWT头部的kid
+	Method    jwt.SigningMethod // 签名算法
+	SignKey   interface{}       // 签名密钥，仅用于验签的历史公钥为nil
+	VerifyKey interface{}       // 验签密钥
+}
+
+// Keyring JWT密钥环：当前密钥用于签发，历史密钥仅用于轮换期间验签
+type Keyring struct {
+	current *signingKey
+	keys    map[string]*signingKey
+	issuer  string
+}
+
+var (
+	keyring     *Keyring
+	keyringErr  error
+	keyringOnce sync.Once
+)
+
+// InitJWTKeys 从环境变量加载JWT密钥，应在服务启动时调用以便尽早发现配置错误
+//
+// 支持的环境变量：
+//   - JWT_ALGORITHM：HS256/RS256/EdDSA，未配置时根据私钥类型推断，默认HS256
+//   - JWT_SECRET：HS256 密钥，必须配置；仅 GIN_MODE 为 debug/test 时允许缺省并使用进程内随机密钥
+//   - JWT_PRIVATE_KEY_FILE 或 JWT_PRIVATE_KEY：RS256/EdDSA 的PEM私钥（文件路径或内容）
+//   - JWT_KEY_ID：当前密钥ID，未配置时由密钥内容派生
+//   - JWT_PREVIOUS_KEY_FILES：历史密钥，格式 kid=路径,kid=路径，PEM可以是私钥或公钥
+//   - JWT_PREVIOUS_SECRETS：历史HS256密钥，格式 kid=密钥,kid=密钥
+//   - JWT_ISSUER：令牌签发者（iss），配置后验签时同时校验
+func InitJWTKeys() error {
+	_, err := currentKeyring()
+	return err
+}
+
+// currentKeyring 获取全局密钥环，首次调用时加载
+func currentKeyring() (*Keyring, error) {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = loadKeyring()
+	})
+	return keyring, keyringErr
+}
+
+// loadKeyring 根据环境变量构建密钥环
+func loadKeyring() (*Keyring, error) {
+	kr := &Keyring{
+		keys:   make(map[string]*signingKey),
+		issuer: os.Getenv("JWT_ISSUER"),
+	}
+
+	current, err := loadCurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if id := os.Getenv("JWT_KEY_ID"); id != "" {
+		current.ID = id
+	}
+	kr.current = current
+	kr.keys[current.ID] = current
+
+	for _, entry := range splitKeyEntries(os.Getenv("JWT_PREVIOUS_KEY_FILES")) {
+		pemBytes, err := os.ReadFile(entry.value)
+		if err != nil {
+			return nil, fmt.Errorf("读取历史密钥 %s 失败: %w", entry.value, err)
+		}
+		key, err := parsePEMKey(pemBytes, "")
+		if err != nil {
+			return nil, fmt.Errorf("解析历史密钥 %s 失败: %w", entry.value, err)
+		}
+		if err := kr.addPrevious(key, entry.id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range splitKeyEntries(os.Getenv("JWT_PREVIOUS_SECRETS")) {
+		if err := kr.addPrevious(hmacKey([]byte(entry.value)), entry.id); err != nil {
+			return nil, err
+		}
+	}
+
+	return kr, nil
+}
+
+// addPrevious 添加仅用于验签的历史密钥
+func (kr *Keyring) addPrevious(key *signingKey, id string) error {
+	if id != "" {
+		key.ID = id
+	}
+	if _, exists := kr.keys[key.ID]; exists {
+		return fmt.Errorf("JWT密钥ID重复: %s", key.ID)
+	}
+	key.SignKey = nil
+	kr.keys[key.ID] = key
+	return nil
+}
+
+// loadCurrentKey 加载当前用于签发的密钥
+func loadCurrentKey() (*signingKey, error) {
+	alg := os.Getenv("JWT_ALGORITHM")
+
+	pemBytes := []byte(os.Getenv("JWT_PRIVATE_KEY"))
+	if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取JWT私钥失败: %w", err)
+		}
+		pemBytes = b
+	}
+
+	if len(pemBytes) > 0 && alg != AlgHS256 {
+		key, err := parsePEMKey(pemBytes, alg)
+		if err != nil {
+			return nil, fmt.Errorf("解析JWT私钥失败: %w", err)
+		}
+		if key.SignKey == nil {
+			return nil, errors.New("JWT私钥配置为公钥，无法用于签发")
+		}
+		return key, nil
+	}
+
+	switch alg {
+	case "", AlgHS256:
+	case AlgRS256, AlgEdDSA:
+		return nil, fmt.Errorf("%s 需要配置 JWT_PRIVATE_KEY_FILE 或 JWT_PRIVATE_KEY", alg)
+	default:
+		return nil, fmt.Errorf("不支持的JWT签名算法: %s", alg)
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		// 进程内随机密钥在重启后失效，且多个实例之间互不认可对方签发的令牌，只允许在本地开发和测试时使用
+		if mode := os.Getenv("GIN_MODE"); mode != "debug" && mode != "test" {
+			return nil, errors.New("未配置 JWT_SECRET 或 JWT_PRIVATE_KEY_FILE/JWT_PRIVATE_KEY")
+		}
+		log.Println("警告: 未配置 JWT_SECRET，使用随机生成的临时密钥")
+		random, err := RandomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		secret = random
+	}
+	return hmacKey([]byte(secret)), nil
+}
+
+// hmacKey 构造HS256密钥
+func hmacKey(secret []byte) *signingKey {
+	sum := sha256.Sum256(secret)
+	return &signingKey{
+		ID:        "hs-" + hex.EncodeToString(sum[:4]),
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}
+}
+
+// parsePEMKey 解析PEM格式的RSA/Ed25519私钥或公钥
+// alg 为空时根据密钥类型推断算法
+func parsePEMKey(pemBytes []byte, alg string) (*signingKey, error) {
+	var (
+		priv crypto.PrivateKey
+		pub  crypto.PublicKey
+	)
+
+	if k, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+		priv, pub = k, &k.PublicKey
+	} else if k, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+		priv, pub = k, k.(ed25519.PrivateKey).Public()
+	} else if k, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		pub = k
+	} else if k, err := jwt.ParseEdPublicKeyFromPEM(pemBytes); err == nil {
+		pub = k
+	} else {
+		return nil, errors.New("无法识别的PEM密钥")
+	}
+
+	key := &signingKey{SignKey: priv, VerifyKey: pub}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	}
+	if alg != "" && alg != key.Method.Alg() {
+		return nil, fmt.Errorf("密钥类型与签名算法 %s 不匹配", alg)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	key.ID = hex.EncodeToString(sum[:8])
+	return key, nil
+}
+
+// keyEntry 环境变量中 kid=值 形式的配置项
+type keyEntry struct {
+	id    string
+	value string
+}
+
+// splitKeyEntries 解析逗号分隔的 kid=值 列表，省略kid时由密钥内容派生
+func splitKeyEntries(s string) []keyEntry {
+	var entries []keyEntry
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if id, value, ok := strings.Cut(part, "="); ok {
+			entries = append(entries, keyEntry{id: strings.TrimSpace(id), value: strings.TrimSpace(value)})
+		} else {
+			entries = append(entries, keyEntry{value: part})
+		}
+	}
+	return entries
+}
+
+// lookup 根据JWT头部查找验签密钥，并校验算法与密钥匹配以防止算法混淆攻击
+func (kr *Keyring) lookup(token *jwt.Token) (interface{}, error) {
+	key := kr.current
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok = kr.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.VerifyKey, nil
+}
+
+// JSONWebKey 单个公钥的JWK表示（RFC 7517）
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`   // RSA 模数
+	E   string `json:"e,omitempty"`   // RSA 公共指数
+	Crv string `json:"crv,omitempty"` // OKP 曲线
+	X   string `json:"x,omitempty"`   // OKP 公钥
+}
+
+// JSONWebKeySet JWKS 公钥集合
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS 返回当前及历史非对称密钥的公钥集合，HS256 密钥不会公开
+func JWKS() (*JSONWebKeySet, error) {
+	kr, err := currentKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(kr.keys))}
+	// 当前密钥排在首位
+	ordered := []*signingKey{kr.current}
+	for id, key := range kr.keys {
+		if id != kr.current.ID {
+			ordered = append(ordered, key)
+		}
+	}
+
+	for _, key := range ordered {
+		jwk := JSONWebKey{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+		switch pub := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
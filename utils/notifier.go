@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 通知渠道
+const (
+	ChannelEmail = "email"  // 邮件
+	ChannelSMS   = "sms"    // 短信
+	ChannelInApp = "in_app" // 站内通知，接收地址为用户ID
+)
+
+// Message 一条待发送的通知
+type Message struct {
+	Channel string // 通知渠道
+	To      string // 接收地址：邮箱或手机号
+	Subject string // 标题，短信渠道忽略
+	Body    string // 正文
+}
+
+// Notifier 通知发送接口
+type Notifier interface {
+	Send(msg Message) error
+}
+
+// LogNotifier 仅将通知写入日志，用于本地开发
+type LogNotifier struct{}
+
+// Send 打印通知内容
+func (LogNotifier) Send(msg Message) error {
+	log.Printf("[通知][%s] 收件人: %s 标题: %s\n%s", msg.Channel, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FakeNotifier 将通知保存在内存中而不真正发送，用于测试和本地联调
+type FakeNotifier struct {
+	mu       sync.Mutex
+	messages []Message
+	Err      error // 不为空时 Send 返回该错误，用于模拟发送失败
+}
+
+// Send 记录通知
+func (n *FakeNotifier) Send(msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.Err != nil {
+		return n.Err
+	}
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+// Messages 返回已记录的通知
+func (n *FakeNotifier) Messages() []Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Message(nil), n.messages...)
+}
+
+// Reset 清空已记录的通知
+func (n *FakeNotifier) Reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = nil
+}
+
+// SMTPNotifier 通过SMTP发送邮件
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send 发送纯文本邮件
+func (n *SMTPNotifier) Send(msg Message) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return smtp.SendMail(net.JoinHostPort(n.Host, n.Port), auth, n.From, []string{msg.To}, []byte(b.String()))
+}
+
+// SMSProvider 短信服务商接口，由具体的短信平台实现
+type SMSProvider interface {
+	SendSMS(phone, content string) error
+}
+
+// SMSNotifier 通过短信服务商发送短信
+type SMSNotifier struct {
+	Provider SMSProvider
+}
+
+// Send 发送短信
+func (n *SMSNotifier) Send(msg Message) error {
+	return n.Provider.SendSMS(msg.To, msg.Body)
+}
+
+var (
+	notifiers     = make(map[string]Notifier)
+	notifiersMu   sync.RWMutex
+	notifiersOnce sync.Once
+	fakeNotifier  *FakeNotifier
+)
+
+// FakeNotifications 返回 NOTIFIER_FAKE 模式下记录通知的 FakeNotifier，未启用时返回 nil
+func FakeNotifications() *FakeNotifier {
+	initNotifiers()
+	return fakeNotifier
+}
+
+// RegisterNotifier 注册指定渠道的通知实现，覆盖默认实现
+func RegisterNotifier(channel string, n Notifier) {
+	initNotifiers()
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers[channel] = n
+}
+
+// Notify 按渠道发送通知，渠道未注册时写入日志
+func Notify(msg Message) error {
+	initNotifiers()
+	notifiersMu.RLock()
+	n, ok := notifiers[msg.Channel]
+	notifiersMu.RUnlock()
+	if !ok {
+		n = LogNotifier{}
+	}
+	return n.Send(msg)
+}
+
+// initNotifiers 根据环境变量初始化默认通知渠道
+// 配置 SMTP_HOST 时邮件通过SMTP发送，否则写入日志；短信默认写入日志，需通过 RegisterNotifier 接入服务商；
+// 站内通知需通过 RegisterNotifier 注册写入数据库的实现。
+// NOTIFIER_FAKE=true 时所有渠道使用同一个 FakeNotifier，可通过 FakeNotifications 取得
+func initNotifiers() {
+	notifiersOnce.Do(func() {
+		notifiersMu.Lock()
+		defer notifiersMu.Unlock()
+
+		if fake, _ := strconv.ParseBool(os.Getenv("NOTIFIER_FAKE")); fake {
+			fakeNotifier = &FakeNotifier{}
+			for _, channel := range []string{ChannelEmail, ChannelSMS, ChannelInApp} {
+				notifiers[channel] = fakeNotifier
+			}
+			return
+		}
+
+		if host := os.Getenv("SMTP_HOST"); host != "" {
+			port := os.Getenv("SMTP_PORT")
+			if port == "" {
+				port = "25"
+			}
+			notifiers[ChannelEmail] = &SMTPNotifier{
+				Host:     host,
+				Port:     port,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     os.Getenv("SMTP_FROM"),
+			}
+		} else {
+			notifiers[ChannelEmail] = LogNotifier{}
+		}
+		notifiers[ChannelSMS] = LogNotifier{}
+	})
+}
@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// defaultSSOHTTPClient 未指定 HTTPClient 时访问身份提供方使用的HTTP客户端
+var defaultSSOHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ssoClient 返回指定的HTTP客户端，未指定时使用默认客户端
+func ssoClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return defaultSSOHTTPClient
+}
+
+// OIDCConfig OpenID Connect 客户端配置
+type OIDCConfig struct {
+	Issuer       string // 身份提供方的 issuer，用于发现配置和校验 ID Token
+	ClientID     string
+	ClientSecret string // 公共客户端可为空，仅依赖 PKCE
+	RedirectURL  string // 授权完成后回调的前端地址，需在身份提供方登记
+	Scopes       string
+	HTTPClient   *http.Client // 访问身份提供方使用的客户端，为空时使用默认客户端；测试时可替换为本地模拟服务的客户端
+}
+
+// OIDCConfigFromEnv 从环境变量读取OIDC配置，未配置 OIDC_ISSUER 时返回nil
+func OIDCConfigFromEnv() *OIDCConfig {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil
+	}
+	scopes := os.Getenv("OIDC_SCOPES")
+	if scopes == "" {
+		scopes = "openid profile email"
+	}
+	return &OIDCConfig{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+	}
+}
+
+// oidcDiscovery 身份提供方的发现文档中用到的字段
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider 缓存的发现文档和签名公钥
+type oidcProvider struct {
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// oidcCacheTTL 发现文档和公钥的缓存时长
+const oidcCacheTTL = time.Hour
+
+var oidcProviders sync.Map // issuer -> *oidcProvider
+
+// provider 获取（必要时刷新）身份提供方的发现文档和公钥
+func (cfg *OIDCConfig) provider(forceRefresh bool) (*oidcDiscovery, map[string]interface{}, error) {
+	v, _ := oidcProviders.LoadOrStore(cfg.Issuer, &oidcProvider{})
+	p := v.(*oidcProvider)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !forceRefresh && p.discovery != nil && time.Since(p.fetchedAt) < oidcCacheTTL {
+		return p.discovery, p.keys, nil
+	}
+
+	var d oidcDiscovery
+	if err := getJSON(cfg.HTTPClient, cfg.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, nil, fmt.Errorf("获取OIDC发现文档失败: %w", err)
+	}
+	if d.Issuer != cfg.Issuer {
+		return nil, nil, fmt.Errorf("OIDC issuer 不匹配: %s", d.Issuer)
+	}
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := getJSON(cfg.HTTPClient, d.JWKSURI, &set); err != nil {
+		return nil, nil, fmt.Errorf("获取OIDC公钥失败: %w", err)
+	}
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k["use"] != "" && k["use"] != "sig" {
+			continue
+		}
+		if pub, err := parseJWK(k); err == nil {
+			keys[k["kid"]] = pub
+		}
+	}
+
+	p.discovery, p.keys, p.fetchedAt = &d, keys, time.Now()
+	return p.discovery, p.keys, nil
+}
+
+// getJSON 发起GET请求并解析JSON响应
+func getJSON(client *http.Client, u string, v interface{}) error {
+	resp, err := ssoClient(client).Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// parseJWK 解析RSA或EC(P-256)公钥
+func parseJWK(k map[string]string) (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k["kty"] {
+	case "RSA":
+		n, err := decode(k["n"])
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k["e"])
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k["crv"] != "P-256" {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := decode(k["x"])
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k["y"])
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// PKCECodeChallenge 计算 PKCE S256 code_challenge
+func PKCECodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL 生成授权码+PKCE流程的授权地址
+func (cfg *OIDCConfig) AuthorizationURL(state, nonce, codeVerifier string) (string, error) {
+	d, _, err := cfg.provider(false)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", cfg.ClientID)
+	v.Set("redirect_uri", cfg.RedirectURL)
+	v.Set("scope", cfg.Scopes)
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", PKCECodeChallenge(codeVerifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange 使用授权码换取并校验 ID Token，返回其中的声明
+func (cfg *OIDCConfig) Exchange(code, codeVerifier, nonce string) (jwt.MapClaims, error) {
+	d, _, err := cfg.provider(false)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := ssoClient(cfg.HTTPClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("授权码换取令牌失败: status %d", resp.StatusCode)
+	}
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("响应中缺少 id_token")
+	}
+
+	return cfg.verifyIDToken(tokenResp.IDToken, nonce)
+}
+
+// errUnknownKeyID ID Token 使用的公钥不在已获取的公钥集中
+var errUnknownKeyID = errors.New("unknown key id")
+
+// verifyIDToken 校验 ID Token 的签名、issuer、audience、有效期和 nonce
+func (cfg *OIDCConfig) verifyIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	keyFunc := func(refresh bool) jwt.Keyfunc {
+		return func(t *jwt.Token) (interface{}, error) {
+			_, keys, err := cfg.provider(refresh)
+			if err != nil {
+				return nil, err
+			}
+			kid, _ := t.Header["kid"].(string)
+			if key, ok := keys[kid]; ok {
+				return key, nil
+			}
+			// 未指定kid且只有一个公钥时直接使用
+			if kid == "" && len(keys) == 1 {
+				for _, key := range keys {
+					return key, nil
+				}
+			}
+			return nil, fmt.Errorf("%w %q", errUnknownKeyID, kid)
+		}
+	}
+
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "ES256"}}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(idToken, claims, keyFunc(false))
+	var verr *jwt.ValidationError
+	if errors.As(err, &verr) && errors.Is(verr.Inner, errUnknownKeyID) {
+		// 身份提供方可能已轮换密钥，遇到未知的 kid 时刷新公钥后重试一次
+		claims = jwt.MapClaims{}
+		_, err = parser.ParseWithClaims(idToken, claims, keyFunc(true))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("id_token expired")
+	}
+	if !claims.VerifyIssuer(cfg.Issuer, true) {
+		return nil, errors.New("invalid id_token issuer")
+	}
+	if !claims.VerifyAudience(cfg.ClientID, true) {
+		return nil, errors.New("invalid id_token audience")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("invalid id_token nonce")
+	}
+	return claims, nil
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 密码策略默认配置
+const (
+	defaultPasswordMinLength   = 8
+	defaultPasswordMaxLength   = 72 // bcrypt 只使用前72字节
+	defaultPasswordMinClasses  = 2
+	defaultPasswordHistorySize = 5
+	defaultPasswordMaxAge      = 90 * 24 * time.Hour
+	defaultPasswordMaxAgeRoles = "admin,counselor"
+)
+
+// commonPasswords 内置的常见弱密码
+var commonPasswords = []string{
+	"12345678", "123456789", "1234567890", "11111111", "88888888", "00000000",
+	"password", "password1", "password123", "passw0rd", "qwerty123", "qwertyuiop",
+	"abc12345", "abcd1234", "a1234567", "1qaz2wsx", "1q2w3e4r", "admin123",
+	"iloveyou", "woaini1314", "5201314520", "aa123456", "qq123456", "123123123",
+}
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength   int           // 最小长度
+	MaxLength   int           // 最大长度（字节）
+	MinClasses  int           // 至少包含的字符类别数：小写、大写、数字、符号
+	HistorySize int           // 不允许与最近N次使用过的密码相同，0 表示不检查
+	MaxAge      time.Duration // 密码最长有效期，仅对 MaxAgeRoles 中的角色生效
+	MaxAgeRoles []string      // 需要定期更换密码的角色
+	blocklist   map[string]struct{}
+}
+
+var (
+	passwordPolicy     *PasswordPolicy
+	passwordPolicyOnce sync.Once
+)
+
+// CurrentPasswordPolicy 获取密码策略，首次调用时从环境变量加载
+//
+// 支持的环境变量：PASSWORD_MIN_LENGTH、PASSWORD_MIN_CLASSES、PASSWORD_HISTORY_SIZE（0 表示不检查历史密码）、
+// PASSWORD_MAX_AGE（如 2160h）、PASSWORD_MAX_AGE_ROLES（如 admin,counselor）、
+// PASSWORD_BLOCKLIST_FILE（每行一个禁用密码，追加到内置列表）
+func CurrentPasswordPolicy() *PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		passwordPolicy = loadPasswordPolicy()
+	})
+	return passwordPolicy
+}
+
+// loadPasswordPolicy 根据环境变量构建密码策略
+func loadPasswordPolicy() *PasswordPolicy {
+	roles := os.Getenv("PASSWORD_MAX_AGE_ROLES")
+	if roles == "" {
+		roles = defaultPasswordMaxAgeRoles
+	}
+
+	p := &PasswordPolicy{
+		MinLength:   IntFromEnv("PASSWORD_MIN_LENGTH", defaultPasswordMinLength),
+		MaxLength:   defaultPasswordMaxLength,
+		MinClasses:  IntFromEnv("PASSWORD_MIN_CLASSES", defaultPasswordMinClasses),
+		HistorySize: NonNegativeIntFromEnv("PASSWORD_HISTORY_SIZE", defaultPasswordHistorySize),
+		MaxAge:      DurationFromEnv("PASSWORD_MAX_AGE", defaultPasswordMaxAge),
+		blocklist:   make(map[string]struct{}),
+	}
+	for _, r := range strings.Split(roles, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			p.MaxAgeRoles = append(p.MaxAgeRoles, r)
+		}
+	}
+	for _, pw := range commonPasswords {
+		p.blocklist[pw] = struct{}{}
+	}
+
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("读取密码黑名单失败: %v", err)
+			return p
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				p.blocklist[strings.ToLower(line)] = struct{}{}
+			}
+		}
+	}
+	return p
+}
+
+// Validate 校验密码是否符合策略，返回所有不满足的规则说明
+// 与历史密码的比较需要查询数据库，由调用方完成
+func (p *PasswordPolicy) Validate(password, username string) []string {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("密码长度不能少于%d位", p.MinLength))
+	}
+	if len(password) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("密码长度不能超过%d字节", p.MaxLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		violations = append(violations, fmt.Sprintf("密码需至少包含小写字母、大写字母、数字、符号中的%d类", p.MinClasses))
+	}
+
+	lowered := strings.ToLower(password)
+	if _, blocked := p.blocklist[lowered]; blocked {
+		violations = append(violations, "密码过于常见，请更换")
+	}
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		violations = append(violations, "密码不能包含用户名")
+	}
+
+	return violations
+}
+
+// Expired 判断指定角色的密码是否已超过最长有效期
+func (p *PasswordPolicy) Expired(role string, changedAt, now time.Time) bool {
+	for _, r := range p.MaxAgeRoles {
+		if r == role {
+			return now.Sub(changedAt) > p.MaxAge
+		}
+	}
+	return false
+}
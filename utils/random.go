@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+)
+
+// RandomHex 生成指定字节数的随机十六进制字符串
+func RandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RandomDigits 生成指定位数的随机数字字符串（用于验证码）
+func RandomDigits(n int) (string, error) {
+	b := make([]byte, n)
+	ten := big.NewInt(10)
+	for i := range b {
+		d, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", err
+		}
+		b[i] = '0' + byte(d.Int64())
+	}
+	return string(b), nil
+}
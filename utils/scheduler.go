@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// RunPeriodically 在后台按固定间隔执行任务，启动后先等待 initialDelay
+// 任务执行中发生 panic 只记录日志，不影响后续执行；interval 小于等于0时不启动
+func RunPeriodically(name string, initialDelay, interval time.Duration, task func()) {
+	if interval <= 0 {
+		log.Printf("定时任务 %s 未启用", name)
+		return
+	}
+
+	run := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("定时任务 %s 异常: %v\n%s", name, r, debug.Stack())
+			}
+		}()
+		task()
+	}
+
+	go func() {
+		time.Sleep(initialDelay)
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+	log.Printf("定时任务 %s 已启动，间隔 %s", name, interval)
+}
@@ -0,0 +1,150 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"ental-health-system/utils/ssotest"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const testRedirectURL = "https://app.example.edu/sso/callback"
+
+// authorize 走一遍授权流程，返回授权码、code_verifier 和 nonce
+func authorize(t *testing.T, idp *ssotest.Provider, claims jwt.MapClaims) (string, string, string) {
+	t.Helper()
+	cfg := idp.OIDCConfig(testRedirectURL)
+	verifier, nonce := "verifier-0123456789abcdef0123456789abcdef", "nonce-123"
+	authURL, err := cfg.AuthorizationURL("state-123", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	code, err := idp.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return code, verifier, nonce
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := ssotest.NewProvider("mhs")
+	defer idp.Close()
+	cfg := idp.OIDCConfig(testRedirectURL)
+
+	code, verifier, nonce := authorize(t, idp, jwt.MapClaims{"sub": "u-1", "preferred_username": "2023001"})
+	claims, err := cfg.Exchange(code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims["sub"] != "u-1" || claims["preferred_username"] != "2023001" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+
+	// 授权码只能使用一次
+	if _, err := cfg.Exchange(code, verifier, nonce); err == nil {
+		t.Fatal("reused authorization code was accepted")
+	}
+}
+
+func TestOIDCExchangeRejects(t *testing.T) {
+	idp := ssotest.NewProvider("mhs")
+	defer idp.Close()
+	cfg := idp.OIDCConfig(testRedirectURL)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		mutate func(verifier, nonce string) (string, string)
+	}{
+		{"wrong code verifier", nil, func(v, n string) (string, string) { return v + "x", n }},
+		{"wrong nonce", nil, func(v, n string) (string, string) { return v, n + "x" }},
+		{"wrong audience", jwt.MapClaims{"aud": "other-client"}, nil},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, nil},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{"sub": "u-1"}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			code, verifier, nonce := authorize(t, idp, claims)
+			if tt.mutate != nil {
+				verifier, nonce = tt.mutate(verifier, nonce)
+			}
+			if _, err := cfg.Exchange(code, verifier, nonce); err == nil {
+				t.Fatal("expected exchange to fail")
+			}
+		})
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	idp := ssotest.NewProvider("mhs")
+	defer idp.Close()
+	cfg := idp.OIDCConfig(testRedirectURL)
+
+	code, verifier, nonce := authorize(t, idp, jwt.MapClaims{"sub": "u-1"})
+	if _, err := cfg.Exchange(code, verifier, nonce); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	hits := idp.JWKSRequests()
+
+	// 过期等与密钥无关的校验失败不刷新公钥
+	code, verifier, nonce = authorize(t, idp, jwt.MapClaims{"sub": "u-1", "exp": time.Now().Add(-time.Minute).Unix()})
+	if _, err := cfg.Exchange(code, verifier, nonce); err == nil {
+		t.Fatal("expired id_token was accepted")
+	}
+	if got := idp.JWKSRequests(); got != hits {
+		t.Fatalf("JWKS fetched %d times after expired token, want %d", got, hits)
+	}
+
+	// 缓存的公钥中没有新的 kid，刷新公钥后重试
+	idp.RotateKey()
+	code, verifier, nonce = authorize(t, idp, jwt.MapClaims{"sub": "u-1"})
+	if _, err := cfg.Exchange(code, verifier, nonce); err != nil {
+		t.Fatalf("Exchange after key rotation: %v", err)
+	}
+	if got := idp.JWKSRequests(); got != hits+1 {
+		t.Fatalf("JWKS fetched %d times after key rotation, want %d", got, hits+1)
+	}
+}
+
+func TestCASValidateTicket(t *testing.T) {
+	idp := ssotest.NewProvider("mhs")
+	defer idp.Close()
+	const service = "https://app.example.edu/sso/cas"
+
+	cfg := idp.CASConfig(service, "3")
+	ticket := idp.IssueTicket(service, "2023001", map[string]string{"name": "张三", "email": "zs@example.edu"})
+	identity, err := cfg.ValidateTicket(ticket)
+	if err != nil {
+		t.Fatalf("ValidateTicket: %v", err)
+	}
+	if identity.User != "2023001" || identity.Attributes["name"] != "张三" || identity.Attributes["email"] != "zs@example.edu" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	// 票据只能校验一次
+	if _, err := cfg.ValidateTicket(ticket); err == nil {
+		t.Fatal("reused ticket was accepted")
+	}
+	// service 不匹配
+	ticket = idp.IssueTicket("https://other.example.edu", "2023001", nil)
+	if _, err := cfg.ValidateTicket(ticket); err == nil {
+		t.Fatal("ticket for another service was accepted")
+	}
+
+	// CAS 2.0 不返回属性
+	cfg = idp.CASConfig(service, "2")
+	ticket = idp.IssueTicket(service, "T1001", map[string]string{"name": "李老师"})
+	identity, err = cfg.ValidateTicket(ticket)
+	if err != nil {
+		t.Fatalf("ValidateTicket v2: %v", err)
+	}
+	if identity.User != "T1001" || len(identity.Attributes) != 0 {
+		t.Fatalf("unexpected v2 identity: %+v", identity)
+	}
+}
@@ -0,0 +1,286 @@
+// Package ssotest 提供本地模拟的统一认证服务（OIDC 身份提供方和 CAS 服务），
+// 基于 httptest 运行，用于测试单点登录流程和本地联调
+package ssotest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ental-health-system/utils"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Provider 模拟的统一认证服务
+type Provider struct {
+	Server   *httptest.Server
+	ClientID string
+
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	kid     string
+	seq     int
+	codes   map[string]authCode
+	tickets map[string]casTicket
+	jwksHit int
+}
+
+// authCode 已签发、尚未换取的授权码
+type authCode struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      jwt.MapClaims
+}
+
+// casTicket 已签发、尚未校验的 service ticket
+type casTicket struct {
+	service    string
+	user       string
+	attributes map[string]string
+}
+
+// NewProvider 启动模拟服务，使用完毕后需调用 Close
+func NewProvider(clientID string) *Provider {
+	p := &Provider{
+		ClientID: clientID,
+		codes:    make(map[string]authCode),
+		tickets:  make(map[string]casTicket),
+	}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/cas/serviceValidate", p.handleServiceValidate)
+	mux.HandleFunc("/cas/p3/serviceValidate", p.handleServiceValidate)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// Close 关闭模拟服务
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Issuer OIDC issuer 地址
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// OIDCConfig 指向模拟服务的 OIDC 客户端配置
+func (p *Provider) OIDCConfig(redirectURL string) *utils.OIDCConfig {
+	return &utils.OIDCConfig{
+		Issuer:      p.Issuer(),
+		ClientID:    p.ClientID,
+		RedirectURL: redirectURL,
+		Scopes:      "openid profile email",
+		HTTPClient:  p.Server.Client(),
+	}
+}
+
+// CASConfig 指向模拟服务的 CAS 客户端配置，version 为 "2" 或 "3"
+func (p *Provider) CASConfig(serviceURL, version string) *utils.CASConfig {
+	return &utils.CASConfig{
+		BaseURL:    p.Server.URL + "/cas",
+		ServiceURL: serviceURL,
+		Version:    version,
+		HTTPClient: p.Server.Client(),
+	}
+}
+
+// JWKSRequests 公钥集被请求的次数，用于检查客户端的公钥缓存
+func (p *Provider) JWKSRequests() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.jwksHit
+}
+
+// RotateKey 更换签名密钥，模拟身份提供方轮换密钥
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	p.key, p.kid = key, fmt.Sprintf("key-%d", p.seq)
+}
+
+// Authorize 模拟用户在授权页登录并同意授权：校验授权地址中的参数，返回一次性的授权码。
+// claims 会写入 ID Token，可覆盖默认的 iss、aud、exp 等声明以构造异常场景
+func (p *Provider) Authorize(authorizationURL string, claims jwt.MapClaims) (string, error) {
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	switch {
+	case q.Get("response_type") != "code":
+		return "", errors.New("response_type 必须为 code")
+	case q.Get("client_id") != p.ClientID:
+		return "", fmt.Errorf("未知的 client_id: %s", q.Get("client_id"))
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", errors.New("缺少 PKCE S256 参数")
+	case q.Get("state") == "" || q.Get("nonce") == "":
+		return "", errors.New("缺少 state 或 nonce")
+	}
+
+	code := p.randomString()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = authCode{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		claims:      claims,
+	}
+	return code, nil
+}
+
+// IssueTicket 模拟用户在 CAS 登录页登录，返回一次性的 service ticket
+func (p *Provider) IssueTicket(service, user string, attributes map[string]string) string {
+	ticket := "ST-" + p.randomString()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tickets[ticket] = casTicket{service: service, user: user, attributes: attributes}
+	return ticket
+}
+
+// randomString 生成随机字符串
+func (p *Provider) randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	pub, kid := p.key.PublicKey, p.kid
+	p.jwksHit++
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code")) // 授权码只能使用一次
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || code.clientID != r.PostForm.Get("client_id") || code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": code.nonce,
+	}
+	for k, v := range code.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func (p *Provider) handleServiceValidate(w http.ResponseWriter, r *http.Request) {
+	ticketID, service := r.URL.Query().Get("ticket"), r.URL.Query().Get("service")
+
+	p.mu.Lock()
+	ticket, ok := p.tickets[ticketID]
+	delete(p.tickets, ticketID) // 票据只能校验一次
+	p.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString(`<cas:serviceResponse xmlns:cas="http://www.yale.edu/tp/cas">`)
+	if !ok || ticket.service != service {
+		fmt.Fprintf(&b, `<cas:authenticationFailure code="INVALID_TICKET">Ticket %s not recognized</cas:authenticationFailure>`,
+			xmlEscape(ticketID))
+	} else {
+		fmt.Fprintf(&b, `<cas:authenticationSuccess><cas:user>%s</cas:user>`, xmlEscape(ticket.user))
+		// CAS 2.0 协议不返回属性
+		if strings.Contains(r.URL.Path, "/p3/") && len(ticket.attributes) > 0 {
+			b.WriteString("<cas:attributes>")
+			for name, value := range ticket.attributes {
+				fmt.Fprintf(&b, "<cas:%s>%s</cas:%s>", name, xmlEscape(value), name)
+			}
+			b.WriteString("</cas:attributes>")
+		}
+		b.WriteString("</cas:authenticationSuccess>")
+	}
+	b.WriteString("</cas:serviceResponse>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// writeJSON 输出JSON响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// xmlEscape 转义XML文本
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Storage 对象存储接口，头像等用户上传文件通过它保存，便于替换为 MinIO、OSS 等实现
+type Storage interface {
+	// Put 保存对象，key 为以 / 分隔的相对路径
+	Put(key string, r io.Reader, contentType string) error
+	// Open 读取对象
+	Open(key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(key string) error
+	// URL 返回对象的访问地址
+	URL(key string) string
+}
+
+// LocalStorage 本地文件系统存储
+type LocalStorage struct {
+	Root      string // 存储根目录
+	URLPrefix string // 访问地址前缀，如 /uploads 或 https://cdn.example.com/uploads
+}
+
+// path 将对象key转换为本地路径，拒绝越出根目录的key
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(clean)), nil
+}
+
+// Put 先写入临时文件再重命名，避免读到写了一半的文件
+func (s *LocalStorage) Put(key string, r io.Reader, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Open 打开本地文件
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Delete 删除本地文件
+func (s *LocalStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL 返回文件的访问地址
+func (s *LocalStorage) URL(key string) string {
+	return strings.TrimSuffix(s.URLPrefix, "/") + "/" + strings.TrimPrefix(key, "/")
+}
+
+var (
+	currentStorage Storage
+	privateStorage Storage
+	storageMu      sync.RWMutex
+	storageOnce    sync.Once
+)
+
+// SetStorage 替换当前使用的公开对象存储
+func SetStorage(s Storage) {
+	initStorage()
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	currentStorage = s
+}
+
+// SetPrivateStorage 替换当前使用的私有对象存储
+func SetPrivateStorage(s Storage) {
+	initStorage()
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	privateStorage = s
+}
+
+// CurrentStorage 返回当前使用的公开对象存储，其中的文件可通过 URL 直接访问
+func CurrentStorage() Storage {
+	initStorage()
+	storageMu.RLock()
+	defer storageMu.RUnlock()
+	return currentStorage
+}
+
+// PrivateStorage 返回私有对象存储，其中的文件只能经由接口鉴权后读取，如个人数据导出包
+func PrivateStorage() Storage {
+	initStorage()
+	storageMu.RLock()
+	defer storageMu.RUnlock()
+	return privateStorage
+}
+
+// initStorage 初始化默认的本地文件系统存储
+// 公开存储通过 STORAGE_LOCAL_DIR（默认 ./uploads）和 STORAGE_URL_PREFIX（默认 /uploads）配置，
+// 私有存储通过 STORAGE_PRIVATE_DIR（默认 ./storage/private）配置，该目录不能被静态路由暴露
+func initStorage() {
+	storageOnce.Do(func() {
+		root := os.Getenv("STORAGE_LOCAL_DIR")
+		if root == "" {
+			root = "./uploads"
+		}
+		prefix := os.Getenv("STORAGE_URL_PREFIX")
+		if prefix == "" {
+			prefix = "/uploads"
+		}
+		privateRoot := os.Getenv("STORAGE_PRIVATE_DIR")
+		if privateRoot == "" {
+			privateRoot = "./storage/private"
+		}
+		storageMu.Lock()
+		defer storageMu.Unlock()
+		currentStorage = &LocalStorage{Root: root, URLPrefix: prefix}
+		privateStorage = &LocalStorage{Root: privateRoot}
+	})
+}
+
+// StorageKeyFromURL 从访问地址反解出对象key，地址不属于当前存储时返回false
+func StorageKeyFromURL(url string) (string, bool) {
+	prefix := CurrentStorage().URL("")
+	if url == "" || !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, prefix), true
+}
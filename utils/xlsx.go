@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 仅实现名单导入导出需要的 XLSX 子集：读取第一个工作表的单元格文本，写出只含字符串的单个工作表
+
+// xlsxMaxPartSize 单个XML部件的最大解压大小，防止压缩炸弹
+const xlsxMaxPartSize = 64 << 20
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRichText struct {
+	T  string `xml:"t"`
+	Rs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt xlsxRichText) text() string {
+	if len(rt.Rs) == 0 {
+		return rt.T
+	}
+	var b strings.Builder
+	for _, r := range rt.Rs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Num   int `xml:"r,attr"` // 从1开始的行号，空行不会出现在文件中
+		Cells []struct {
+			Ref    string       `xml:"r,attr"`
+			Type   string       `xml:"t,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXPart 解析压缩包中的XML部件
+func readXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("xlsx: 缺少 %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, xlsxMaxPartSize)).Decode(v)
+}
+
+// ReadXLSX 读取工作簿第一个工作表的所有单元格文本，按行返回，缺失的单元格为空字符串
+// 数字和日期以存储的原始值返回，日期为 Excel 序列号，可用 ExcelSerialToTime 转换
+func ReadXLSX(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: 无效的文件: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := readXLSXPart(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, errors.New("xlsx: 工作簿中没有工作表")
+	}
+	var rels xlsxRelationships
+	if err := readXLSXPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == wb.Sheets[0].RelID {
+			sheetPath = rel.Target
+			if strings.HasPrefix(sheetPath, "/") {
+				sheetPath = strings.TrimPrefix(sheetPath, "/")
+			} else {
+				sheetPath = path.Join("xl", sheetPath)
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, errors.New("xlsx: 找不到第一个工作表")
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXLSXPart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := readXLSXPart(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		// 补齐被省略的空行，保证返回的行号与表格一致
+		for row.Num > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+		var values []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				if col, err = xlsxColumnIndex(cell.Ref); err != nil {
+					return nil, err
+				}
+			}
+			var text string
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, fmt.Errorf("xlsx: 单元格 %s 的共享字符串索引无效", cell.Ref)
+				}
+				text = shared.Items[idx].text()
+			case "inlineStr":
+				text = cell.Inline.text()
+			default:
+				text = cell.Value
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+			values[col] = text
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// xlsxColumnIndex 将单元格引用（如 AB12）转换为从0开始的列号
+func xlsxColumnIndex(ref string) (int, error) {
+	col := 0
+	for i, ch := range ref {
+		if ch >= 'A' && ch <= 'Z' {
+			col = col*26 + int(ch-'A') + 1
+			continue
+		}
+		if i == 0 {
+			break
+		}
+		return col - 1, nil
+	}
+	return 0, fmt.Errorf("xlsx: 无效的单元格引用 %q", ref)
+}
+
+// xlsxColumnName 将从0开始的列号转换为列名（如 0 -> A，27 -> AB）
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// ExcelSerialToTime 将 Excel（1900日期系统）的日期序列号转换为时间
+func ExcelSerialToTime(serial float64) time.Time {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local)
+	days := int(serial)
+	frac := serial - float64(days)
+	return base.AddDate(0, 0, days).Add(time.Duration(frac * float64(24*time.Hour)))
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// WriteXLSX 将所有单元格作为文本写出为只含一个工作表的 XLSX 文件
+func WriteXLSX(w io.Writer, rows [][]string) error {
+	zw := zip.NewWriter(w)
+	static := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range static {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if _, err := fmt.Fprintf(f, `<row r="%d">`, i+1); err != nil {
+			return err
+		}
+		for j, value := range row {
+			if _, err := fmt.Fprintf(f, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, xlsxColumnName(j), i+1); err != nil {
+				return err
+			}
+			if err := xml.EscapeText(f, []byte(value)); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(f, `</t></is></c>`); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(f, `</row>`); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(f, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return zw.Close()
+}